@@ -62,23 +62,47 @@ func (a *App) InitializeConnection(connectionString string) error {
 		return fmt.Errorf("parse age identity: %w", err)
 	}
 
+	s3config := s3.Config{
+		URL:          conn.URL,
+		Region:       conn.Region,
+		Bucket:       conn.Bucket,
+		KeyID:        conn.KeyID,
+		KeySecret:    conn.KeySecret,
+		StorageClass: conn.StorageClass,
+		Insecure:     os.Getenv("PICKLE_INSECURE_S3") != "",
+
+		AddressingStyle: s3.AddressingStyle(conn.AddressingStyle),
+
+		OnClockSkew: func(offset time.Duration) {
+			runtime.EventsEmit(a.ctx, "clock-skew", offset.Seconds())
+		},
+	}
+	if err := s3.ApplyTransportEnv(&s3config, "PICKLE_S3_"); err != nil {
+		return err
+	}
+
 	a.bucket = &bucket.Config{
-		Client: s3.NewClient(s3.Config{
-			URL:          conn.URL,
-			Region:       conn.Region,
-			Bucket:       conn.Bucket,
-			KeyID:        conn.KeyID,
-			KeySecret:    conn.KeySecret,
-			StorageClass: conn.StorageClass,
-			Insecure:     os.Getenv("PICKLE_INSECURE_S3") != "",
-		}),
+		Storage:         s3.NewClient(s3config),
 		Key:             key,
 		ObjectLockHours: conn.ObjectLockHours,
+		ObjectLockMode:  conn.ObjectLockMode,
+
+		Compression:      conn.Compression,
+		CompressionLevel: conn.CompressionLevel,
 	}
 
 	return nil
 }
 
+func (a *App) CheckConnection() ([]bucket.CheckItem, error) {
+	b, err := bucket.New(a.bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Check()
+}
+
 func (a *App) SelectFile() (string, error) {
 	file, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
 		Title: "Choose a file to archive",
@@ -117,10 +141,10 @@ func (a *App) ListFilesInTrash() ([]bucket.BucketFile, error) {
 	return b.GetTrashedFiles()
 }
 
-func (a *App) UploadFile(diskPath string, targetPath string) error {
+func (a *App) UploadFile(diskPath string, targetPath string) (bucket.UploadResult, error) {
 	b, err := bucket.New(a.bucket)
 	if err != nil {
-		return err
+		return bucket.UploadResult{}, err
 	}
 
 	return b.UploadFile(diskPath, targetPath)
@@ -186,24 +210,45 @@ func (a *App) RestoreFile(key string) error {
 	return b.RestoreFile(key)
 }
 
+func (a *App) SetLegalHold(path string, on bool) error {
+	b, err := bucket.New(a.bucket)
+	if err != nil {
+		return err
+	}
+
+	return b.SetLegalHold(path, on)
+}
+
+func (a *App) ShareFile(key string, recipient string, hours int) (bucket.ShareResult, error) {
+	b, err := bucket.New(a.bucket)
+	if err != nil {
+		return bucket.ShareResult{}, err
+	}
+
+	return b.ShareFile(key, recipient, time.Duration(hours)*time.Hour)
+}
+
 func (a *App) triggerMaintenance() {
 	a.maintainedAt = time.Now()
 
 	go func() {
 		runtime.EventsEmit(a.ctx, "maintenance-start")
 
-		bucket, err := bucket.New(a.bucket)
+		b, err := bucket.New(a.bucket)
 		if err != nil {
 			runtime.EventsEmit(a.ctx, "maintenance-end", err)
 			return
 		}
 
-		err = bucket.RunMaintenance()
+		// the app runs often, so locks are only renewed once half of the lock period has passed
+		report, err := b.RunMaintenance(bucket.MaintenanceOptions{
+			RenewalWindow: time.Duration(a.bucket.ObjectLockHours) * time.Hour / 2,
+		})
 		if err != nil {
-			runtime.EventsEmit(a.ctx, "maintenance-end", err)
+			runtime.EventsEmit(a.ctx, "maintenance-end", err, report)
 			return
 		}
 
-		runtime.EventsEmit(a.ctx, "maintenance-end")
+		runtime.EventsEmit(a.ctx, "maintenance-end", nil, report)
 	}()
 }
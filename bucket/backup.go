@@ -3,123 +3,373 @@ package bucket
 import (
 	"fmt"
 	"log/slog"
+	"maps"
 	"slices"
+	"strings"
 	"time"
 
 	"github.com/bradenrayhorn/pickle/s3"
 )
 
-func BackupBucket(sourceConfig s3.Config, targetConfig s3.Config) error {
-	source := s3.NewClient(sourceConfig)
-	target := s3.NewClient(targetConfig)
+// Objects under this prefix belong to the backup itself and are never copied or deleted.
+const backupStatePrefix = "_pickle/backup/"
 
+const backupPendingDeletesKey = backupStatePrefix + "pending-deletes"
+
+type BackupOptions struct {
+	// Delete removes objects from the target that are no longer in the source. Without it the
+	// backup is append-only.
+	Delete bool
+	// DeleteDelay is how long an object must be missing from the source before it is deleted.
+	DeleteDelay time.Duration
+	// MaxDeletes aborts the backup if more objects would be deleted. Zero means no limit.
+	MaxDeletes int
+	// MaxDeletePercent aborts the backup if more than this percent of the target would be
+	// deleted. Zero means no limit.
+	MaxDeletePercent float64
+
+	// FullScan ignores the cached metadata and reads every version from both sides.
+	FullScan bool
+	// LockRefreshWindow re-reads cached source versions whose lock ends within this window.
+	// Defaults to seven days. Versions without a lock are not re-read, a FullScan picks up
+	// locks that were added to them later.
+	LockRefreshWindow time.Duration
+
+	NowFunc func() time.Time
+}
+
+// BackupPlan is the set of changes a backup makes to the target.
+type BackupPlan struct {
+	Uploads        []BackupObject        `json:"uploads"`
+	Deletes        []BackupObject        `json:"deletes"`
+	LockExtensions []BackupLockExtension `json:"lockExtensions"`
+	Duplicates     []BackupObject        `json:"duplicates"`
+	PendingDeletes []BackupPendingDelete `json:"pendingDeletes"`
+
+	// TargetObjects is the number of distinct objects in the target before the backup.
+	TargetObjects int `json:"targetObjects"`
+
+	now            time.Time
+	pending        map[string]pendingDelete
+	pendingChanged bool
+	sourceCache    *metadataCache
+	targetCache    *metadataCache
+	skipState      bool
+}
+
+type BackupObject struct {
+	Key       string `json:"key"`
+	VersionID string `json:"versionID"`
+	PickleID  string `json:"pickleID"`
+}
+
+type BackupLockExtension struct {
+	BackupObject
+	Mode  string    `json:"mode"`
+	From  time.Time `json:"from"`
+	Until time.Time `json:"until"`
+}
+
+type BackupPendingDelete struct {
+	BackupObject
+	MissingSince time.Time `json:"missingSince"`
+	DeleteAfter  time.Time `json:"deleteAfter"`
+}
+
+// pendingDelete is stored on the target to remember when an object went missing from the source.
+type pendingDelete struct {
+	Key          string    `json:"key"`
+	VersionID    string    `json:"versionID"`
+	MissingSince time.Time `json:"missingSince"`
+}
+
+func (p *BackupPlan) IsEmpty() bool {
+	return len(p.Uploads) == 0 && len(p.Deletes) == 0 && len(p.LockExtensions) == 0 && len(p.Duplicates) == 0
+}
+
+func BackupBucket(source Storage, target Storage, options BackupOptions) error {
 	slog.Info("running pickle backup...")
 
-	objects, err := source.ListAllObjectVersions("")
+	src, err := listBackupSource(source)
 	if err != nil {
-		return fmt.Errorf("get bucket objects: %w", err)
+		return err
+	}
+
+	if _, err := backupToTarget(src, target, options, slog.Default()); err != nil {
+		return err
+	}
+
+	slog.Info("pickle backup complete")
+
+	return nil
+}
+
+func backupToTarget(src *backupSource, target Storage, options BackupOptions, logger *slog.Logger) (*BackupPlan, error) {
+	plan, err := planBackup(src, target, options, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := options.checkDeleteLimits(plan); err != nil {
+		return plan, err
+	}
+
+	if err := applyBackupPlan(src.storage, target, plan, logger); err != nil {
+		return plan, err
+	}
+
+	return plan, nil
+}
+
+func (o BackupOptions) now() time.Time {
+	if o.NowFunc != nil {
+		return o.NowFunc()
+	}
+	return time.Now()
+}
+
+func (o BackupOptions) checkDeleteLimits(plan *BackupPlan) error {
+	deletes := len(plan.Deletes)
+	if deletes == 0 {
+		return nil
+	}
+
+	if o.MaxDeletes > 0 && deletes > o.MaxDeletes {
+		return fmt.Errorf("refusing to delete %d objects from the target, the limit is %d", deletes, o.MaxDeletes)
+	}
+
+	if o.MaxDeletePercent > 0 && plan.TargetObjects > 0 {
+		percent := float64(deletes) / float64(plan.TargetObjects) * 100
+		if percent > o.MaxDeletePercent {
+			return fmt.Errorf("refusing to delete %.1f%% of the target, the limit is %.1f%%", percent, o.MaxDeletePercent)
+		}
 	}
 
+	return nil
+}
+
+// PlanBackup compares source and target and returns what a backup would change, without
+// changing anything.
+func PlanBackup(source Storage, target Storage, options BackupOptions) (*BackupPlan, error) {
+	src, err := listBackupSource(source)
+	if err != nil {
+		return nil, err
+	}
+
+	return planBackup(src, target, options, slog.Default())
+}
+
+func planBackup(src *backupSource, target Storage, options BackupOptions, logger *slog.Logger) (*BackupPlan, error) {
 	targetObjects, err := target.ListAllObjectVersions("")
 	if err != nil {
-		return fmt.Errorf("get target objects: %w", err)
+		return nil, fmt.Errorf("get target objects: %w", err)
+	}
+
+	pending := map[string]pendingDelete{}
+	if err := getBackupStateObject(target, targetObjects, backupPendingDeletesKey, &pending); err != nil {
+		return nil, fmt.Errorf("get pending deletes: %w", err)
+	}
+
+	state := backupState{}
+	if !options.FullScan {
+		if err := getBackupStateObject(target, targetObjects, backupMetadataKey, &state); err != nil {
+			return nil, fmt.Errorf("get backup state: %w", err)
+		}
 	}
 
+	targetObjects.Versions = slices.DeleteFunc(targetObjects.Versions, isBackupStateVersion)
+
 	// Reverse Versions so that oldest version is processed first.
-	slices.Reverse(objects.Versions)
 	slices.Reverse(targetObjects.Versions)
 
 	// Get only oldest version of each object
 	srcObjects := map[string]*s3.ObjectMetadata{}
 	dstObjects := map[string]*s3.ObjectMetadata{}
 
-	duplicateDstObjects := []*s3.ObjectMetadata{}
+	// Keep listing order so that versions are copied oldest first.
+	srcOrder := []*s3.ObjectMetadata{}
+	dstOrder := []*s3.ObjectMetadata{}
 
-	for _, object := range objects.Versions {
-		meta, err := source.HeadObject(object.Key, object.VersionId)
+	plan := &BackupPlan{
+		Uploads:        []BackupObject{},
+		Deletes:        []BackupObject{},
+		LockExtensions: []BackupLockExtension{},
+		Duplicates:     []BackupObject{},
+		PendingDeletes: []BackupPendingDelete{},
+		pending:        map[string]pendingDelete{},
+	}
+
+	// Source locks are extended by maintenance, which does not show up in listings. Cached lock
+	// dates are trusted until they come close to expiring.
+	now := options.now()
+	plan.now = now
+	refreshWindow := options.LockRefreshWindow
+	if refreshWindow == 0 {
+		refreshWindow = defaultLockRefreshWindow
+	}
+	plan.sourceCache = newMetadataCache(src.head, state.Source, func(cached cachedVersion) bool {
+		return options.FullScan || (!cached.LockUntil.IsZero() && cached.LockUntil.Before(now.Add(refreshWindow)))
+	})
+	plan.targetCache = newMetadataCache(target.HeadObject, state.Target, func(cachedVersion) bool {
+		return options.FullScan
+	})
+
+	for _, object := range src.versions {
+		meta, err := plan.sourceCache.head(object)
 		if err != nil {
-			return fmt.Errorf("get meta [src] %s: %w", object.Key, err)
+			return nil, fmt.Errorf("get meta [src] %s: %w", object.Key, err)
 		}
 
 		if _, ok := srcObjects[meta.PickleID]; !ok {
 			srcObjects[meta.PickleID] = meta
+			srcOrder = append(srcOrder, meta)
 		}
 	}
 
 	for _, object := range targetObjects.Versions {
-		meta, err := target.HeadObject(object.Key, object.VersionId)
+		meta, err := plan.targetCache.head(object)
 		if err != nil {
-			return fmt.Errorf("get meta [dst] %s: %w", object.Key, err)
+			return nil, fmt.Errorf("get meta [dst] %s: %w", object.Key, err)
 		}
 
 		if _, ok := dstObjects[meta.PickleID]; !ok {
 			dstObjects[meta.PickleID] = meta
-		} else {
-			duplicateDstObjects = append(duplicateDstObjects, meta)
-			slog.Info(fmt.Sprintf("will delete duplicate object in dst at %s", object.Key), "versionID", meta.VersionID)
+			dstOrder = append(dstOrder, meta)
+		} else if options.Delete {
+			plan.Duplicates = append(plan.Duplicates, toBackupObject(meta))
+			logger.Info(fmt.Sprintf("will delete duplicate object in dst at %s", object.Key), "versionID", meta.VersionID)
 		}
 	}
 
-	toUpload := []*s3.ObjectMetadata{}
-	toDelete := []*s3.ObjectMetadata{}
+	plan.TargetObjects = len(dstOrder)
 
 	// check for objects that are in src but not dst
-	for _, object := range srcObjects {
+	for _, object := range srcOrder {
 		if _, ok := dstObjects[object.PickleID]; !ok {
-			toUpload = append(toUpload, object)
-			slog.Info(fmt.Sprintf("will upload %s to dst", object.Key))
+			plan.Uploads = append(plan.Uploads, toBackupObject(object))
+			logger.Info(fmt.Sprintf("will upload %s to dst", object.Key))
 		}
 	}
 
 	// check for objects that are in dst but not src
-	for _, object := range dstObjects {
+	for _, object := range dstOrder {
 		if srcMeta, ok := srcObjects[object.PickleID]; ok {
 			// extend lock if object is also in src AND has object lock enabled in src
 			if !srcMeta.ObjectLockRetainUntilDate.IsZero() && srcMeta.ObjectLockRetainUntilDate.After(object.ObjectLockRetainUntilDate) {
-				slog.Info(fmt.Sprintf("extending lock of %s in dst until %s", object.Key, srcMeta.ObjectLockRetainUntilDate.Format(time.RFC1123)), "versionID", object.VersionID)
+				plan.LockExtensions = append(plan.LockExtensions, BackupLockExtension{
+					BackupObject: toBackupObject(object),
+					Mode:         extensionLockMode(srcMeta.ObjectLockMode, object.ObjectLockMode),
+					From:         object.ObjectLockRetainUntilDate,
+					Until:        srcMeta.ObjectLockRetainUntilDate,
+				})
+				logger.Info(fmt.Sprintf("will extend lock of %s in dst until %s", object.Key, srcMeta.ObjectLockRetainUntilDate.Format(time.RFC1123)), "versionID", object.VersionID)
+			}
+		} else if options.Delete {
+			// otherwise delete it once it has been missing for long enough - the object is not in src
+			missing, ok := pending[object.PickleID]
+			if !ok {
+				missing = pendingDelete{Key: object.Key, VersionID: object.VersionID, MissingSince: now}
+			}
 
-				err := target.PutObjectRetention(object.Key, object.VersionID, &s3.ObjectLockRetention{
-					Mode:  "COMPLIANCE",
-					Until: srcMeta.ObjectLockRetainUntilDate,
+			deleteAfter := missing.MissingSince.Add(options.DeleteDelay)
+			if now.Before(deleteAfter) {
+				plan.pending[object.PickleID] = missing
+				plan.PendingDeletes = append(plan.PendingDeletes, BackupPendingDelete{
+					BackupObject: toBackupObject(object),
+					MissingSince: missing.MissingSince,
+					DeleteAfter:  deleteAfter,
 				})
-				if err != nil {
-					return fmt.Errorf("extend lock %s: %w", object.Key, err)
-				}
+				logger.Info(fmt.Sprintf("%s no longer in src, will delete from dst after %s", object.Key, deleteAfter.Format(time.RFC1123)))
+			} else {
+				plan.Deletes = append(plan.Deletes, toBackupObject(object))
+				logger.Info(fmt.Sprintf("%s no longer in src, will delete from dst", object.Key))
 			}
-		} else {
-			// otherwise delete it - the object is not in src
-			toDelete = append(toDelete, object)
-			slog.Info(fmt.Sprintf("%s no longer in src, will delete from dst", object.Key))
 		}
 	}
 
-	// remove duplicates
-	toDelete = append(toDelete, duplicateDstObjects...)
+	// Objects that came back to src or were deleted drop out of the pending list.
+	plan.pendingChanged = options.Delete && !maps.Equal(pending, plan.pending)
+
+	return plan, nil
+}
+
+// extensionLockMode follows the source's lock mode, but never weakens a COMPLIANCE lock in the
+// target, which storage would refuse.
+func extensionLockMode(source string, target string) string {
+	if source == "" || target == s3.LockModeCompliance {
+		return s3.LockModeCompliance
+	}
+	return source
+}
+
+func applyBackupPlan(source Storage, target Storage, plan *BackupPlan, logger *slog.Logger) error {
+	// process lock extensions
+	for _, extension := range plan.LockExtensions {
+		logger.Info(fmt.Sprintf("extending lock of %s in dst until %s", extension.Key, extension.Until.Format(time.RFC1123)), "versionID", extension.VersionID)
+
+		err := target.PutObjectRetention(extension.Key, extension.VersionID, &s3.ObjectLockRetention{
+			Mode:  extension.Mode,
+			Until: extension.Until,
+		})
+		if err != nil {
+			return fmt.Errorf("extend lock %s: %w", extension.Key, err)
+		}
+		plan.targetCache.setLock(extension.Key, extension.VersionID, extension.Mode, extension.Until)
+	}
 
 	// process uploads
-	for _, object := range toUpload {
-		slog.Info(fmt.Sprintf("streaming %s to dst", object.Key))
-		err := target.StreamObjectTo(object.Key, object.Key, object.VersionID, source)
+	for _, object := range plan.Uploads {
+		logger.Info(fmt.Sprintf("streaming %s to dst", object.Key))
+		err := copyObject(target, object.Key, source, object.Key, object.VersionID, plan.now)
 		if err != nil {
 			return fmt.Errorf("failed to copy object %s: %w", object.Key, err)
 		}
 	}
 
-	// process deletes
+	// process deletes, including duplicates
 	toDeleteIdentifiers := []s3.ObjectIdentifier{}
-	for _, object := range toDelete {
+	for _, object := range slices.Concat(plan.Deletes, plan.Duplicates) {
 		toDeleteIdentifiers = append(toDeleteIdentifiers, s3.ObjectIdentifier{Key: object.Key, VersionID: object.VersionID})
 	}
 
 	if len(toDeleteIdentifiers) > 0 {
-		slog.Info("deleting objects...")
-		_, err = target.DeleteObjects(toDeleteIdentifiers)
+		logger.Info("deleting objects...")
+		_, err := target.DeleteObjects(toDeleteIdentifiers)
 		if err != nil {
 			return fmt.Errorf("delete objects: %w", err)
 		}
 	}
 
-	slog.Info("pickle backup complete")
+	if plan.pendingChanged {
+		if err := putBackupStateObject(target, backupPendingDeletesKey, plan.pending); err != nil {
+			return fmt.Errorf("persist pending deletes: %w", err)
+		}
+	}
+
+	if !plan.skipState && (plan.sourceCache.changed() || plan.targetCache.changed()) {
+		state := backupState{Source: plan.sourceCache.current, Target: plan.targetCache.current}
+		if err := putBackupStateObject(target, backupMetadataKey, state); err != nil {
+			return fmt.Errorf("persist backup state: %w", err)
+		}
+	}
 
 	return nil
 }
+
+func isBackupStateVersion(version s3.VersionInfo) bool {
+	return strings.HasPrefix(version.Key, backupStatePrefix)
+}
+
+// isSkippedByBackup reports whether a source version is left out of backups. Shared copies
+// only live until their link expires, in an append-only target they would stay forever.
+func isSkippedByBackup(version s3.VersionInfo) bool {
+	return isBackupStateVersion(version) || strings.HasPrefix(version.Key, sharePrefix)
+}
+
+func toBackupObject(meta *s3.ObjectMetadata) BackupObject {
+	return BackupObject{
+		Key:       meta.Key,
+		VersionID: meta.VersionID,
+		PickleID:  meta.PickleID,
+	}
+}
@@ -0,0 +1,169 @@
+package bucket
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/bradenrayhorn/pickle/s3"
+)
+
+// backupMetadataKey caches the metadata of every version on both sides of a backup, so that
+// incremental runs only read new versions.
+const backupMetadataKey = backupStatePrefix + "state"
+
+const defaultLockRefreshWindow = 7 * 24 * time.Hour
+
+type backupState struct {
+	Source map[string]cachedVersion `json:"source"`
+	Target map[string]cachedVersion `json:"target"`
+}
+
+type cachedVersion struct {
+	PickleID  string    `json:"id"`
+	SHA256    string    `json:"sha256"`
+	LockMode  string    `json:"lockMode,omitempty"`
+	LockUntil time.Time `json:"lockUntil,omitzero"`
+}
+
+func (v cachedVersion) equal(other cachedVersion) bool {
+	return v.PickleID == other.PickleID &&
+		v.SHA256 == other.SHA256 &&
+		v.LockMode == other.LockMode &&
+		v.LockUntil.Equal(other.LockUntil)
+}
+
+// metadataCache answers HeadObject from the backup state, only asking storage about versions
+// it has not seen before or that need a refresh.
+type metadataCache struct {
+	fetch    func(key string, versionID string) (*s3.ObjectMetadata, error)
+	previous map[string]cachedVersion
+	current  map[string]cachedVersion
+	refresh  func(cachedVersion) bool
+	dirty    bool
+}
+
+func newMetadataCache(fetch func(key string, versionID string) (*s3.ObjectMetadata, error), previous map[string]cachedVersion, refresh func(cachedVersion) bool) *metadataCache {
+	if previous == nil {
+		previous = map[string]cachedVersion{}
+	}
+
+	return &metadataCache{
+		fetch:    fetch,
+		previous: previous,
+		current:  map[string]cachedVersion{},
+		refresh:  refresh,
+	}
+}
+
+func cachedVersionID(key string, versionID string) string {
+	// version IDs never contain a slash, keys often do
+	return versionID + "/" + key
+}
+
+func (c *metadataCache) head(version s3.VersionInfo) (*s3.ObjectMetadata, error) {
+	id := cachedVersionID(version.Key, version.VersionId)
+
+	cached, ok := c.previous[id]
+	if !ok || c.refresh(cached) {
+		meta, err := c.fetch(version.Key, version.VersionId)
+		if err != nil {
+			return nil, err
+		}
+
+		fresh := cachedVersion{
+			PickleID:  meta.PickleID,
+			SHA256:    meta.PickleSHA256,
+			LockMode:  meta.ObjectLockMode,
+			LockUntil: meta.ObjectLockRetainUntilDate,
+		}
+		if !ok || !cached.equal(fresh) {
+			c.dirty = true
+		}
+		cached = fresh
+	}
+
+	c.current[id] = cached
+
+	return &s3.ObjectMetadata{
+		Key:                       version.Key,
+		VersionID:                 version.VersionId,
+		PickleID:                  cached.PickleID,
+		PickleSHA256:              cached.SHA256,
+		ObjectLockMode:            cached.LockMode,
+		ObjectLockRetainUntilDate: cached.LockUntil,
+	}, nil
+}
+
+func (c *metadataCache) setLock(key string, versionID string, mode string, until time.Time) {
+	id := cachedVersionID(key, versionID)
+	if cached, ok := c.current[id]; ok {
+		cached.LockMode = mode
+		cached.LockUntil = until
+		c.current[id] = cached
+		c.dirty = true
+	}
+}
+
+// changed reports whether the cache differs from the state it was loaded from.
+func (c *metadataCache) changed() bool {
+	if c.dirty || len(c.current) != len(c.previous) {
+		return true
+	}
+
+	for id := range c.current {
+		if _, ok := c.previous[id]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// getBackupStateObject reads the latest version of a JSON state object from the target into v.
+// v is left untouched if the object does not exist yet.
+func getBackupStateObject(target Storage, targetObjects *s3.ListAllObjectVersionsResult, key string, v any) error {
+	i := slices.IndexFunc(targetObjects.Versions, func(version s3.VersionInfo) bool {
+		return version.Key == key && version.IsLatest
+	})
+	if i < 0 {
+		return nil
+	}
+
+	reader, err := target.GetObject(key, targetObjects.Versions[i].VersionId)
+	if err != nil {
+		return fmt.Errorf("get object: %w", err)
+	}
+	defer func() { _ = reader.Close() }()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("read object: %w", err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parse: %w", err)
+	}
+
+	return nil
+}
+
+func putBackupStateObject(target Storage, key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	res, err := putBytes(target, key, data, nil)
+	if err != nil {
+		return fmt.Errorf("put object: %w", err)
+	}
+
+	versions, err := target.ListAllObjectVersions(key)
+	if err != nil {
+		return fmt.Errorf("list versions: %w", err)
+	}
+
+	return deleteOtherVersions(target, versions, key, res.VersionID)
+}
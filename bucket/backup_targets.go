@@ -0,0 +1,136 @@
+package bucket
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"github.com/bradenrayhorn/pickle/s3"
+)
+
+type BackupTarget struct {
+	Name    string
+	Storage Storage
+}
+
+type BackupResult struct {
+	Name string
+	// Plan is what was, or would be, changed in the target. It may be nil if planning failed.
+	Plan *BackupPlan
+	Err  error
+}
+
+// backupSource is the source listing, shared by every target of a backup. Metadata read for
+// one target is reused by the others.
+type backupSource struct {
+	storage Storage
+	// versions are oldest first
+	versions []s3.VersionInfo
+
+	mu    sync.Mutex
+	heads map[string]*sourceHead
+}
+
+// sourceHead is the metadata of a source version, read once for all targets. done is closed
+// once meta and err are set.
+type sourceHead struct {
+	done chan struct{}
+	meta *s3.ObjectMetadata
+	err  error
+}
+
+func listBackupSource(source Storage) (*backupSource, error) {
+	objects, err := source.ListAllObjectVersions("")
+	if err != nil {
+		return nil, fmt.Errorf("get bucket objects: %w", err)
+	}
+
+	versions := slices.DeleteFunc(objects.Versions, isSkippedByBackup)
+
+	// Reverse Versions so that oldest version is processed first.
+	slices.Reverse(versions)
+
+	return &backupSource{
+		storage:  source,
+		versions: versions,
+		heads:    map[string]*sourceHead{},
+	}, nil
+}
+
+// head reads the metadata of a source version. Targets asking for a version that is already
+// being read wait for that request instead of sending their own.
+func (s *backupSource) head(key string, versionID string) (*s3.ObjectMetadata, error) {
+	id := cachedVersionID(key, versionID)
+
+	s.mu.Lock()
+	head, ok := s.heads[id]
+	if !ok {
+		head = &sourceHead{done: make(chan struct{})}
+		s.heads[id] = head
+	}
+	s.mu.Unlock()
+
+	if ok {
+		<-head.done
+		return head.meta, head.err
+	}
+
+	head.meta, head.err = s.storage.HeadObject(key, versionID)
+	if head.err != nil {
+		// later callers try again
+		s.mu.Lock()
+		delete(s.heads, id)
+		s.mu.Unlock()
+	}
+	close(head.done)
+
+	return head.meta, head.err
+}
+
+// BackupToTargets backs up source to every target in parallel. The source is only listed once.
+// A failing target does not stop the others, each gets its own result.
+func BackupToTargets(source Storage, targets []BackupTarget, options BackupOptions) ([]BackupResult, error) {
+	return runBackupTargets(source, targets, func(src *backupSource, target BackupTarget, logger *slog.Logger) (*BackupPlan, error) {
+		return backupToTarget(src, target.Storage, options, logger)
+	})
+}
+
+// PlanBackupToTargets returns what BackupToTargets would change, without changing anything.
+func PlanBackupToTargets(source Storage, targets []BackupTarget, options BackupOptions) ([]BackupResult, error) {
+	return runBackupTargets(source, targets, func(src *backupSource, target BackupTarget, logger *slog.Logger) (*BackupPlan, error) {
+		return planBackup(src, target.Storage, options, logger)
+	})
+}
+
+func runBackupTargets(source Storage, targets []BackupTarget, run func(*backupSource, BackupTarget, *slog.Logger) (*BackupPlan, error)) ([]BackupResult, error) {
+	slog.Info("running pickle backup...", "targets", len(targets))
+
+	src, err := listBackupSource(source)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]BackupResult, len(targets))
+
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			logger := slog.With("target", target.Name)
+			plan, err := run(src, target, logger)
+			if err != nil {
+				logger.Error("backup failed", "error", err)
+			} else {
+				logger.Info("backup complete")
+			}
+
+			results[i] = BackupResult{Name: target.Name, Plan: plan, Err: err}
+		}()
+	}
+	wg.Wait()
+
+	return results, nil
+}
@@ -0,0 +1,82 @@
+package bucket_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bradenrayhorn/pickle/bucket"
+	"github.com/bradenrayhorn/pickle/internal/memstorage"
+	"github.com/bradenrayhorn/pickle/internal/testutils/assert"
+	"github.com/bradenrayhorn/pickle/s3"
+)
+
+type failingStorage struct {
+	bucket.Storage
+}
+
+func (s *failingStorage) ListAllObjectVersions(prefix string) (*s3.ListAllObjectVersionsResult, error) {
+	return nil, errors.New("provider is down")
+}
+
+func TestBackupToMultipleTargets(t *testing.T) {
+	src := &countingStorage{Storage: memstorage.New()}
+	dstA := memstorage.New()
+	dstB := memstorage.New()
+
+	putBackupObject(t, src, "a.txt")
+	putBackupObject(t, src, "b.txt")
+
+	results, err := bucket.BackupToTargets(src, []bucket.BackupTarget{
+		{Name: "a", Storage: dstA},
+		{Name: "broken", Storage: &failingStorage{Storage: memstorage.New()}},
+		{Name: "b", Storage: dstB},
+	}, bucket.BackupOptions{})
+	assert.NoErr(t, err)
+
+	// each target reports its own result
+	assert.Equal(t, 3, len(results))
+	assert.Equal(t, "a", results[0].Name)
+	assert.NoErr(t, results[0].Err)
+	assert.Equal(t, 2, len(results[0].Plan.Uploads))
+	assert.Equal(t, "broken", results[1].Name)
+	assert.ErrContains(t, results[1].Err, "provider is down")
+	assert.Equal(t, "b", results[2].Name)
+	assert.NoErr(t, results[2].Err)
+
+	// the healthy targets are backed up
+	for _, dst := range []*memstorage.Storage{dstA, dstB} {
+		assert.Equal(t, 1, len(dst.GetVersions("a.txt")))
+		assert.Equal(t, 1, len(dst.GetVersions("b.txt")))
+	}
+
+	// source metadata is only read once
+	assert.Equal(t, 2, src.heads)
+
+	// a dry run changes nothing
+	putBackupObject(t, src, "c.txt")
+	results, err = bucket.PlanBackupToTargets(src, []bucket.BackupTarget{{Name: "a", Storage: dstA}}, bucket.BackupOptions{})
+	assert.NoErr(t, err)
+	assert.Equal(t, 1, len(results[0].Plan.Uploads))
+	assert.Equal(t, 0, len(dstA.GetVersions("c.txt")))
+}
+
+func TestBackupToMultipleTargetsReadsSourceOnce(t *testing.T) {
+	// slow enough that targets ask for the same version while it is being read
+	src := &countingStorage{Storage: memstorage.New(), delay: 20 * time.Millisecond}
+	putBackupObject(t, src, "a.txt")
+	putBackupObject(t, src, "b.txt")
+
+	targets := []bucket.BackupTarget{}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		targets = append(targets, bucket.BackupTarget{Name: name, Storage: memstorage.New()})
+	}
+
+	results, err := bucket.BackupToTargets(src, targets, bucket.BackupOptions{})
+	assert.NoErr(t, err)
+	for _, result := range results {
+		assert.NoErr(t, result.Err)
+		assert.Equal(t, 2, len(result.Plan.Uploads))
+	}
+	assert.Equal(t, 2, src.heads)
+}
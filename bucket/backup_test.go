@@ -3,15 +3,19 @@ package bucket_test
 import (
 	"bytes"
 	"encoding/hex"
+	"net/http"
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/bradenrayhorn/pickle/bucket"
 	fakes3 "github.com/bradenrayhorn/pickle/internal/fake_s3"
+	"github.com/bradenrayhorn/pickle/internal/memstorage"
 	"github.com/bradenrayhorn/pickle/internal/testutils/assert"
+	"github.com/bradenrayhorn/pickle/localfs"
 	"github.com/bradenrayhorn/pickle/s3"
 )
 
@@ -21,6 +25,7 @@ func TestBackups(t *testing.T) {
 	test.setObjectLockHours(3)
 
 	dstClient := s3.NewClient(test.backupS3Config)
+	options := bucket.BackupOptions{Delete: true, NowFunc: func() time.Time { return test.now }}
 
 	// create file to upload
 	filePath := path.Join(test.workingDir, "file.txt")
@@ -28,13 +33,13 @@ func TestBackups(t *testing.T) {
 	assert.NoErr(t, err)
 
 	// --- Setup files for scenario ---
-	err = test.bucket.UploadFile(filePath, "deleted/a.txt")
+	_, err = test.bucket.UploadFile(filePath, "deleted/a.txt")
 	assert.NoErr(t, err)
 
-	err = test.bucket.UploadFile(filePath, "active.txt")
+	_, err = test.bucket.UploadFile(filePath, "active.txt")
 	assert.NoErr(t, err)
 
-	err = test.bucket.UploadFile(filePath, "active-b.txt")
+	_, err = test.bucket.UploadFile(filePath, "active-b.txt")
 	assert.NoErr(t, err)
 
 	files, err := test.bucket.GetFiles()
@@ -63,7 +68,7 @@ func TestBackups(t *testing.T) {
 
 	// --- 2AM : first backup run ---
 	test.setNow(test.now.Add(1 * time.Hour))
-	assert.NoErr(t, bucket.BackupBucket(test.primaryS3Config, test.backupS3Config))
+	assert.NoErr(t, bucket.BackupBucket(test.client, dstClient, options))
 	// Expected files to be synced:
 	assertSynced(t, fileActive.Key, test.primaryS3, test.backupS3)
 	assertSynced(t, fileActiveB.Key, test.primaryS3, test.backupS3)
@@ -74,7 +79,7 @@ func TestBackups(t *testing.T) {
 
 	// --- more setup ---
 	// run maintenance - should extend object locks
-	assert.NoErr(t, test.bucket.RunMaintenance())
+	test.runMaintenance()
 	// create duplicate file in dst
 	_, err = dstClient.PutObject(fileActive.Key, bytes.NewReader(data), 8, crc32c, sha256, nil)
 	assert.NoErr(t, err)
@@ -88,7 +93,7 @@ func TestBackups(t *testing.T) {
 
 	// --- 3AM : second backup run ---
 	test.setNow(test.now.Add(1 * time.Hour))
-	assert.NoErr(t, bucket.BackupBucket(test.primaryS3Config, test.backupS3Config))
+	assert.NoErr(t, bucket.BackupBucket(test.client, dstClient, options))
 	// Expected files to be synced:
 	assertSynced(t, fileActive.Key, test.primaryS3, test.backupS3)
 	assertSynced(t, fileActiveB.Key, test.primaryS3, test.backupS3)
@@ -102,8 +107,8 @@ func TestBackups(t *testing.T) {
 
 	// --- 5AM : third backup run ---
 	test.setNow(test.now.Add(2 * time.Hour))
-	assert.NoErr(t, test.bucket.RunMaintenance()) // run maintenance in primary bucket
-	assert.NoErr(t, bucket.BackupBucket(test.primaryS3Config, test.backupS3Config))
+	test.runMaintenance() // run maintenance in primary bucket
+	assert.NoErr(t, bucket.BackupBucket(test.client, dstClient, options))
 	// Expected files to be synced:
 	assertSynced(t, fileActive.Key, test.primaryS3, test.backupS3)
 	assertSynced(t, fileActiveB.Key, test.primaryS3, test.backupS3)
@@ -113,8 +118,8 @@ func TestBackups(t *testing.T) {
 
 	// --- 7AM : fourth backup run ---
 	test.setNow(test.now.Add(2 * time.Hour))
-	assert.NoErr(t, test.bucket.RunMaintenance()) // run maintenance in primary bucket
-	assert.NoErr(t, bucket.BackupBucket(test.primaryS3Config, test.backupS3Config))
+	test.runMaintenance() // run maintenance in primary bucket
+	assert.NoErr(t, bucket.BackupBucket(test.client, dstClient, options))
 	// Expected files to be synced:
 	assertSynced(t, fileActive.Key, test.primaryS3, test.backupS3)
 	assertSynced(t, fileActiveB.Key, test.primaryS3, test.backupS3)
@@ -135,3 +140,390 @@ func assertSynced(t *testing.T, key string, from, to *fakes3.FakeS3) {
 	assert.Equal(t, src.Key, dst.Key)
 	assert.Equal(t, src.Checksum, dst.Checksum)
 }
+
+func TestBackupToMemoryStorage(t *testing.T) {
+	test := newTest(t)
+	test.setObjectLockHours(3)
+
+	dst := memstorage.New()
+	dst.SetNow(test.now)
+
+	// create file to upload
+	filePath := path.Join(test.workingDir, "file.txt")
+	err := os.WriteFile(filePath, []byte("abc"), 0600)
+	assert.NoErr(t, err)
+
+	upload, err := test.bucket.UploadFile(filePath, "a.txt")
+	assert.NoErr(t, err)
+
+	// back up into memory
+	assert.NoErr(t, bucket.BackupBucket(test.client, dst, bucket.BackupOptions{}))
+
+	src := test.primaryS3.GetVersions(upload.Key)
+	assert.Equal(t, 1, len(src))
+	copied := dst.GetVersions(upload.Key)
+	assert.Equal(t, 1, len(copied))
+	assert.Equal(t, hex.EncodeToString(src[0].Content), hex.EncodeToString(copied[0]))
+
+	srcMeta, err := test.client.HeadObject(upload.Key, "")
+	assert.NoErr(t, err)
+	dstMeta, err := dst.HeadObject(upload.Key, "")
+	assert.NoErr(t, err)
+	assert.Equal(t, srcMeta.PickleID, dstMeta.PickleID)
+	assert.Equal(t, srcMeta.PickleSHA256, dstMeta.PickleSHA256)
+	assert.Equal(t, srcMeta.ObjectLockRetainUntilDate, dstMeta.ObjectLockRetainUntilDate)
+
+	// and back again into an empty s3 bucket
+	assert.NoErr(t, bucket.BackupBucket(dst, s3.NewClient(test.backupS3Config), bucket.BackupOptions{}))
+	assertSynced(t, upload.Key, test.primaryS3, test.backupS3)
+}
+
+func TestBackupToLocalDirectory(t *testing.T) {
+	test := newTest(t)
+	test.setObjectLockHours(3)
+
+	dst, err := localfs.New(t.TempDir())
+	assert.NoErr(t, err)
+	dst.SetNow(test.now)
+
+	// create file to upload
+	filePath := path.Join(test.workingDir, "file.txt")
+	err = os.WriteFile(filePath, []byte("abc"), 0600)
+	assert.NoErr(t, err)
+
+	upload, err := test.bucket.UploadFile(filePath, "a.txt")
+	assert.NoErr(t, err)
+
+	// back up to disk
+	assert.NoErr(t, bucket.BackupBucket(test.client, dst, bucket.BackupOptions{}))
+
+	srcMeta, err := test.client.HeadObject(upload.Key, "")
+	assert.NoErr(t, err)
+	dstMeta, err := dst.HeadObject(upload.Key, "")
+	assert.NoErr(t, err)
+	assert.Equal(t, srcMeta.PickleID, dstMeta.PickleID)
+	assert.Equal(t, srcMeta.PickleSHA256, dstMeta.PickleSHA256)
+	assert.Equal(t, srcMeta.ObjectLockRetainUntilDate, dstMeta.ObjectLockRetainUntilDate)
+
+	// the local copy is locked too
+	res, err := dst.DeleteObjects([]s3.ObjectIdentifier{{Key: upload.Key, VersionID: dstMeta.VersionID}})
+	assert.NoErr(t, err)
+	assert.Equal(t, 1, len(res.Error))
+
+	// and back again into an empty s3 bucket
+	assert.NoErr(t, bucket.BackupBucket(dst, s3.NewClient(test.backupS3Config), bucket.BackupOptions{}))
+	assertSynced(t, upload.Key, test.primaryS3, test.backupS3)
+}
+
+func TestBackupDryRunReturnsPlan(t *testing.T) {
+	now := time.Date(2025, time.June, 20, 0, 0, 0, 0, time.UTC)
+	src := memstorage.New()
+	src.SetNow(now)
+	dst := memstorage.New()
+	dst.SetNow(now)
+
+	put := func(storage bucket.Storage, key string, retention *s3.ObjectLockRetention) string {
+		data := []byte(key)
+		crc32c, sha256 := fakes3.GetChecksums(data)
+		res, err := storage.PutObjectWithMetadata(key, bytes.NewReader(data), int64(len(data)), crc32c, sha256, retention, nil)
+		assert.NoErr(t, err)
+		return res.VersionID
+	}
+
+	options := bucket.BackupOptions{Delete: true, NowFunc: func() time.Time { return now }}
+
+	lock := &s3.ObjectLockRetention{Mode: "COMPLIANCE", Until: now.Add(time.Hour)}
+	put(src, "a.txt", lock)
+	bVersion := put(src, "b.txt", lock)
+	assert.NoErr(t, bucket.BackupBucket(src, dst, options))
+
+	// make some changes on both sides
+	put(src, "c.txt", nil)
+	assert.NoErr(t, src.PutObjectRetention("b.txt", bVersion, &s3.ObjectLockRetention{Mode: "COMPLIANCE", Until: now.Add(2 * time.Hour)}))
+	put(dst, "random.txt", nil)
+
+	plan, err := bucket.PlanBackup(src, dst, options)
+	assert.NoErr(t, err)
+
+	assert.Equal(t, 1, len(plan.Uploads))
+	assert.Equal(t, "c.txt", plan.Uploads[0].Key)
+	assert.Equal(t, 1, len(plan.Deletes))
+	assert.Equal(t, "random.txt", plan.Deletes[0].Key)
+	assert.Equal(t, 1, len(plan.LockExtensions))
+	assert.Equal(t, "b.txt", plan.LockExtensions[0].Key)
+	assert.Equal(t, "COMPLIANCE", plan.LockExtensions[0].Mode)
+	assert.Equal(t, now.Add(time.Hour), plan.LockExtensions[0].From)
+	assert.Equal(t, now.Add(2*time.Hour), plan.LockExtensions[0].Until)
+	assert.Equal(t, 0, len(plan.Duplicates))
+
+	// nothing was changed
+	assert.Equal(t, 0, len(dst.GetVersions("c.txt")))
+	assert.Equal(t, 1, len(dst.GetVersions("random.txt")))
+	meta, err := dst.HeadObject("b.txt", "")
+	assert.NoErr(t, err)
+	assert.Equal(t, now.Add(time.Hour), meta.ObjectLockRetainUntilDate)
+
+	// once applied, there is nothing left to do
+	assert.NoErr(t, bucket.BackupBucket(src, dst, options))
+	plan, err = bucket.PlanBackup(src, dst, options)
+	assert.NoErr(t, err)
+	assert.True(t, plan.IsEmpty())
+}
+
+func putBackupObject(t *testing.T, storage bucket.Storage, key string) {
+	data := []byte(key)
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	_, err := storage.PutObjectWithMetadata(key, bytes.NewReader(data), int64(len(data)), crc32c, sha256, nil, nil)
+	assert.NoErr(t, err)
+}
+
+func TestBackupIsAppendOnlyByDefault(t *testing.T) {
+	src := memstorage.New()
+	dst := memstorage.New()
+
+	putBackupObject(t, src, "a.txt")
+	putBackupObject(t, dst, "random.txt")
+	putBackupObject(t, dst, "random.txt")
+
+	plan, err := bucket.PlanBackup(src, dst, bucket.BackupOptions{})
+	assert.NoErr(t, err)
+	assert.Equal(t, 0, len(plan.Deletes))
+	assert.Equal(t, 0, len(plan.Duplicates))
+
+	assert.NoErr(t, bucket.BackupBucket(src, dst, bucket.BackupOptions{}))
+	assert.Equal(t, 1, len(dst.GetVersions("a.txt")))
+	assert.Equal(t, 2, len(dst.GetVersions("random.txt")))
+}
+
+func TestBackupRefusesTooManyDeletes(t *testing.T) {
+	src := memstorage.New()
+	dst := memstorage.New()
+
+	putBackupObject(t, src, "a.txt")
+	putBackupObject(t, dst, "b.txt")
+	putBackupObject(t, dst, "c.txt")
+	putBackupObject(t, dst, "d.txt")
+
+	// over the count limit
+	err := bucket.BackupBucket(src, dst, bucket.BackupOptions{Delete: true, MaxDeletes: 2})
+	assert.ErrContains(t, err, "refusing to delete 3 objects")
+
+	// over the percent limit
+	err = bucket.BackupBucket(src, dst, bucket.BackupOptions{Delete: true, MaxDeletePercent: 50})
+	assert.ErrContains(t, err, "refusing to delete 100.0% of the target")
+
+	// nothing was changed
+	assert.Equal(t, 0, len(dst.GetVersions("a.txt")))
+	assert.Equal(t, 1, len(dst.GetVersions("b.txt")))
+
+	// within the limits
+	assert.NoErr(t, bucket.BackupBucket(src, dst, bucket.BackupOptions{Delete: true, MaxDeletes: 3, MaxDeletePercent: 100}))
+	assert.Equal(t, 1, len(dst.GetVersions("a.txt")))
+	assert.Equal(t, 0, len(dst.GetVersions("b.txt")))
+}
+
+func TestBackupDelaysDeletes(t *testing.T) {
+	now := time.Date(2025, time.June, 20, 0, 0, 0, 0, time.UTC)
+	src := memstorage.New()
+	dst := memstorage.New()
+	options := bucket.BackupOptions{Delete: true, DeleteDelay: 48 * time.Hour, NowFunc: func() time.Time { return now }}
+
+	putBackupObject(t, src, "a.txt")
+	putBackupObject(t, src, "b.txt")
+	assert.NoErr(t, bucket.BackupBucket(src, dst, options))
+
+	// a misconfigured, empty src only marks files as pending
+	empty := memstorage.New()
+	now = now.Add(24 * time.Hour)
+	assert.NoErr(t, bucket.BackupBucket(empty, dst, options))
+	assert.Equal(t, 1, len(dst.GetVersions("a.txt")))
+	assert.Equal(t, 1, len(dst.GetVersions("b.txt")))
+	assert.Equal(t, 1, len(dst.GetVersions("_pickle/backup/pending-deletes")))
+
+	plan, err := bucket.PlanBackup(empty, dst, options)
+	assert.NoErr(t, err)
+	assert.Equal(t, 0, len(plan.Deletes))
+	assert.Equal(t, 2, len(plan.PendingDeletes))
+	assert.Equal(t, now, plan.PendingDeletes[0].MissingSince)
+	assert.Equal(t, now.Add(48*time.Hour), plan.PendingDeletes[0].DeleteAfter)
+	assert.Equal(t, 2, plan.TargetObjects)
+
+	// with the real src back, only a stays pending
+	_, err = src.DeleteObjects([]s3.ObjectIdentifier{{Key: "a.txt", VersionID: "0001"}})
+	assert.NoErr(t, err)
+	now = now.Add(24 * time.Hour)
+	assert.NoErr(t, bucket.BackupBucket(src, dst, options))
+	assert.Equal(t, 1, len(dst.GetVersions("a.txt")))
+
+	// a is deleted once the delay has passed, b is never touched
+	now = now.Add(24 * time.Hour)
+	assert.NoErr(t, bucket.BackupBucket(src, dst, options))
+	assert.Equal(t, 0, len(dst.GetVersions("a.txt")))
+	assert.Equal(t, 1, len(dst.GetVersions("b.txt")))
+
+	plan, err = bucket.PlanBackup(src, dst, options)
+	assert.NoErr(t, err)
+	assert.True(t, plan.IsEmpty())
+	assert.Equal(t, 0, len(plan.PendingDeletes))
+}
+
+type countingStorage struct {
+	bucket.Storage
+	delay time.Duration
+
+	mu    sync.Mutex
+	heads int
+}
+
+func (s *countingStorage) HeadObject(key string, versionID string) (*s3.ObjectMetadata, error) {
+	s.mu.Lock()
+	s.heads++
+	s.mu.Unlock()
+
+	time.Sleep(s.delay)
+	return s.Storage.HeadObject(key, versionID)
+}
+
+func TestBackupCachesMetadata(t *testing.T) {
+	now := time.Date(2025, time.June, 20, 0, 0, 0, 0, time.UTC)
+	srcStorage := memstorage.New()
+	srcStorage.SetNow(now)
+	src := &countingStorage{Storage: srcStorage}
+	dstStorage := memstorage.New()
+	dstStorage.SetNow(now)
+	dst := &countingStorage{Storage: dstStorage}
+	options := bucket.BackupOptions{NowFunc: func() time.Time { return now }}
+
+	data := []byte("abc")
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	for _, key := range []string{"a.txt", "b.txt"} {
+		_, err := srcStorage.PutObjectWithMetadata(key, bytes.NewReader(data), 3, crc32c, sha256, &s3.ObjectLockRetention{Mode: "COMPLIANCE", Until: now.Add(30 * 24 * time.Hour)}, nil)
+		assert.NoErr(t, err)
+	}
+
+	// first run reads the source
+	assert.NoErr(t, bucket.BackupBucket(src, dst, options))
+	assert.Equal(t, 2, src.heads)
+	assert.Equal(t, 0, dst.heads)
+
+	// second run only reads the newly copied versions in the target
+	assert.NoErr(t, bucket.BackupBucket(src, dst, options))
+	assert.Equal(t, 2, src.heads)
+	assert.Equal(t, 2, dst.heads)
+
+	// after that everything comes from the cache
+	assert.NoErr(t, bucket.BackupBucket(src, dst, options))
+	assert.Equal(t, 2, src.heads)
+	assert.Equal(t, 2, dst.heads)
+
+	// maintenance extends a lock in the source
+	assert.NoErr(t, srcStorage.PutObjectRetention("a.txt", "0001", &s3.ObjectLockRetention{Mode: "COMPLIANCE", Until: now.Add(60 * 24 * time.Hour)}))
+
+	// once the cached lock is close to expiring the source is read again
+	now = now.Add(25 * 24 * time.Hour)
+	assert.NoErr(t, bucket.BackupBucket(src, dst, options))
+	assert.Equal(t, 4, src.heads)
+	assert.Equal(t, 2, dst.heads)
+
+	meta, err := dstStorage.HeadObject("a.txt", "")
+	assert.NoErr(t, err)
+	assert.Equal(t, now.Add(35*24*time.Hour), meta.ObjectLockRetainUntilDate)
+
+	// and the extended lock is cached too
+	plan, err := bucket.PlanBackup(src, dst, options)
+	assert.NoErr(t, err)
+	assert.True(t, plan.IsEmpty())
+	assert.Equal(t, 5, src.heads)
+	assert.Equal(t, 2, dst.heads)
+
+	// a full scan reads everything
+	options.FullScan = true
+	plan, err = bucket.PlanBackup(src, dst, options)
+	assert.NoErr(t, err)
+	assert.True(t, plan.IsEmpty())
+	assert.Equal(t, 7, src.heads)
+	assert.Equal(t, 4, dst.heads)
+}
+
+func TestBackupCachesVersionsWithoutLock(t *testing.T) {
+	now := time.Date(2025, time.June, 20, 0, 0, 0, 0, time.UTC)
+	srcStorage := memstorage.New()
+	srcStorage.SetNow(now)
+	src := &countingStorage{Storage: srcStorage}
+	options := bucket.BackupOptions{NowFunc: func() time.Time { return now }}
+
+	data := []byte("abc")
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	_, err := srcStorage.PutObjectWithMetadata("a.txt", bytes.NewReader(data), 3, crc32c, sha256, nil, nil)
+	assert.NoErr(t, err)
+
+	dst := memstorage.New()
+	dst.SetNow(now)
+	assert.NoErr(t, bucket.BackupBucket(src, dst, options))
+	assert.NoErr(t, bucket.BackupBucket(src, dst, options))
+	assert.NoErr(t, bucket.BackupBucket(src, dst, options))
+	assert.Equal(t, 1, src.heads)
+}
+
+func TestBackupUsesServerSideCopyOnSameEndpoint(t *testing.T) {
+	test := newTest(t)
+	test.setObjectLockHours(3)
+	test.primaryS3.ServeBucket(test.backupS3)
+
+	sameEndpoint := test.backupS3Config
+	sameEndpoint.URL = test.primaryS3Config.URL
+	dstClient := s3.NewClient(sameEndpoint)
+
+	filePath := path.Join(test.workingDir, "file.txt")
+	err := os.WriteFile(filePath, []byte("abc"), 0600)
+	assert.NoErr(t, err)
+
+	upload, err := test.bucket.UploadFile(filePath, "a.txt")
+	assert.NoErr(t, err)
+
+	// count downloads and server-side copies
+	downloads, copies := 0, 0
+	test.primaryS3.SetInterceptor(func(r *http.Request, w http.ResponseWriter) bool {
+		if r.Method == http.MethodGet && !r.URL.Query().Has("versions") {
+			downloads++
+		}
+		if r.Header.Get("x-amz-copy-source") != "" {
+			copies++
+		}
+		return false
+	})
+
+	assert.NoErr(t, bucket.BackupBucket(test.client, dstClient, bucket.BackupOptions{}))
+	assertSynced(t, upload.Key, test.primaryS3, test.backupS3)
+	assertSynced(t, hexChecksumPath(upload.Key), test.primaryS3, test.backupS3)
+	assert.Equal(t, 0, downloads)
+	assert.Equal(t, 2, copies)
+}
+
+func TestBackupFallsBackToStreamingWhenCopyIsDenied(t *testing.T) {
+	test := newTest(t)
+	test.setObjectLockHours(3)
+	test.primaryS3.ServeBucket(test.backupS3)
+
+	sameEndpoint := test.backupS3Config
+	sameEndpoint.URL = test.primaryS3Config.URL
+	dstClient := s3.NewClient(sameEndpoint)
+
+	filePath := path.Join(test.workingDir, "file.txt")
+	err := os.WriteFile(filePath, []byte("abc"), 0600)
+	assert.NoErr(t, err)
+
+	upload, err := test.bucket.UploadFile(filePath, "a.txt")
+	assert.NoErr(t, err)
+
+	test.primaryS3.SetInterceptor(func(r *http.Request, w http.ResponseWriter) bool {
+		if r.Header.Get("x-amz-copy-source") != "" {
+			http.Error(w, "AccessDenied", http.StatusForbidden)
+			return true
+		}
+		return false
+	})
+
+	assert.NoErr(t, bucket.BackupBucket(test.client, dstClient, bucket.BackupOptions{}))
+	assertSynced(t, upload.Key, test.primaryS3, test.backupS3)
+}
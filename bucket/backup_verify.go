@@ -0,0 +1,193 @@
+package bucket
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bradenrayhorn/pickle/s3"
+)
+
+type VerifyOptions struct {
+	// RehashPercent is the share of objects, from 0 to 100, whose target content is downloaded
+	// and hashed again.
+	RehashPercent float64
+	// LockRefreshWindow should match the backup's. Backups only copy a source lock extension
+	// once the target's lock ends within this window, so until then a shorter target lock is not
+	// a mismatch. Defaults to seven days.
+	LockRefreshWindow time.Duration
+
+	NowFunc func() time.Time
+}
+
+func (o VerifyOptions) now() time.Time {
+	if o.NowFunc != nil {
+		return o.NowFunc()
+	}
+	return time.Now()
+}
+
+type VerifyReport struct {
+	Checked    int              `json:"checked"`
+	Rehashed   int              `json:"rehashed"`
+	Mismatches []VerifyMismatch `json:"mismatches"`
+}
+
+type VerifyMismatch struct {
+	Key       string `json:"key"`
+	VersionID string `json:"versionID"`
+	PickleID  string `json:"pickleID"`
+	Problem   string `json:"problem"`
+	Source    string `json:"source"`
+	Target    string `json:"target"`
+}
+
+const (
+	VerifyMissing = "missing"
+	VerifySHA256  = "sha256"
+	VerifySize    = "size"
+	VerifyLock    = "lock"
+	VerifyContent = "content"
+)
+
+type verifyObject struct {
+	meta *s3.ObjectMetadata
+	size uint64
+}
+
+// VerifyBackup checks that every object in source is in target with the same hash, size and a
+// lock that lasts at least as long, or past the refresh window. Locks that have already expired
+// are not copied by a backup and not checked.
+func VerifyBackup(source Storage, target Storage, options VerifyOptions) (*VerifyReport, error) {
+	if options.RehashPercent < 0 || options.RehashPercent > 100 {
+		return nil, fmt.Errorf("rehash percent must be between 0 and 100")
+	}
+
+	slog.Info("verifying pickle backup...")
+
+	srcObjects, srcOrder, err := getVerifyObjects(source)
+	if err != nil {
+		return nil, fmt.Errorf("get src objects: %w", err)
+	}
+
+	dstObjects, _, err := getVerifyObjects(target)
+	if err != nil {
+		return nil, fmt.Errorf("get dst objects: %w", err)
+	}
+
+	now := options.now()
+	refreshWindow := options.LockRefreshWindow
+	if refreshWindow == 0 {
+		refreshWindow = defaultLockRefreshWindow
+	}
+
+	report := &VerifyReport{Mismatches: []VerifyMismatch{}}
+	for _, pickleID := range srcOrder {
+		src := srcObjects[pickleID]
+		report.Checked++
+
+		mismatch := func(problem string, source string, target string) {
+			report.Mismatches = append(report.Mismatches, VerifyMismatch{
+				Key:       src.meta.Key,
+				VersionID: src.meta.VersionID,
+				PickleID:  pickleID,
+				Problem:   problem,
+				Source:    source,
+				Target:    target,
+			})
+		}
+
+		dst, ok := dstObjects[pickleID]
+		if !ok {
+			mismatch(VerifyMissing, src.meta.Key, "")
+			continue
+		}
+
+		if src.meta.PickleSHA256 != dst.meta.PickleSHA256 {
+			mismatch(VerifySHA256, src.meta.PickleSHA256, dst.meta.PickleSHA256)
+		}
+		if src.size != dst.size {
+			mismatch(VerifySize, fmt.Sprint(src.size), fmt.Sprint(dst.size))
+		}
+		srcLock, dstLock := src.meta.ObjectLockRetainUntilDate, dst.meta.ObjectLockRetainUntilDate
+		if srcLock.After(now) && dstLock.Before(srcLock) && dstLock.Before(now.Add(refreshWindow)) {
+			mismatch(VerifyLock, formatVerifyLock(srcLock), formatVerifyLock(dstLock))
+		}
+
+		if options.RehashPercent > 0 && rand.Float64()*100 < options.RehashPercent {
+			report.Rehashed++
+
+			sum, err := hashObject(target, dst.meta.Key, dst.meta.VersionID)
+			if err != nil {
+				return nil, fmt.Errorf("rehash %s: %w", dst.meta.Key, err)
+			}
+			if sum != src.meta.PickleSHA256 {
+				mismatch(VerifyContent, src.meta.PickleSHA256, sum)
+			}
+		}
+	}
+
+	slices.SortStableFunc(report.Mismatches, func(a, b VerifyMismatch) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	slog.Info(fmt.Sprintf("verified %d objects, found %d mismatches", report.Checked, len(report.Mismatches)))
+
+	return report, nil
+}
+
+// getVerifyObjects returns the oldest version of each pickle-id, along with the pickle-ids in
+// listing order.
+func getVerifyObjects(storage Storage) (map[string]verifyObject, []string, error) {
+	objects, err := storage.ListAllObjectVersions("")
+	if err != nil {
+		return nil, nil, fmt.Errorf("list objects: %w", err)
+	}
+
+	objects.Versions = slices.DeleteFunc(objects.Versions, isSkippedByBackup)
+	slices.Reverse(objects.Versions)
+
+	result := map[string]verifyObject{}
+	order := []string{}
+	for _, object := range objects.Versions {
+		meta, err := storage.HeadObject(object.Key, object.VersionId)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get meta %s: %w", object.Key, err)
+		}
+
+		if _, ok := result[meta.PickleID]; !ok {
+			result[meta.PickleID] = verifyObject{meta: meta, size: object.Size}
+			order = append(order, meta.PickleID)
+		}
+	}
+
+	return result, order, nil
+}
+
+func hashObject(storage Storage, key string, versionID string) (string, error) {
+	reader, err := storage.GetObject(key, versionID)
+	if err != nil {
+		return "", fmt.Errorf("get object: %w", err)
+	}
+	defer func() { _ = reader.Close() }()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", fmt.Errorf("read object: %w", err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func formatVerifyLock(t time.Time) string {
+	if t.IsZero() {
+		return "unlocked"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,132 @@
+package bucket_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/bradenrayhorn/pickle/bucket"
+	fakes3 "github.com/bradenrayhorn/pickle/internal/fake_s3"
+	"github.com/bradenrayhorn/pickle/internal/memstorage"
+	"github.com/bradenrayhorn/pickle/internal/testutils/assert"
+	"github.com/bradenrayhorn/pickle/s3"
+)
+
+func TestVerifyBackup(t *testing.T) {
+	now := time.Date(2025, time.June, 20, 0, 0, 0, 0, time.UTC)
+	src := memstorage.New()
+	src.SetNow(now)
+	dst := memstorage.New()
+	dst.SetNow(now)
+	clock := func() time.Time { return now }
+
+	lock := &s3.ObjectLockRetention{Mode: "COMPLIANCE", Until: now.Add(time.Hour)}
+	put := func(key string, retention *s3.ObjectLockRetention) string {
+		data := []byte(key)
+		crc32c, sha256 := fakes3.GetChecksums(data)
+		res, err := src.PutObjectWithMetadata(key, bytes.NewReader(data), int64(len(data)), crc32c, sha256, retention, nil)
+		assert.NoErr(t, err)
+		return res.VersionID
+	}
+
+	put("a.txt", nil)
+	bVersion := put("b.txt", lock)
+	assert.NoErr(t, bucket.BackupBucket(src, dst, bucket.BackupOptions{NowFunc: clock}))
+
+	// a good backup has no mismatches
+	report, err := bucket.VerifyBackup(src, dst, bucket.VerifyOptions{RehashPercent: 100, NowFunc: clock})
+	assert.NoErr(t, err)
+	assert.Equal(t, 2, report.Checked)
+	assert.Equal(t, 2, report.Rehashed)
+	assert.Equal(t, 0, len(report.Mismatches))
+
+	// replace the content of a.txt in dst, keeping its metadata
+	stream, err := dst.GetObjectStream("a.txt", "")
+	assert.NoErr(t, err)
+	versions, err := dst.ListAllObjectVersions("a.txt")
+	assert.NoErr(t, err)
+	_, err = dst.DeleteObjects([]s3.ObjectIdentifier{{Key: "a.txt", VersionID: versions.Versions[0].VersionId}})
+	assert.NoErr(t, err)
+	tampered := []byte("a.tx!")
+	crc32c, _ := fakes3.GetChecksums(tampered)
+	stream.Body = io.NopCloser(bytes.NewReader(tampered))
+	stream.ChecksumCRC32C = base64.StdEncoding.EncodeToString(crc32c)
+	assert.NoErr(t, dst.PutObjectStream("a.txt", stream))
+
+	// extend a lock in src, and add a file that is not backed up
+	assert.NoErr(t, src.PutObjectRetention("b.txt", bVersion, &s3.ObjectLockRetention{Mode: "COMPLIANCE", Until: now.Add(2 * time.Hour)}))
+	put("c.txt", nil)
+
+	// metadata checks do not see the tampered content
+	report, err = bucket.VerifyBackup(src, dst, bucket.VerifyOptions{NowFunc: clock})
+	assert.NoErr(t, err)
+	assert.Equal(t, 3, report.Checked)
+	assert.Equal(t, 0, report.Rehashed)
+	assert.Equal(t, 2, len(report.Mismatches))
+	assert.Equal(t, bucket.VerifyMismatch{
+		Key:       "b.txt",
+		VersionID: bVersion,
+		PickleID:  report.Mismatches[0].PickleID,
+		Problem:   bucket.VerifyLock,
+		Source:    now.Add(2 * time.Hour).Format(time.RFC3339),
+		Target:    now.Add(time.Hour).Format(time.RFC3339),
+	}, report.Mismatches[0])
+	assert.Equal(t, "c.txt", report.Mismatches[1].Key)
+	assert.Equal(t, bucket.VerifyMissing, report.Mismatches[1].Problem)
+
+	// a re-hash does
+	report, err = bucket.VerifyBackup(src, dst, bucket.VerifyOptions{RehashPercent: 100, NowFunc: clock})
+	assert.NoErr(t, err)
+	assert.Equal(t, 3, len(report.Mismatches))
+	assert.Equal(t, "a.txt", report.Mismatches[0].Key)
+	assert.Equal(t, bucket.VerifyContent, report.Mismatches[0].Problem)
+
+	// expired locks are not copied by a backup, so they are not checked either
+	report, err = bucket.VerifyBackup(src, dst, bucket.VerifyOptions{NowFunc: func() time.Time { return now.Add(3 * time.Hour) }})
+	assert.NoErr(t, err)
+	assert.Equal(t, 1, len(report.Mismatches))
+	assert.Equal(t, "c.txt", report.Mismatches[0].Key)
+}
+
+func TestVerifyBackupAllowsLocksWithinRefreshWindow(t *testing.T) {
+	now := time.Date(2025, time.June, 20, 0, 0, 0, 0, time.UTC)
+	src := memstorage.New()
+	src.SetNow(now)
+	dst := memstorage.New()
+	dst.SetNow(now)
+	clock := func() time.Time { return now }
+
+	data := []byte("abc")
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	version, err := src.PutObjectWithMetadata("a.txt", bytes.NewReader(data), 3, crc32c, sha256, &s3.ObjectLockRetention{Mode: "COMPLIANCE", Until: now.Add(30 * 24 * time.Hour)}, nil)
+	assert.NoErr(t, err)
+	assert.NoErr(t, bucket.BackupBucket(src, dst, bucket.BackupOptions{NowFunc: clock}))
+
+	// maintenance extends the lock in the source, the backup keeps the cached lock for now
+	assert.NoErr(t, src.PutObjectRetention("a.txt", version.VersionID, &s3.ObjectLockRetention{Mode: "COMPLIANCE", Until: now.Add(60 * 24 * time.Hour)}))
+	assert.NoErr(t, bucket.BackupBucket(src, dst, bucket.BackupOptions{NowFunc: clock}))
+
+	report, err := bucket.VerifyBackup(src, dst, bucket.VerifyOptions{NowFunc: clock})
+	assert.NoErr(t, err)
+	assert.Equal(t, 0, len(report.Mismatches))
+
+	// once the target lock ends within the window it should have been extended
+	now = now.Add(25 * 24 * time.Hour)
+	report, err = bucket.VerifyBackup(src, dst, bucket.VerifyOptions{NowFunc: clock})
+	assert.NoErr(t, err)
+	assert.Equal(t, 1, len(report.Mismatches))
+	assert.Equal(t, bucket.VerifyLock, report.Mismatches[0].Problem)
+
+	// which the next backup does
+	assert.NoErr(t, bucket.BackupBucket(src, dst, bucket.BackupOptions{NowFunc: clock}))
+	report, err = bucket.VerifyBackup(src, dst, bucket.VerifyOptions{NowFunc: clock})
+	assert.NoErr(t, err)
+	assert.Equal(t, 0, len(report.Mismatches))
+}
+
+func TestVerifyBackupRejectsBadRehashPercent(t *testing.T) {
+	_, err := bucket.VerifyBackup(memstorage.New(), memstorage.New(), bucket.VerifyOptions{RehashPercent: 101})
+	assert.ErrContains(t, err, "rehash percent")
+}
@@ -1,6 +1,7 @@
 package bucket
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -10,20 +11,31 @@ import (
 )
 
 type Bucket struct {
-	client          *s3.Client
+	storage         Storage
 	key             *age.X25519Identity
 	objectLockHours int
+	objectLockMode  string
 	now             func() time.Time
 
+	compression      string
+	compressionLevel int
+
 	cachedObjectVersions *s3.ListAllObjectVersionsResult
 	cachedDeletedFiles   *deletedFiles
+	cachedLegalHolds     *legalHolds
 }
 
 type Config struct {
-	Client          *s3.Client
+	Storage         Storage
 	Key             *age.X25519Identity
 	ObjectLockHours int
-	NowFunc         func() time.Time
+	// ObjectLockMode is s3.LockModeCompliance or s3.LockModeGovernance. Empty means compliance.
+	ObjectLockMode string
+	NowFunc        func() time.Time
+
+	// Compression is applied to file contents before encryption. Empty disables it.
+	Compression      string
+	CompressionLevel int
 }
 
 type BucketFile struct {
@@ -33,22 +45,61 @@ type BucketFile struct {
 	VersionID    string `json:"versionID"`
 	LastModified string `json:"lastModified"`
 	Size         string `json:"size"`
+	LegalHold    bool   `json:"legalHold"`
 }
 
 func New(config *Config) (*Bucket, error) {
-	if config.Client == nil {
+	if config.Storage == nil {
 		return nil, fmt.Errorf("connection is not configured")
 	}
 
+	if err := validateCompression(config.Compression, config.CompressionLevel); err != nil {
+		return nil, err
+	}
+
+	lockMode := config.ObjectLockMode
+	switch lockMode {
+	case "":
+		lockMode = s3.LockModeCompliance
+	case s3.LockModeCompliance, s3.LockModeGovernance:
+	default:
+		return nil, fmt.Errorf("unknown object lock mode %q", config.ObjectLockMode)
+	}
+
 	nowFunc := func() time.Time { return time.Now() }
 	if config.NowFunc != nil {
 		nowFunc = config.NowFunc
 	}
 
 	return &Bucket{
-		client:          config.Client,
+		storage:         config.Storage,
 		key:             config.Key,
 		objectLockHours: config.ObjectLockHours,
+		objectLockMode:  lockMode,
 		now:             nowFunc,
+
+		compression:      config.Compression,
+		compressionLevel: config.CompressionLevel,
 	}, nil
 }
+
+// lockRetention is the lock for files that are uploaded or kept now.
+func (b *Bucket) lockRetention() *s3.ObjectLockRetention {
+	return &s3.ObjectLockRetention{
+		Mode:  b.objectLockMode,
+		Until: b.now().Add(time.Hour * time.Duration(b.objectLockHours)),
+	}
+}
+
+// putRetention applies retention to a version. A version still locked in COMPLIANCE mode can't
+// be moved to GOVERNANCE, such as after the connection's mode was changed, so it stays in
+// COMPLIANCE.
+func (b *Bucket) putRetention(key string, versionID string, retention *s3.ObjectLockRetention) error {
+	err := b.storage.PutObjectRetention(key, versionID, retention)
+	if err != nil && retention.Mode == s3.LockModeGovernance && errors.Is(err, s3.ErrObjectLocked) {
+		compliance := *retention
+		compliance.Mode = s3.LockModeCompliance
+		return b.storage.PutObjectRetention(key, versionID, &compliance)
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package bucket
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bradenrayhorn/pickle/s3"
+)
+
+type inspector interface {
+	ListObjectVersions(prefix string, keyMarker string, versionIdMarker string, maxKeys int) (*s3.ListObjectVersionsResult, error)
+	GetBucketVersioning() (string, error)
+	GetObjectLockConfiguration() (*s3.ObjectLockConfiguration, error)
+}
+
+type CheckItem struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message"`
+}
+
+// Check contacts the storage to confirm that the bucket can be used and keeps files immutable:
+// the credentials work, versioning and object lock are enabled, and the lock period fits the
+// bucket's default retention. Problems are reported in the items, the error is only for storage
+// that can't be checked.
+func (b *Bucket) Check() ([]CheckItem, error) {
+	storage, ok := b.storage.(inspector)
+	if !ok {
+		return nil, fmt.Errorf("storage does not support checks")
+	}
+
+	items := []CheckItem{{Name: "Access"}, {Name: "Versioning"}, {Name: "Object lock"}, {Name: "Retention"}}
+	access, versioning, objectLock, retention := &items[0], &items[1], &items[2], &items[3]
+
+	if _, err := storage.ListObjectVersions("", "", "", 1); err != nil {
+		access.Message = fmt.Sprintf("Could not list the bucket, check the credentials: %v", err)
+		for _, item := range []*CheckItem{versioning, objectLock, retention} {
+			item.Message = "Not checked, the bucket can't be accessed."
+		}
+		return items, nil
+	}
+	access.OK, access.Message = true, "The credentials can access the bucket."
+
+	status, err := storage.GetBucketVersioning()
+	switch {
+	case err != nil:
+		versioning.Message = fmt.Sprintf("Could not read the versioning status: %v", err)
+	case status == s3.VersioningEnabled:
+		versioning.OK, versioning.Message = true, "Old versions of files are kept."
+	case status == s3.VersioningSuspended:
+		versioning.Message = "Versioning is suspended, files that are overwritten are lost."
+	default:
+		versioning.Message = "Versioning is not enabled, files that are overwritten are lost."
+	}
+
+	lockConfig, err := storage.GetObjectLockConfiguration()
+	switch {
+	case err != nil:
+		objectLock.Message = fmt.Sprintf("Could not read the object lock configuration: %v", err)
+		retention.Message = "Not checked, the object lock configuration is unknown."
+		return items, nil
+	case lockConfig.Enabled:
+		objectLock.OK, objectLock.Message = true, "Files can be locked against deletion."
+	default:
+		objectLock.Message = "Object lock is not enabled, files can be deleted or overwritten. It can only be enabled when the bucket is created."
+	}
+
+	lockPeriod := time.Duration(b.objectLockHours) * time.Hour
+	defaultRetention := lockConfig.DefaultRetention
+	switch {
+	case !lockConfig.Enabled:
+		retention.Message = "Files can't be locked without object lock."
+	case b.objectLockHours <= 0:
+		retention.Message = "The lock period is not set, files are not locked."
+	// Objects put without a lock, such as shared copies and pickle's own state, get the bucket's
+	// default retention. A default longer than the lock period keeps them around after pickle
+	// deletes them, a shorter one is harmless as files are locked explicitly.
+	case defaultRetention != nil && defaultRetention.Period() > lockPeriod:
+		retention.Message = fmt.Sprintf(
+			"The bucket's default retention of %s (%s) is longer than the lock period of %d hours. Objects pickle removes itself, such as shared files, stay until the default retention runs out.",
+			formatRetentionPeriod(*defaultRetention), defaultRetention.Mode, b.objectLockHours)
+	default:
+		retention.OK, retention.Message = true, fmt.Sprintf("Files are locked for %d hours.", b.objectLockHours)
+	}
+
+	return items, nil
+}
+
+func formatRetentionPeriod(retention s3.DefaultRetention) string {
+	count, unit := retention.Days, "day"
+	if retention.Years > 0 {
+		count, unit = retention.Years, "year"
+	}
+	if count != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s", count, unit)
+}
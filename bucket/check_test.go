@@ -0,0 +1,99 @@
+package bucket_test
+
+import (
+	"strings"
+	"testing"
+
+	fakes3 "github.com/bradenrayhorn/pickle/internal/fake_s3"
+	"github.com/bradenrayhorn/pickle/internal/testutils/assert"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name            string
+		setup           func(test *bucketTest)
+		objectLockHours int
+		ok              [4]bool
+		message         string
+	}{
+		{
+			name:            "everything is set up",
+			objectLockHours: 24,
+			ok:              [4]bool{true, true, true, true},
+			message:         "Files are locked for 24 hours.",
+		},
+		{
+			name:            "wrong credentials",
+			setup:           func(test *bucketTest) { test.primaryS3.SetCredentials("keyid", "other") },
+			objectLockHours: 24,
+			ok:              [4]bool{false, false, false, false},
+			message:         "SignatureDoesNotMatch",
+		},
+		{
+			name:            "versioning suspended",
+			setup:           func(test *bucketTest) { test.primaryS3.SetVersioning("Suspended") },
+			objectLockHours: 24,
+			ok:              [4]bool{true, false, true, true},
+			message:         "Versioning is suspended",
+		},
+		{
+			name:            "versioning never enabled",
+			setup:           func(test *bucketTest) { test.primaryS3.SetVersioning("") },
+			objectLockHours: 24,
+			ok:              [4]bool{true, false, true, true},
+			message:         "Versioning is not enabled",
+		},
+		{
+			name:            "object lock disabled",
+			setup:           func(test *bucketTest) { test.primaryS3.SetObjectLock(false, nil) },
+			objectLockHours: 24,
+			ok:              [4]bool{true, true, false, false},
+			message:         "Object lock is not enabled",
+		},
+		{
+			name:            "no lock period",
+			objectLockHours: 0,
+			ok:              [4]bool{true, true, true, false},
+			message:         "The lock period is not set",
+		},
+		{
+			name: "shorter default retention",
+			setup: func(test *bucketTest) {
+				test.primaryS3.SetObjectLock(true, &fakes3.DefaultRetention{Mode: "GOVERNANCE", Days: 1})
+			},
+			objectLockHours: 48,
+			ok:              [4]bool{true, true, true, true},
+			message:         "Files are locked for 48 hours.",
+		},
+		{
+			name: "longer default retention",
+			setup: func(test *bucketTest) {
+				test.primaryS3.SetObjectLock(true, &fakes3.DefaultRetention{Mode: "COMPLIANCE", Years: 1})
+			},
+			objectLockHours: 48,
+			ok:              [4]bool{true, true, true, false},
+			message:         "default retention of 1 year (COMPLIANCE) is longer than the lock period of 48 hours",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bt := newTest(t)
+			bt.setObjectLockHours(test.objectLockHours)
+			if test.setup != nil {
+				test.setup(bt)
+			}
+
+			items, err := bt.bucket.Check()
+			assert.NoErr(t, err)
+			assert.Equal(t, 4, len(items))
+
+			messages := ""
+			for i, item := range items {
+				assert.Equal(t, test.ok[i], item.OK)
+				messages += item.Message + "\n"
+			}
+			assert.True(t, strings.Contains(messages, test.message))
+		})
+	}
+}
@@ -19,3 +19,11 @@ func isDataFile(key string) bool {
 func isChecksumFile(key string) bool {
 	return strings.HasPrefix(key, "_pickle/checksum")
 }
+
+// splitDataKey returns the plaintext path and file ID embedded in a data file key.
+func splitDataKey(key string) (string, string) {
+	parts := strings.Split(key, ".")
+	id := parts[len(parts)-1]
+
+	return strings.TrimSuffix(key, ".age."+id), id
+}
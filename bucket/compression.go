@@ -0,0 +1,97 @@
+package bucket
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	CompressionNone = ""
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// File types that are already compressed and would not shrink any further.
+var compressedExtensions = []string{
+	".7z", ".aac", ".avi", ".br", ".bz2", ".docx", ".flac", ".gif", ".gz", ".heic", ".jpeg", ".jpg",
+	".lz4", ".m4a", ".mkv", ".mov", ".mp3", ".mp4", ".ogg", ".png", ".pptx", ".rar", ".tgz", ".webm",
+	".webp", ".xlsx", ".xz", ".zip", ".zst",
+}
+
+func validateCompression(compression string, level int) error {
+	switch compression {
+	case CompressionNone:
+		return nil
+	case CompressionGzip:
+		if level != 0 && (level < gzip.BestSpeed || level > gzip.BestCompression) {
+			return fmt.Errorf("gzip compression level must be between %d and %d", gzip.BestSpeed, gzip.BestCompression)
+		}
+		return nil
+	case CompressionZstd:
+		if level != 0 && (level < 1 || level > 22) {
+			return fmt.Errorf("zstd compression level must be between 1 and 22")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported compression: %s", compression)
+	}
+}
+
+// compressionFor picks the compression to use for a file at path.
+func (b *Bucket) compressionFor(path string) string {
+	if slices.Contains(compressedExtensions, strings.ToLower(filepath.Ext(path))) {
+		return CompressionNone
+	}
+
+	return b.compression
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func (b *Bucket) compressWriter(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+	case CompressionGzip:
+		level := b.compressionLevel
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	case CompressionZstd:
+		level := zstd.SpeedDefault
+		if b.compressionLevel != 0 {
+			level = zstd.EncoderLevelFromZstd(b.compressionLevel)
+		}
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(level))
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", compression)
+	}
+}
+
+func decompressReader(r io.Reader, compression string) (io.ReadCloser, error) {
+	switch compression {
+	case CompressionNone:
+		return io.NopCloser(r), nil
+	case CompressionGzip:
+		return gzip.NewReader(r)
+	case CompressionZstd:
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", compression)
+	}
+}
@@ -0,0 +1,123 @@
+package bucket
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/bradenrayhorn/pickle/s3"
+)
+
+// contentHMAC hashes the plaintext of a file with a key derived from the age identity, so
+// identical content can be detected without the hash revealing anything about the content.
+func (b *Bucket) contentHMAC(diskPath string) (string, error) {
+	key, err := b.deriveKey("content")
+	if err != nil {
+		return "", err
+	}
+
+	src, err := os.Open(diskPath)
+	if err != nil {
+		return "", fmt.Errorf("open file at %s: %w", diskPath, err)
+	}
+	defer func() { _ = src.Close() }()
+
+	mac := hmac.New(sha256.New, key)
+	if _, err := io.Copy(mac, src); err != nil {
+		return "", fmt.Errorf("hash %s: %w", diskPath, err)
+	}
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// findIdenticalFile returns the key of the newest file at path if it has the given content,
+// or an empty string otherwise.
+func (b *Bucket) findIdenticalFile(path string, contentHMAC string) (string, error) {
+	versions, err := b.storage.ListAllObjectVersions(path + ".age.")
+	if err != nil {
+		return "", fmt.Errorf("list versions at %s: %w", path, err)
+	}
+
+	// versions are sorted newest to oldest, find the oldest version of the newest file
+	var latest s3.VersionInfo
+	var latestID string
+	for _, version := range versions.Versions {
+		if !isDataFile(version.Key) {
+			continue
+		}
+
+		versionPath, id := splitDataKey(version.Key)
+		if versionPath != path {
+			continue
+		}
+
+		if id > latestID || version.Key == latest.Key {
+			latest = version
+			latestID = id
+		}
+	}
+
+	if latestID == "" {
+		return "", nil
+	}
+
+	deletedFiles, err := b.getDeletedFiles()
+	if err != nil {
+		return "", err
+	}
+	if deletedFiles.isDeleted(latest.Key) {
+		return "", nil
+	}
+
+	meta, err := b.storage.HeadObject(latest.Key, latest.VersionId)
+	if err != nil {
+		return "", fmt.Errorf("get meta %s: %w", latest.Key, err)
+	}
+
+	if !hmac.Equal([]byte(meta.PickleContentHMAC), []byte(contentHMAC)) {
+		return "", nil
+	}
+
+	return latest.Key, nil
+}
+
+// extendLock pushes the lock of a data file and its checksum file out to the retention date,
+// if it would otherwise expire sooner.
+func (b *Bucket) extendLock(key string, retention *s3.ObjectLockRetention) error {
+	for _, lockKey := range []string{key, getChecksumPath(key)} {
+		versions, err := b.storage.ListAllObjectVersions(lockKey)
+		if err != nil {
+			return fmt.Errorf("list versions at %s: %w", lockKey, err)
+		}
+
+		// versions are sorted newest to oldest
+		var versionID string
+		for _, version := range versions.Versions {
+			if version.Key == lockKey {
+				versionID = version.VersionId
+			}
+		}
+		if versionID == "" {
+			continue
+		}
+
+		meta, err := b.storage.HeadObject(lockKey, versionID)
+		if err != nil {
+			return fmt.Errorf("get meta %s: %w", lockKey, err)
+		}
+		if !meta.ObjectLockRetainUntilDate.Before(retention.Until) {
+			continue
+		}
+
+		slog.Info(fmt.Sprintf("extending retention for %s", lockKey), "versionID", versionID)
+		if err := b.putRetention(lockKey, versionID, retention); err != nil {
+			return fmt.Errorf("update retention %s: %w", lockKey, err)
+		}
+	}
+
+	return nil
+}
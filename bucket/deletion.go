@@ -1,17 +1,10 @@
 package bucket
 
 import (
-	"bufio"
-	"bytes"
-	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
-	"hash/crc32"
 	"slices"
 	"strings"
-	"time"
-
-	"github.com/bradenrayhorn/pickle/s3"
 )
 
 type deletedFiles struct {
@@ -59,43 +52,18 @@ func (b *Bucket) refreshDeletedFiles() error {
 		return err
 	}
 
-	var deletedFilesVersionID string
-	for _, version := range versions.Versions {
-		if version.Key == deletedFilesKey && version.IsLatest {
-			deletedFilesVersionID = version.VersionId
-			break
-		}
+	lines, err := readRegistry(b.storage, versions, deletedFilesKey)
+	if err != nil {
+		return fmt.Errorf("check deleted files: %w", err)
 	}
 
-	if deletedFilesVersionID == "" {
-		// there are no deleted files
-		b.cachedDeletedFiles = &deletedFiles{}
-		return nil
-	} else {
-		// fetch and parse
-		src, err := b.client.GetObject(deletedFilesKey, deletedFilesVersionID)
-		if err != nil {
-			return fmt.Errorf("check deleted files: %w", err)
-		}
-		defer func() { _ = src.Close() }()
-
-		scanner := bufio.NewScanner(src)
-		deleted := &deletedFiles{}
-
-		for scanner.Scan() {
-			line := strings.TrimSpace(scanner.Text())
-			if line != "" {
-				deleted.deserializeAndAddLine(line)
-			}
-		}
-
-		if err := scanner.Err(); err != nil {
-			return fmt.Errorf("parse deleted files: %w", err)
-		}
-
-		b.cachedDeletedFiles = deleted
-		return nil
+	deleted := &deletedFiles{}
+	for _, line := range lines {
+		deleted.deserializeAndAddLine(line)
 	}
+
+	b.cachedDeletedFiles = deleted
+	return nil
 }
 
 func (b *Bucket) getDeletedFiles() (*deletedFiles, error) {
@@ -110,6 +78,14 @@ func (b *Bucket) getDeletedFiles() (*deletedFiles, error) {
 }
 
 func (b *Bucket) DeleteFile(key string) error {
+	holds, err := b.getLegalHolds()
+	if err != nil {
+		return err
+	}
+	if holds.isHeld(key) {
+		return fmt.Errorf("%s is under legal hold", key)
+	}
+
 	deletedFiles, err := b.getDeletedFiles()
 	if err != nil {
 		return err
@@ -132,17 +108,14 @@ func (b *Bucket) RestoreFile(key string) error {
 		return fmt.Errorf("persist delete registry: %w", err)
 	}
 
-	retention := &s3.ObjectLockRetention{
-		Mode:  "COMPLIANCE",
-		Until: b.now().Add(time.Hour * time.Duration(b.objectLockHours)),
-	}
+	retention := b.lockRetention()
 
 	versionID, err := b.getObjectVersionForKey(key)
 	if err != nil {
 		return err
 	}
 
-	if err := b.client.PutObjectRetention(key, versionID, retention); err != nil {
+	if err := b.putRetention(key, versionID, retention); err != nil {
 		return fmt.Errorf("update retention %s: %w", key, err)
 	}
 	return nil
@@ -154,40 +127,10 @@ func (b *Bucket) persistDeleteRegistry() error {
 		return err
 	}
 
-	// upload new deleted registry
-	serialized := []byte(deletedFiles.serialize())
-	checksum := crc32.New(crc32.MakeTable(crc32.Castagnoli))
-	_, err = checksum.Write(serialized)
-	if err != nil {
-		return fmt.Errorf("write crc32 sum: %w", err)
-	}
-
-	sha256Checksum := sha256.Sum256(serialized)
-
-	deleteResponse, err := b.client.PutObject(deletedFilesKey, bytes.NewReader(serialized), int64(len(serialized)), checksum.Sum(nil), sha256Checksum[:], nil)
-	if err != nil {
-		return err
-	}
-
-	// delete old deleted registries
 	versions, err := b.getObjectVersions()
 	if err != nil {
 		return err
 	}
 
-	toDelete := []s3.ObjectIdentifier{}
-	for _, version := range versions.Versions {
-		if version.Key == deletedFilesKey && version.VersionId != deleteResponse.VersionID {
-			toDelete = append(toDelete, s3.ObjectIdentifier{Key: version.Key, VersionID: version.VersionId})
-		}
-	}
-
-	if len(toDelete) > 0 {
-		_, err = b.client.DeleteObjects(toDelete)
-		if err != nil {
-			return fmt.Errorf("delete objects: %w", err)
-		}
-	}
-
-	return nil
+	return writeRegistry(b.storage, versions, deletedFilesKey, []byte(deletedFiles.serialize()))
 }
@@ -17,7 +17,7 @@ func TestCanDeleteAndRestoreFile(t *testing.T) {
 	assert.NoErr(t, err)
 
 	// upload a file
-	err = test.bucket.UploadFile(filePath, "here.txt")
+	_, err = test.bucket.UploadFile(filePath, "here.txt")
 	assert.NoErr(t, err)
 
 	// delete it
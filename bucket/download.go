@@ -23,6 +23,11 @@ func (b *Bucket) DownloadFile(bucketKey string, diskPath string) error {
 		return err
 	}
 
+	meta, err := b.storage.HeadObject(bucketKey, verisonID)
+	if err != nil {
+		return fmt.Errorf("get meta %s: %w", bucketKey, err)
+	}
+
 	// create working dir
 	workingDir, err := os.MkdirTemp("", "pickle-*")
 	if err != nil {
@@ -38,7 +43,7 @@ func (b *Bucket) DownloadFile(bucketKey string, diskPath string) error {
 	}
 	defer func() { _ = downloadFile.Close() }()
 
-	objectReader, err := b.client.GetObject(bucketKey, verisonID)
+	objectReader, err := b.storage.GetObject(bucketKey, verisonID)
 	defer func() {
 		if objectReader != nil {
 			_ = objectReader.Close()
@@ -63,7 +68,7 @@ func (b *Bucket) DownloadFile(bucketKey string, diskPath string) error {
 	}
 
 	// compute SHA checksum if it exists
-	sumSrc, err := b.client.GetObject(getChecksumPath(bucketKey), "")
+	sumSrc, err := b.storage.GetObject(getChecksumPath(bucketKey), "")
 	if err == nil {
 		defer func() { _ = sumSrc.Close() }()
 		expectedSum, err := io.ReadAll(sumSrc)
@@ -103,7 +108,13 @@ func (b *Bucket) DownloadFile(bucketKey string, diskPath string) error {
 		return fmt.Errorf("decrypt %s: %w", bucketKey, err)
 	}
 
-	_, err = io.Copy(targetFile, decryptedReader)
+	decompressedReader, err := decompressReader(decryptedReader, meta.PickleCompression)
+	if err != nil {
+		return fmt.Errorf("decompress %s: %w", bucketKey, err)
+	}
+	defer func() { _ = decompressedReader.Close() }()
+
+	_, err = io.Copy(targetFile, decompressedReader)
 	if err != nil {
 		return fmt.Errorf("copy %s to %s: %w", downloadPath, diskPath, err)
 	}
@@ -0,0 +1,124 @@
+package bucket
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bradenrayhorn/pickle/s3"
+)
+
+// governanceBypasser can override GOVERNANCE locks. It is only meant for administrators, the
+// credentials need the s3:BypassGovernanceRetention permission.
+type governanceBypasser interface {
+	PutObjectRetentionBypassingGovernance(key string, versionID string, retention *s3.ObjectLockRetention) error
+	DeleteObjectsBypassingGovernance(objects []s3.ObjectIdentifier) (*s3.DeleteObjectsResult, error)
+}
+
+// PurgeFile permanently deletes a file in the trash now, instead of when its lock runs out. Only
+// GOVERNANCE locks can be bypassed, files locked in COMPLIANCE mode stay.
+func (b *Bucket) PurgeFile(key string) error {
+	storage, ok := b.storage.(governanceBypasser)
+	if !ok {
+		return fmt.Errorf("storage does not support bypassing governance retention")
+	}
+
+	deletedFiles, err := b.getDeletedFiles()
+	if err != nil {
+		return err
+	}
+	if !deletedFiles.isDeleted(key) {
+		return fmt.Errorf("%s is not in the trash", key)
+	}
+
+	holds, err := b.getLegalHolds()
+	if err != nil {
+		return err
+	}
+	if holds.isHeld(key) {
+		return fmt.Errorf("%s is under legal hold", key)
+	}
+
+	versions, err := b.getObjectVersions()
+	if err != nil {
+		return err
+	}
+
+	toDelete := []s3.ObjectIdentifier{}
+	checksumPath := getChecksumPath(key)
+	for _, version := range versions.Versions {
+		if version.Key == key || version.Key == checksumPath {
+			slog.Info(fmt.Sprintf("purging %s", version.Key), "versionID", version.VersionId)
+			toDelete = append(toDelete, s3.ObjectIdentifier{Key: version.Key, VersionID: version.VersionId})
+		}
+	}
+
+	result, err := storage.DeleteObjectsBypassingGovernance(toDelete)
+	if err != nil {
+		return fmt.Errorf("purge %s: %w", key, err)
+	}
+	if len(result.Error) > 0 {
+		errs := []error{}
+		for _, failed := range result.Error {
+			errs = append(errs, fmt.Errorf("purge %s %s: %s", failed.Key, failed.VersionID, failed.Message))
+		}
+		return errors.Join(errs...)
+	}
+
+	deletedFiles.remove(key)
+	if err := b.persistDeleteRegistry(); err != nil {
+		return fmt.Errorf("persist delete registry: %w", err)
+	}
+	return nil
+}
+
+// ShortenRetention brings every lock that runs past the configured lock period back to it, for
+// when the period was set too long. Only GOVERNANCE locks can be shortened.
+func (b *Bucket) ShortenRetention() error {
+	storage, ok := b.storage.(governanceBypasser)
+	if !ok {
+		return fmt.Errorf("storage does not support bypassing governance retention")
+	}
+	if b.objectLockHours <= 0 {
+		return fmt.Errorf("lock period is not set")
+	}
+
+	versions, err := b.getObjectVersions()
+	if err != nil {
+		return err
+	}
+
+	retention := b.lockRetention()
+	errs := []error{}
+	for _, version := range versions.Versions {
+		if !isDataFile(version.Key) && !isChecksumFile(version.Key) {
+			continue
+		}
+
+		meta, err := b.storage.HeadObject(version.Key, version.VersionId)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("get lock %s: %w", version.Key, err))
+			continue
+		}
+		if !meta.ObjectLockRetainUntilDate.After(retention.Until) {
+			continue
+		}
+		if meta.ObjectLockMode == s3.LockModeCompliance {
+			errs = append(errs, fmt.Errorf("%s is locked in compliance mode until %s", version.Key, meta.ObjectLockRetainUntilDate.Format(time.RFC3339)))
+			continue
+		}
+
+		slog.Info(fmt.Sprintf("shortening retention for %s", version.Key), "versionID", version.VersionId, "from", meta.ObjectLockRetainUntilDate)
+		if err := storage.PutObjectRetentionBypassingGovernance(version.Key, version.VersionId, retention); err != nil {
+			errs = append(errs, fmt.Errorf("set retention %s: %w", version.Key, err))
+		}
+	}
+
+	// the cached locks may now be too long, which would stop maintenance from extending them
+	if err := b.dropLockCache(); err != nil {
+		errs = append(errs, fmt.Errorf("drop cached locks: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
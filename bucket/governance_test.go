@@ -0,0 +1,171 @@
+package bucket_test
+
+import (
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bradenrayhorn/pickle/bucket"
+	"github.com/bradenrayhorn/pickle/internal/testutils/assert"
+)
+
+func TestObjectLockMode(t *testing.T) {
+	test := newTest(t)
+	test.setObjectLockHours(5)
+
+	filePath := path.Join(test.workingDir, "file.txt")
+	assert.NoErr(t, os.WriteFile(filePath, []byte("abc"), 0600))
+
+	// compliance is the default
+	_, err := test.bucket.UploadFile(filePath, "compliance.txt")
+	assert.NoErr(t, err)
+	assert.Equal(t, "COMPLIANCE", test.primaryS3.GetByVersionID(test.primaryS3.GetVersionIDByFuzzyKey("compliance.txt")).Retention.Mode)
+
+	test.setObjectLockMode("GOVERNANCE")
+	_, err = test.bucket.UploadFile(filePath, "governance.txt")
+	assert.NoErr(t, err)
+	assert.Equal(t, "GOVERNANCE", test.primaryS3.GetByVersionID(test.primaryS3.GetVersionIDByFuzzyKey("governance.txt")).Retention.Mode)
+
+	// maintenance uses the configured mode, but can't weaken existing compliance locks
+	test.setNow(test.now.Add(time.Hour))
+	test.runMaintenance()
+	governanceChecksumID := test.primaryS3.GetVersionIDByFuzzyKey(hex.EncodeToString([]byte("governance.txt")))
+	governanceChecksum := test.primaryS3.GetByVersionID(governanceChecksumID)
+	assert.Equal(t, "GOVERNANCE", governanceChecksum.Retention.Mode)
+	assert.Equal(t, test.now.Add(5*time.Hour).Truncate(time.Second), governanceChecksum.Retention.Until)
+	compliance := test.primaryS3.GetByVersionID(test.primaryS3.GetVersionIDByFuzzyKey("compliance.txt"))
+	assert.Equal(t, "COMPLIANCE", compliance.Retention.Mode)
+	assert.Equal(t, test.now.Add(5*time.Hour).Truncate(time.Second), compliance.Retention.Until)
+}
+
+func TestObjectLockModeOnlyFallsBackForLocks(t *testing.T) {
+	test := newTest(t)
+	test.setObjectLockHours(5)
+	test.setObjectLockMode("GOVERNANCE")
+
+	filePath := path.Join(test.workingDir, "file.txt")
+	assert.NoErr(t, os.WriteFile(filePath, []byte("abc"), 0600))
+	_, err := test.bucket.UploadFile(filePath, "governance.txt")
+	assert.NoErr(t, err)
+
+	// missing permissions are not retried in compliance mode
+	var compliance atomic.Int32
+	test.primaryS3.SetInterceptor(func(r *http.Request, w http.ResponseWriter) bool {
+		if !r.URL.Query().Has("retention") {
+			return false
+		}
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "COMPLIANCE") {
+			compliance.Add(1)
+		}
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte("<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>"))
+		return true
+	})
+
+	test.setNow(test.now.Add(time.Hour))
+	_, err = test.bucket.RunMaintenance(bucket.MaintenanceOptions{})
+	assert.ErrContains(t, err, "AccessDenied")
+	assert.Equal(t, int32(0), compliance.Load())
+}
+
+func TestObjectLockModeMustBeKnown(t *testing.T) {
+	test := newTest(t)
+
+	_, err := bucket.New(&bucket.Config{Storage: test.client, ObjectLockMode: "FOREVER"})
+	assert.ErrContains(t, err, `unknown object lock mode "FOREVER"`)
+}
+
+func TestPurgeFile(t *testing.T) {
+	test := newTest(t)
+	test.setObjectLockHours(5)
+	test.setObjectLockMode("GOVERNANCE")
+
+	filePath := path.Join(test.workingDir, "file.txt")
+	assert.NoErr(t, os.WriteFile(filePath, []byte("abc"), 0600))
+	result, err := test.bucket.UploadFile(filePath, "purge.txt")
+	assert.NoErr(t, err)
+
+	// only files in the trash can be purged
+	err = test.bucket.PurgeFile(result.Key)
+	assert.ErrContains(t, err, "is not in the trash")
+
+	assert.NoErr(t, test.bucket.DeleteFile(result.Key))
+	assert.NoErr(t, test.bucket.PurgeFile(result.Key))
+
+	// gone right away, not when the lock runs out
+	assert.Equal(t, 0, len(test.primaryS3.GetVersions(result.Key)))
+	assert.Equal(t, 0, len(test.primaryS3.GetVersions("_pickle/checksum/"+hex.EncodeToString([]byte(result.Key))+".sha256")))
+
+	files, err := test.bucket.GetTrashedFiles()
+	assert.NoErr(t, err)
+	assert.Equal(t, 0, len(files))
+}
+
+func TestPurgeFileKeepsComplianceLocks(t *testing.T) {
+	test := newTest(t)
+	test.setObjectLockHours(5)
+
+	filePath := path.Join(test.workingDir, "file.txt")
+	assert.NoErr(t, os.WriteFile(filePath, []byte("abc"), 0600))
+	result, err := test.bucket.UploadFile(filePath, "purge.txt")
+	assert.NoErr(t, err)
+
+	assert.NoErr(t, test.bucket.DeleteFile(result.Key))
+	err = test.bucket.PurgeFile(result.Key)
+	assert.ErrContains(t, err, "protected by object lock")
+
+	// still in the trash
+	assert.Equal(t, 1, len(test.primaryS3.GetVersions(result.Key)))
+	files, err := test.bucket.GetTrashedFiles()
+	assert.NoErr(t, err)
+	assert.Equal(t, 1, len(files))
+}
+
+func TestShortenRetention(t *testing.T) {
+	test := newTest(t)
+	test.setNow(time.Date(2025, time.June, 20, 0, 0, 0, 0, time.UTC))
+
+	filePath := path.Join(test.workingDir, "file.txt")
+	assert.NoErr(t, os.WriteFile(filePath, []byte("abc"), 0600))
+
+	// a year long lock by mistake
+	test.setObjectLockHours(24 * 365)
+	test.setObjectLockMode("GOVERNANCE")
+	_, err := test.bucket.UploadFile(filePath, "governance.txt")
+	assert.NoErr(t, err)
+
+	// maintenance remembers the year long lock
+	_, err = test.bucket.RunMaintenance(bucket.MaintenanceOptions{RenewalWindow: time.Hour})
+	assert.NoErr(t, err)
+	assert.Equal(t, 1, len(test.primaryS3.GetVersions("_pickle/locks")))
+
+	test.setObjectLockMode("COMPLIANCE")
+	_, err = test.bucket.UploadFile(filePath, "compliance.txt")
+	assert.NoErr(t, err)
+
+	// fixed to five hours
+	test.setObjectLockHours(5)
+	test.setObjectLockMode("GOVERNANCE")
+	err = test.bucket.ShortenRetention()
+	assert.ErrContains(t, err, "compliance.txt")
+	assert.ErrContains(t, err, "is locked in compliance mode")
+
+	time5AM := time.Date(2025, time.June, 20, 5, 0, 0, 0, time.UTC)
+	governanceID := test.primaryS3.GetVersionIDByFuzzyKey("governance.txt")
+	governanceChecksumID := test.primaryS3.GetVersionIDByFuzzyKey(hex.EncodeToString([]byte("governance.txt")))
+	assert.Equal(t, time5AM, test.primaryS3.GetByVersionID(governanceID).Retention.Until)
+	assert.Equal(t, time5AM, test.primaryS3.GetByVersionID(governanceChecksumID).Retention.Until)
+
+	complianceID := test.primaryS3.GetVersionIDByFuzzyKey("compliance.txt")
+	assert.Equal(t, test.now.Add(24*365*time.Hour), test.primaryS3.GetByVersionID(complianceID).Retention.Until)
+
+	// so maintenance doesn't skip the shortened locks
+	assert.Equal(t, 0, len(test.primaryS3.GetVersions("_pickle/locks")))
+}
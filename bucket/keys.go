@@ -0,0 +1,17 @@
+package bucket
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"fmt"
+)
+
+// deriveKey derives a secret for the given purpose from the age identity, so
+// that a single connection string is enough to recreate it.
+func (b *Bucket) deriveKey(purpose string) ([]byte, error) {
+	if b.key == nil {
+		return nil, fmt.Errorf("key is not configured")
+	}
+
+	return hkdf.Key(sha256.New, []byte(b.key.String()), nil, "pickle "+purpose, 32)
+}
@@ -0,0 +1,146 @@
+package bucket
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+type legalHolder interface {
+	PutObjectLegalHold(key string, versionID string, on bool) error
+	GetObjectLegalHold(key string, versionID string) (bool, error)
+}
+
+// legalHolds records which data keys pickle has put under legal hold, so the hold can be shown
+// without asking the storage about every file. The storage stays the authority for deletions.
+type legalHolds struct {
+	keys []string
+}
+
+func (lh *legalHolds) isHeld(key string) bool {
+	return slices.Contains(lh.keys, key)
+}
+
+func (lh *legalHolds) hold(key string) {
+	if !lh.isHeld(key) {
+		lh.keys = append(lh.keys, key)
+	}
+}
+
+func (lh *legalHolds) release(key string) {
+	lh.keys = slices.DeleteFunc(lh.keys, func(k string) bool {
+		return k == key
+	})
+}
+
+func (lh *legalHolds) serialize() string {
+	lines := []string{}
+	for _, key := range lh.keys {
+		lines = append(lines, base64.RawStdEncoding.EncodeToString([]byte(key)))
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+var (
+	legalHoldsKey = "_pickle/holds"
+)
+
+func (b *Bucket) getLegalHolds() (*legalHolds, error) {
+	if b.cachedLegalHolds != nil {
+		return b.cachedLegalHolds, nil
+	}
+
+	versions, err := b.getObjectVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := readRegistry(b.storage, versions, legalHoldsKey)
+	if err != nil {
+		return nil, fmt.Errorf("check legal holds: %w", err)
+	}
+
+	holds := &legalHolds{}
+	for _, line := range lines {
+		key, err := base64.RawStdEncoding.DecodeString(line)
+		if err == nil {
+			holds.hold(string(key))
+		}
+	}
+
+	b.cachedLegalHolds = holds
+	return holds, nil
+}
+
+// SetLegalHold puts every version of the file at path, and its checksums, under legal hold or
+// releases them. Held files are kept regardless of the object lock period until released.
+func (b *Bucket) SetLegalHold(path string, on bool) error {
+	storage, ok := b.storage.(legalHolder)
+	if !ok {
+		return fmt.Errorf("storage does not support legal holds")
+	}
+
+	versions, err := b.getObjectVersions()
+	if err != nil {
+		return err
+	}
+
+	holds, err := b.getLegalHolds()
+	if err != nil {
+		return err
+	}
+
+	keys := []string{}
+	for _, version := range versions.Versions {
+		if !isDataFile(version.Key) {
+			continue
+		}
+		if filePath, _ := splitDataKey(version.Key); filePath == path && !slices.Contains(keys, version.Key) {
+			keys = append(keys, version.Key)
+		}
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no files at %s", path)
+	}
+
+	for _, key := range keys {
+		checksumPath := getChecksumPath(key)
+		for _, version := range versions.Versions {
+			if version.Key != key && version.Key != checksumPath {
+				continue
+			}
+
+			slog.Info(fmt.Sprintf("setting legal hold on %s", version.Key), "versionID", version.VersionId, "on", on)
+			if err := storage.PutObjectLegalHold(version.Key, version.VersionId, on); err != nil {
+				return fmt.Errorf("set legal hold %s: %w", version.Key, err)
+			}
+		}
+
+		if on {
+			holds.hold(key)
+		} else {
+			holds.release(key)
+		}
+	}
+
+	if err := writeRegistry(b.storage, versions, legalHoldsKey, []byte(holds.serialize())); err != nil {
+		return fmt.Errorf("persist legal holds: %w", err)
+	}
+	return nil
+}
+
+// isLegallyHeld reports whether an object version is under legal hold. The storage is asked too,
+// so holds placed outside of pickle are respected.
+func (b *Bucket) isLegallyHeld(holds *legalHolds, key string, versionID string) (bool, error) {
+	if holds.isHeld(key) {
+		return true, nil
+	}
+
+	storage, ok := b.storage.(legalHolder)
+	if !ok {
+		return false, nil
+	}
+	return storage.GetObjectLegalHold(key, versionID)
+}
@@ -0,0 +1,129 @@
+package bucket_test
+
+import (
+	"encoding/hex"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/bradenrayhorn/pickle/bucket"
+	"github.com/bradenrayhorn/pickle/internal/memstorage"
+	"github.com/bradenrayhorn/pickle/internal/testutils/assert"
+)
+
+func TestLegalHold(t *testing.T) {
+	test := newTest(t)
+	test.setNow(time.Date(2025, time.June, 20, 0, 0, 0, 0, time.UTC))
+	test.setObjectLockHours(5)
+
+	filePath := path.Join(test.workingDir, "file.txt")
+	assert.NoErr(t, os.WriteFile(filePath, []byte("abc"), 0600))
+	_, err := test.bucket.UploadFile(filePath, "held.txt")
+	assert.NoErr(t, err)
+	_, err = test.bucket.UploadFile(filePath, "other.txt")
+	assert.NoErr(t, err)
+
+	// put the file on hold
+	assert.NoErr(t, test.bucket.SetLegalHold("held.txt", true))
+
+	files, err := test.bucket.GetFiles()
+	assert.NoErr(t, err)
+	assert.Equal(t, 2, len(files))
+	held, other := files[0], files[1]
+	assert.Equal(t, "held.txt", held.Path)
+	assert.True(t, held.LegalHold)
+	assert.True(t, !other.LegalHold)
+
+	// the data and checksum are held in the storage
+	heldID := test.primaryS3.GetVersionIDByFuzzyKey("held.txt")
+	heldChecksumID := test.primaryS3.GetVersionIDByFuzzyKey(hex.EncodeToString([]byte("held.txt")))
+	assert.True(t, test.primaryS3.GetByVersionID(heldID).LegalHold)
+	assert.True(t, test.primaryS3.GetByVersionID(heldChecksumID).LegalHold)
+
+	// held files can't be deleted
+	err = test.bucket.DeleteFile(held.Key)
+	assert.ErrContains(t, err, "under legal hold")
+
+	// the hold is read back by a new connection
+	test.regenerateBucket()
+	files, err = test.bucket.GetFiles()
+	assert.NoErr(t, err)
+	assert.True(t, files[0].LegalHold)
+
+	// release it
+	assert.NoErr(t, test.bucket.SetLegalHold("held.txt", false))
+	assert.True(t, !test.primaryS3.GetByVersionID(heldID).LegalHold)
+	assert.True(t, !test.primaryS3.GetByVersionID(heldChecksumID).LegalHold)
+
+	files, err = test.bucket.GetFiles()
+	assert.NoErr(t, err)
+	assert.True(t, !files[0].LegalHold)
+	assert.NoErr(t, test.bucket.DeleteFile(held.Key))
+}
+
+func TestLegalHoldRequiresFiles(t *testing.T) {
+	test := newTest(t)
+
+	err := test.bucket.SetLegalHold("nothing.txt", true)
+	assert.ErrContains(t, err, "no files at nothing.txt")
+}
+
+func TestLegalHoldRequiresSupport(t *testing.T) {
+	b, err := bucket.New(&bucket.Config{Storage: memstorage.New()})
+	assert.NoErr(t, err)
+
+	err = b.SetLegalHold("file.txt", true)
+	assert.ErrContains(t, err, "storage does not support legal holds")
+}
+
+func TestMaintenanceKeepsHeldFiles(t *testing.T) {
+	test := newTest(t)
+	test.setNow(time.Date(2025, time.June, 20, 0, 0, 0, 0, time.UTC))
+	test.setObjectLockHours(5)
+
+	filePath := path.Join(test.workingDir, "file.txt")
+	assert.NoErr(t, os.WriteFile(filePath, []byte("abc"), 0600))
+	_, err := test.bucket.UploadFile(filePath, "held.txt")
+	assert.NoErr(t, err)
+	_, err = test.bucket.UploadFile(filePath, "held-elsewhere.txt")
+	assert.NoErr(t, err)
+
+	files, err := test.bucket.GetFiles()
+	assert.NoErr(t, err)
+	heldElsewhere, held := files[0], files[1]
+
+	// both files are trashed, then held. one by pickle, the other directly in the storage.
+	assert.NoErr(t, test.bucket.DeleteFile(held.Key))
+	assert.NoErr(t, test.bucket.DeleteFile(heldElsewhere.Key))
+	assert.NoErr(t, test.bucket.SetLegalHold("held.txt", true))
+	assert.NoErr(t, test.client.PutObjectLegalHold(heldElsewhere.Key, heldElsewhere.VersionID, true))
+	test.regenerateBucket()
+
+	heldID := test.primaryS3.GetVersionIDByFuzzyKey("held.txt")
+	heldChecksumID := test.primaryS3.GetVersionIDByFuzzyKey(hex.EncodeToString([]byte("held.txt")))
+
+	// long after the lock ran out, maintenance keeps the held files in the trash
+	test.setNow(test.now.Add(24 * time.Hour))
+	test.runMaintenance()
+
+	assert.True(t, test.primaryS3.GetByVersionID(heldID) != nil)
+	assert.True(t, test.primaryS3.GetByVersionID(heldChecksumID) != nil)
+	assert.True(t, test.primaryS3.GetByVersionID(heldElsewhere.VersionID) != nil)
+
+	files, err = test.bucket.GetTrashedFiles()
+	assert.NoErr(t, err)
+	assert.Equal(t, 2, len(files))
+	assert.True(t, !files[0].LegalHold)
+	assert.True(t, files[1].LegalHold)
+
+	// once released they are deleted
+	assert.NoErr(t, test.bucket.SetLegalHold("held.txt", false))
+	assert.NoErr(t, test.client.PutObjectLegalHold(heldElsewhere.Key, heldElsewhere.VersionID, false))
+	test.regenerateBucket()
+	test.runMaintenance()
+
+	assert.True(t, test.primaryS3.GetByVersionID(heldID) == nil)
+	assert.True(t, test.primaryS3.GetByVersionID(heldChecksumID) == nil)
+	assert.True(t, test.primaryS3.GetByVersionID(heldElsewhere.VersionID) == nil)
+}
@@ -23,16 +23,18 @@ func TestCanListMultipleFiles(t *testing.T) {
 	assert.NoErr(t, err)
 
 	// upload a few files
-	err = test.bucket.UploadFile(filePath, "here.txt")
+	_, err = test.bucket.UploadFile(filePath, "here.txt")
 	assert.NoErr(t, err)
 
-	err = test.bucket.UploadFile(filePath, "here.txt")
+	err = os.WriteFile(filePath, []byte("def"), 0600)
+	assert.NoErr(t, err)
+	_, err = test.bucket.UploadFile(filePath, "here.txt")
 	assert.NoErr(t, err)
 
-	err = test.bucket.UploadFile(filePath, "nested/a.txt")
+	_, err = test.bucket.UploadFile(filePath, "nested/a.txt")
 	assert.NoErr(t, err)
 
-	err = test.bucket.UploadFile(filePath, "nested/b.txt")
+	_, err = test.bucket.UploadFile(filePath, "nested/b.txt")
 	assert.NoErr(t, err)
 
 	// get the files
@@ -90,7 +92,7 @@ func TestListsOnlyLatestFileVersion(t *testing.T) {
 	assert.NoErr(t, err)
 
 	// upload a few files
-	err = test.bucket.UploadFile(filePath, "here.txt")
+	_, err = test.bucket.UploadFile(filePath, "here.txt")
 	assert.NoErr(t, err)
 
 	// get the files
@@ -22,7 +22,7 @@ func (b *Bucket) getObjectVersions() (*s3.ListAllObjectVersionsResult, error) {
 }
 
 func (b *Bucket) GetFiles() ([]BucketFile, error) {
-	result, err := b.client.ListAllObjectVersions("")
+	result, err := b.storage.ListAllObjectVersions("")
 	if err != nil {
 		return nil, fmt.Errorf("get files: %w", err)
 	}
@@ -34,14 +34,14 @@ func (b *Bucket) GetFiles() ([]BucketFile, error) {
 		return nil, fmt.Errorf("get deleted files: %w", err)
 	}
 
-	return versionsToBucketFiles(result.Versions, func(version s3.VersionInfo) bool {
+	return b.withLegalHolds(versionsToBucketFiles(result.Versions, func(version s3.VersionInfo) bool {
 		// Ignore deleted files
 		return !deletedFiles.isDeleted(version.Key)
-	}), nil
+	}))
 }
 
 func (b *Bucket) GetTrashedFiles() ([]BucketFile, error) {
-	result, err := b.client.ListAllObjectVersions("")
+	result, err := b.storage.ListAllObjectVersions("")
 	if err != nil {
 		return nil, fmt.Errorf("get files: %w", err)
 	}
@@ -53,10 +53,10 @@ func (b *Bucket) GetTrashedFiles() ([]BucketFile, error) {
 		return nil, fmt.Errorf("get deleted files: %w", err)
 	}
 
-	return versionsToBucketFiles(result.Versions, func(version s3.VersionInfo) bool {
+	return b.withLegalHolds(versionsToBucketFiles(result.Versions, func(version s3.VersionInfo) bool {
 		// Ignore non-deleted files
 		return deletedFiles.isDeleted(version.Key)
-	}), nil
+	}))
 }
 
 func versionsToBucketFiles(versions []s3.VersionInfo, filter func(version s3.VersionInfo) bool) []BucketFile {
@@ -77,12 +77,7 @@ func versionsToBucketFiles(versions []s3.VersionInfo, filter func(version s3.Ver
 		//   versioning is handled by the ID embedded in the key.
 		versionsToInclude[version.Key] = version
 
-		parts := strings.Split(version.Key, ".")
-		if len(parts) < 3 {
-			continue
-		}
-		id := parts[len(parts)-1]
-		path := strings.TrimSuffix(version.Key, ".age."+id)
+		path, id := splitDataKey(version.Key)
 
 		if currentID, ok := latestIDAtPath[path]; ok {
 			if id > currentID {
@@ -95,9 +90,7 @@ func versionsToBucketFiles(versions []s3.VersionInfo, filter func(version s3.Ver
 
 	files := []BucketFile{}
 	for _, version := range versionsToInclude {
-		parts := strings.Split(version.Key, ".")
-		id := parts[len(parts)-1]
-		path := strings.TrimSuffix(version.Key, ".age."+id)
+		path, id := splitDataKey(version.Key)
 
 		files = append(files, BucketFile{
 			Key:          version.Key,
@@ -120,6 +113,18 @@ func versionsToBucketFiles(versions []s3.VersionInfo, filter func(version s3.Ver
 	return files
 }
 
+func (b *Bucket) withLegalHolds(files []BucketFile) ([]BucketFile, error) {
+	holds, err := b.getLegalHolds()
+	if err != nil {
+		return nil, fmt.Errorf("get legal holds: %w", err)
+	}
+
+	for i := range files {
+		files[i].LegalHold = holds.isHeld(files[i].Key)
+	}
+	return files, nil
+}
+
 func (b *Bucket) getObjectVersionForKey(key string) (string, error) {
 	versions, err := b.getObjectVersions()
 	if err != nil {
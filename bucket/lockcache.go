@@ -0,0 +1,141 @@
+package bucket
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/bradenrayhorn/pickle/s3"
+)
+
+// lockCacheKey remembers when the lock of each version that maintenance extended ends. Listing
+// doesn't return lock dates, so without it every lock would have to be extended or read on
+// every run.
+//
+// Anyone with write access to the bucket can replace the cache. Far-future dates would stop
+// maintenance from renewing locks until they lapse and the files can be deleted, so the cache
+// is signed with a key derived from the age identity and ignored when the signature doesn't
+// match or no key is configured.
+const lockCacheKey = "_pickle/locks"
+
+// lockCache maps cachedVersionID to the end of the version's lock.
+type lockCache map[string]time.Time
+
+type signedLockCache struct {
+	Locks     json.RawMessage `json:"locks"`
+	Signature string          `json:"signature"`
+}
+
+func (b *Bucket) getLockCache(versions *s3.ListAllObjectVersionsResult) (lockCache, error) {
+	signed, err := b.readLockCache(versions)
+	if err != nil {
+		return lockCache{}, err
+	}
+	if len(signed.Locks) == 0 {
+		return lockCache{}, nil
+	}
+
+	expectedSignature, err := b.signLockCache(signed.Locks)
+	if err != nil {
+		return lockCache{}, err
+	}
+	actualSignature, err := hex.DecodeString(signed.Signature)
+	if err != nil || !hmac.Equal(expectedSignature, actualSignature) {
+		return lockCache{}, fmt.Errorf("cached locks signature is invalid")
+	}
+
+	locks := lockCache{}
+	if err := json.Unmarshal(signed.Locks, &locks); err != nil {
+		return lockCache{}, fmt.Errorf("parse cached locks: %w", err)
+	}
+	return locks, nil
+}
+
+func (b *Bucket) putLockCache(locks lockCache) error {
+	serialized, err := json.Marshal(locks)
+	if err != nil {
+		return fmt.Errorf("encode cached locks: %w", err)
+	}
+
+	signature, err := b.signLockCache(serialized)
+	if err != nil {
+		return err
+	}
+
+	return b.writeLockCache(signedLockCache{Locks: serialized, Signature: hex.EncodeToString(signature)})
+}
+
+func (b *Bucket) readLockCache(versions *s3.ListAllObjectVersionsResult) (signedLockCache, error) {
+	signed := signedLockCache{}
+
+	var versionID string
+	for _, version := range versions.Versions {
+		if version.Key == lockCacheKey && version.IsLatest {
+			versionID = version.VersionId
+			break
+		}
+	}
+	if versionID == "" {
+		return signed, nil
+	}
+
+	src, err := b.storage.GetObject(lockCacheKey, versionID)
+	if err != nil {
+		return signed, fmt.Errorf("get cached locks: %w", err)
+	}
+	defer func() { _ = src.Close() }()
+
+	if err := json.NewDecoder(src).Decode(&signed); err != nil {
+		return signed, fmt.Errorf("parse cached locks: %w", err)
+	}
+	return signed, nil
+}
+
+func (b *Bucket) writeLockCache(signed signedLockCache) error {
+	serialized, err := json.Marshal(signed)
+	if err != nil {
+		return fmt.Errorf("encode cached locks: %w", err)
+	}
+
+	response, err := putBytes(b.storage, lockCacheKey, serialized, nil)
+	if err != nil {
+		return err
+	}
+
+	// listed after the put so versions written by an earlier, interrupted run are removed too
+	versions, err := b.storage.ListAllObjectVersions(lockCacheKey)
+	if err != nil {
+		return err
+	}
+	return deleteOtherVersions(b.storage, versions, lockCacheKey, response.VersionID)
+}
+
+func (b *Bucket) signLockCache(locks []byte) ([]byte, error) {
+	key, err := b.deriveKey("locks")
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(locks)
+	return mac.Sum(nil), nil
+}
+
+// dropLockCache forgets every cached lock, for when locks were changed outside of maintenance.
+func (b *Bucket) dropLockCache() error {
+	versions, err := b.storage.ListAllObjectVersions(lockCacheKey)
+	if err != nil {
+		return err
+	}
+	return deleteOtherVersions(b.storage, versions, lockCacheKey, "")
+}
+
+func (c lockCache) equal(other lockCache) bool {
+	return maps.EqualFunc(c, other, func(a time.Time, b time.Time) bool {
+		return a.Equal(b)
+	})
+}
@@ -17,6 +17,8 @@ type bucketTest struct {
 	backupS3        *fakes3.FakeS3
 	key             *age.X25519Identity
 	objectLockHours int
+	objectLockMode  string
+	compression     string
 	now             time.Time
 	workingDir      string
 
@@ -37,17 +39,35 @@ func (t *bucketTest) setObjectLockHours(hours int) {
 	t.regenerateBucket()
 }
 
+func (t *bucketTest) setObjectLockMode(mode string) {
+	t.objectLockMode = mode
+	t.regenerateBucket()
+}
+
+func (t *bucketTest) setCompression(compression string) {
+	t.compression = compression
+	t.regenerateBucket()
+}
+
 func (t *bucketTest) regenerateBucket() {
 	bucket, err := bucket.New(&bucket.Config{
-		Client:          t.client,
+		Storage:         t.client,
 		Key:             t.key,
 		ObjectLockHours: t.objectLockHours,
+		ObjectLockMode:  t.objectLockMode,
+		Compression:     t.compression,
 		NowFunc:         func() time.Time { return t.now },
 	})
 	assert.NoErr(t.t, err)
 	t.bucket = bucket
 }
 
+func (t *bucketTest) runMaintenance() *bucket.MaintenanceReport {
+	report, err := t.bucket.RunMaintenance(bucket.MaintenanceOptions{})
+	assert.NoErr(t.t, err)
+	return report
+}
+
 func newTest(t testing.TB) *bucketTest {
 	primaryS3 := fakes3.NewFakeS3("my-bucket")
 	backupS3 := fakes3.NewFakeS3("my-bucket-backup")
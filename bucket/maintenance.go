@@ -4,23 +4,99 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"slices"
 	"time"
 
 	"github.com/bradenrayhorn/pickle/s3"
 )
 
-func (b *Bucket) RunMaintenance() error {
-	slog.Info("starting maintenance...")
+type MaintenanceOptions struct {
+	// DryRun computes the report without changing anything.
+	DryRun bool
+	// RenewalWindow only extends locks that end within the window. Zero extends every lock on
+	// every run.
+	RenewalWindow time.Duration
+}
+
+type MaintenanceDeleteReason string
+
+const (
+	MaintenanceDeleteTrash        MaintenanceDeleteReason = "trash"
+	MaintenanceDeleteOrphan       MaintenanceDeleteReason = "orphan"
+	MaintenanceDeleteDuplicate    MaintenanceDeleteReason = "duplicate"
+	MaintenanceDeleteExpiredShare MaintenanceDeleteReason = "expired share"
+)
+
+// MaintenanceReport is what a maintenance run did, or would do in a dry run.
+type MaintenanceReport struct {
+	DryRun bool `json:"dryRun"`
+
+	// RegistryRemovals are trashed keys that are gone from the bucket and dropped from the
+	// delete registry.
+	RegistryRemovals []string `json:"registryRemovals"`
+
+	// Extensions are the versions whose lock is extended to RetainUntil. SkippedExtensions
+	// counts the requests saved on locks that end after the renewal window.
+	RetainUntil       time.Time           `json:"retainUntil"`
+	Extensions        []MaintenanceObject `json:"extensions"`
+	SkippedExtensions int                 `json:"skippedExtensions"`
+
+	// Deletes are the versions that were deleted. Versions that are still locked stay for a
+	// later run and are listed in Locked instead, which is only known after a real run.
+	Deletes []MaintenanceDelete `json:"deletes"`
+	Locked  []MaintenanceObject `json:"locked"`
+	// Held are the versions that would be deleted, but are kept under legal hold.
+	Held []MaintenanceObject `json:"held"`
+
+	Failures []MaintenanceFailure `json:"failures"`
+}
+
+type MaintenanceObject struct {
+	Key       string `json:"key"`
+	VersionID string `json:"versionID"`
+}
+
+type MaintenanceDelete struct {
+	MaintenanceObject
+	Reason MaintenanceDeleteReason `json:"reason"`
+}
+
+type MaintenanceFailure struct {
+	Step      string `json:"step"`
+	Key       string `json:"key,omitempty"`
+	VersionID string `json:"versionID,omitempty"`
+	Error     string `json:"error"`
+}
+
+func newMaintenanceReport(dryRun bool) *MaintenanceReport {
+	return &MaintenanceReport{
+		DryRun:           dryRun,
+		RegistryRemovals: []string{},
+		Extensions:       []MaintenanceObject{},
+		Deletes:          []MaintenanceDelete{},
+		Locked:           []MaintenanceObject{},
+		Held:             []MaintenanceObject{},
+		Failures:         []MaintenanceFailure{},
+	}
+}
+
+func (r *MaintenanceReport) fail(step string, key string, versionID string, err error) {
+	r.Failures = append(r.Failures, MaintenanceFailure{Step: step, Key: key, VersionID: versionID, Error: err.Error()})
+}
+
+func (b *Bucket) RunMaintenance(options MaintenanceOptions) (*MaintenanceReport, error) {
+	slog.Info("starting maintenance...", "dryRun", options.DryRun)
+	report := newMaintenanceReport(options.DryRun)
 
 	versionResult, err := b.getObjectVersions()
 	if err != nil {
-		return err
+		return report, err
 	}
 
 	deletedFiles, err := b.getDeletedFiles()
 	if err != nil {
-		return err
+		return report, err
 	}
 
 	// get and organize files
@@ -69,43 +145,79 @@ func (b *Bucket) RunMaintenance() error {
 	orphanedChecksumFiles := potentiallyOrphanedChecksumFiles
 
 	// 0. Remove any permanently deleted files from registry
-	toRemoveFromDeleteRegistry := []string{}
 	for key := range slices.Values(deletedFiles.keys) {
 		if _, ok := dataFiles[key]; !ok {
 			slog.Info(fmt.Sprintf("%s in registry is now removed from bucket, removing from registry", key))
-			toRemoveFromDeleteRegistry = append(toRemoveFromDeleteRegistry, key)
+			report.RegistryRemovals = append(report.RegistryRemovals, key)
 		}
 	}
-	if len(toRemoveFromDeleteRegistry) > 0 {
+	if len(report.RegistryRemovals) > 0 && !options.DryRun {
 		slog.Info("persisting new delete registry")
-		for key := range slices.Values(toRemoveFromDeleteRegistry) {
+		for key := range slices.Values(report.RegistryRemovals) {
 			deletedFiles.remove(key)
 		}
 
 		if err := b.persistDeleteRegistry(); err != nil {
-			return fmt.Errorf("persist delete registry: %w", err)
+			return report, fmt.Errorf("persist delete registry: %w", err)
 		}
 	}
 
-	// 1. Extend object lock for all active files currently in system.
-	retention := &s3.ObjectLockRetention{
-		Mode:  "COMPLIANCE",
-		Until: b.now().Add(time.Hour * time.Duration(b.objectLockHours)),
+	// 1. Extend object lock for all active files currently in system, unless the lock is known
+	//    to last past the renewal window.
+	retention := b.lockRetention()
+	report.RetainUntil = retention.Until
+
+	// the cache only matters with a window, and can only be trusted when its signature checks out
+	useLockCache := options.RenewalWindow > 0 && b.key != nil
+	locks := lockCache{}
+	if useLockCache {
+		locks, err = b.getLockCache(versionResult)
+		if err != nil {
+			slog.Warn("could not read cached locks, extending every lock", "error", err)
+		}
+	} else if options.RenewalWindow > 0 {
+		slog.Info("key is not configured, extending every lock")
 	}
+	keptLocks := lockCache{}
+
 	retentionErrors := []error{}
-	for _, object := range dataFilesToExtend {
+	extend := func(object s3.VersionInfo) {
+		id := cachedVersionID(object.Key, object.VersionId)
+		if until, ok := locks[id]; ok && until.After(b.now().Add(options.RenewalWindow)) {
+			report.SkippedExtensions++
+			keptLocks[id] = until
+			return
+		}
+
 		slog.Info(fmt.Sprintf("extending retention for %s", object.Key), "versionID", object.VersionId)
-		err := b.client.PutObjectRetention(object.Key, object.VersionId, retention)
-		if err != nil {
-			retentionErrors = append(retentionErrors, fmt.Errorf("set retention %s: %w", object.Key, err))
+		report.Extensions = append(report.Extensions, MaintenanceObject{Key: object.Key, VersionID: object.VersionId})
+		if options.DryRun {
+			return
+		}
+
+		if err := b.putRetention(object.Key, object.VersionId, retention); err != nil {
+			err = fmt.Errorf("set retention %s: %w", object.Key, err)
+			retentionErrors = append(retentionErrors, err)
+			report.fail("extend retention", object.Key, object.VersionId, err)
+			return
 		}
+		keptLocks[id] = retention.Until
+	}
+	for _, object := range dataFilesToExtend {
+		extend(object)
 
 		if checksumObject, ok := checksumFiles[getChecksumPath(object.Key)]; ok {
-			slog.Info(fmt.Sprintf("extending retention for %s", checksumObject.Key), "versionID", checksumObject.VersionId)
-			err := b.client.PutObjectRetention(checksumObject.Key, checksumObject.VersionId, retention)
-			if err != nil {
-				retentionErrors = append(retentionErrors, fmt.Errorf("set retention %s: %w", checksumObject.Key, err))
-			}
+			extend(checksumObject)
+		}
+	}
+	if report.SkippedExtensions > 0 {
+		slog.Info(fmt.Sprintf("skipped %d extensions of locks that end after the renewal window", report.SkippedExtensions))
+	}
+	// locks the cache doesn't know about are just extended
+	if !options.DryRun && useLockCache && !keptLocks.equal(locks) {
+		if err := b.putLockCache(keptLocks); err != nil {
+			retentionErrors = append(retentionErrors, fmt.Errorf("persist cached locks: %w", err))
+			report.fail("persist cached locks", lockCacheKey, "", err)
 		}
 	}
 	var retentionError error
@@ -113,40 +225,115 @@ func (b *Bucket) RunMaintenance() error {
 		retentionError = errors.Join(retentionErrors...)
 	}
 
-	// 2. Delete any files marked for deletion, orphaned checksum files, and duplicates.
-	toDelete := []s3.ObjectIdentifier{}
+	// 2. Delete any files marked for deletion, orphaned checksum files, duplicates, and expired shares.
+	candidates := []MaintenanceDelete{}
+	candidate := func(key string, versionID string, reason MaintenanceDeleteReason) {
+		candidates = append(candidates, MaintenanceDelete{MaintenanceObject{Key: key, VersionID: versionID}, reason})
+	}
 	for _, key := range deletedFiles.keys {
-		version := dataFiles[key]
-
-		slog.Info(fmt.Sprintf("will delete %s", key), "versionID", version.VersionId)
+		version, ok := dataFiles[key]
+		if !ok {
+			// only left in the registry during a dry run
+			continue
+		}
 
-		toDelete = append(toDelete, s3.ObjectIdentifier{Key: version.Key, VersionID: version.VersionId})
+		candidate(version.Key, version.VersionId, MaintenanceDeleteTrash)
 		if checksumObject, ok := checksumFiles[getChecksumPath(key)]; ok {
-			slog.Info(fmt.Sprintf("will delete %s", checksumObject.Key), "versionID", checksumObject.VersionId)
-			toDelete = append(toDelete, s3.ObjectIdentifier{Key: checksumObject.Key, VersionID: checksumObject.VersionId})
+			candidate(checksumObject.Key, checksumObject.VersionId, MaintenanceDeleteTrash)
 		}
 	}
-	for _, object := range orphanedChecksumFiles {
-		slog.Info(fmt.Sprintf("will delete orphaned checksum file %s", object.Key), "versionID", object.VersionId)
-		toDelete = append(toDelete, s3.ObjectIdentifier{Key: object.Key, VersionID: object.VersionId})
+	for _, key := range slices.Sorted(maps.Keys(orphanedChecksumFiles)) {
+		candidate(key, orphanedChecksumFiles[key].VersionId, MaintenanceDeleteOrphan)
 	}
 	for _, object := range duplicateFiles {
-		slog.Info(fmt.Sprintf("will delete duplicate file %s", object.Key), "versionID", object.VersionId)
-		toDelete = append(toDelete, s3.ObjectIdentifier{Key: object.Key, VersionID: object.VersionId})
+		candidate(object.Key, object.VersionId, MaintenanceDeleteDuplicate)
+	}
+	for _, object := range expiredShares(versionResult.Versions, b.now()) {
+		candidate(object.Key, object.VersionID, MaintenanceDeleteExpiredShare)
+	}
+
+	// files under legal hold stay, even in the trash
+	var legalHoldError error
+	holds, err := b.getLegalHolds()
+	if err != nil {
+		legalHoldError = err
+		report.fail("check legal holds", "", "", err)
+		candidates = nil
+	}
+	legalHoldErrors := []error{}
+	toDelete := []s3.ObjectIdentifier{}
+	for _, object := range candidates {
+		held, err := b.isLegallyHeld(holds, object.Key, object.VersionID)
+		if err != nil {
+			err = fmt.Errorf("get legal hold %s: %w", object.Key, err)
+			legalHoldErrors = append(legalHoldErrors, err)
+			report.fail("check legal hold", object.Key, object.VersionID, err)
+			continue
+		}
+		if held {
+			slog.Info(fmt.Sprintf("%s is under legal hold, keeping", object.Key), "versionID", object.VersionID)
+			report.Held = append(report.Held, object.MaintenanceObject)
+			continue
+		}
+
+		slog.Info(fmt.Sprintf("will delete %s file %s", object.Reason, object.Key), "versionID", object.VersionID)
+		report.Deletes = append(report.Deletes, object)
+		toDelete = append(toDelete, s3.ObjectIdentifier{Key: object.Key, VersionID: object.VersionID})
+	}
+	if len(legalHoldErrors) > 0 {
+		legalHoldError = errors.Join(legalHoldError, fmt.Errorf("check legal holds: %w", errors.Join(legalHoldErrors...)))
 	}
 
 	var deleteError error
-	if len(toDelete) > 0 {
-		_, err = b.client.DeleteObjects(toDelete)
+	if len(toDelete) > 0 && !options.DryRun {
+		result, err := b.storage.DeleteObjects(toDelete)
 		if err != nil {
 			deleteError = fmt.Errorf("delete objects: %w", err)
+			report.fail("delete", "", "", deleteError)
+			report.Deletes = []MaintenanceDelete{}
+		} else {
+			notDeleted := map[MaintenanceObject]bool{}
+			for _, failed := range result.Error {
+				object := MaintenanceObject{Key: failed.Key, VersionID: failed.VersionID}
+				notDeleted[object] = true
+				if failed.IsObjectLocked() {
+					report.Locked = append(report.Locked, object)
+				} else {
+					report.fail("delete", failed.Key, failed.VersionID, fmt.Errorf("%s: %s", failed.Code, failed.Message))
+				}
+			}
+			report.Deletes = slices.DeleteFunc(report.Deletes, func(d MaintenanceDelete) bool {
+				return notDeleted[d.MaintenanceObject]
+			})
 		}
 	}
 
+	if options.DryRun {
+		slog.Info("dry run complete")
+		return report, legalHoldError
+	}
+
 	slog.Info("refreshing file list...")
 	_, refreshFilesError := b.GetFiles()
+	if refreshFilesError != nil {
+		report.fail("refresh files", "", "", refreshFilesError)
+	}
+
+	// 3. Write the manifest. It is encrypted, so it can only be written when the key is known.
+	var manifestError error
+	if refreshFilesError == nil {
+		if b.key != nil {
+			slog.Info("writing manifest...")
+			if err := b.writeManifest(); err != nil {
+				manifestError = fmt.Errorf("write manifest: %w", err)
+				report.fail("write manifest", "", "", manifestError)
+			}
+		} else {
+			slog.Info("key is not configured, skipping manifest")
+		}
+	}
 
 	slog.Info("maintenance complete")
 
-	return errors.Join(retentionError, deleteError, refreshFilesError)
+	return report, errors.Join(retentionError, legalHoldError, deleteError, refreshFilesError, manifestError)
 }
@@ -3,13 +3,16 @@ package bucket_test
 import (
 	"bytes"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"net/http"
 	"os"
 	"path"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/bradenrayhorn/pickle/bucket"
 	fakes3 "github.com/bradenrayhorn/pickle/internal/fake_s3"
 	"github.com/bradenrayhorn/pickle/internal/testutils/assert"
 )
@@ -25,16 +28,16 @@ func TestMaintenance(t *testing.T) {
 	assert.NoErr(t, err)
 
 	// --- Setup files for maintenance scenario ---
-	err = test.bucket.UploadFile(filePath, "will-delete/a.txt")
+	_, err = test.bucket.UploadFile(filePath, "will-delete/a.txt")
 	assert.NoErr(t, err)
 
-	err = test.bucket.UploadFile(filePath, "will-delete/b.txt")
+	_, err = test.bucket.UploadFile(filePath, "will-delete/b.txt")
 	assert.NoErr(t, err)
 
-	err = test.bucket.UploadFile(filePath, "active.txt")
+	_, err = test.bucket.UploadFile(filePath, "active.txt")
 	assert.NoErr(t, err)
 
-	err = test.bucket.UploadFile(filePath, "active-b.txt")
+	_, err = test.bucket.UploadFile(filePath, "active-b.txt")
 	assert.NoErr(t, err)
 
 	files, err := test.bucket.GetFiles()
@@ -92,7 +95,7 @@ func TestMaintenance(t *testing.T) {
 
 	// --- 2AM : first maintenance run ---
 	test.setNow(test.now.Add(1 * time.Hour))
-	assert.NoErr(t, test.bucket.RunMaintenance())
+	test.runMaintenance()
 	// Expected changes:
 	//  - Orphaned checksum is deleted
 	assert.Equal(t, nil, test.primaryS3.GetByVersionID(idOrphanedAChecksum))
@@ -116,7 +119,7 @@ func TestMaintenance(t *testing.T) {
 
 	// --- 3AM : second maintenance run ---
 	test.setNow(test.now.Add(1 * time.Hour))
-	assert.NoErr(t, test.bucket.RunMaintenance())
+	test.runMaintenance()
 	// Expected changes:
 	//  - File locks are extended for non-marked-as-deleted files
 	time8AM := time.Date(2025, time.June, 20, 8, 0, 0, 0, time.UTC)
@@ -134,7 +137,7 @@ func TestMaintenance(t *testing.T) {
 
 	// --- 6AM : third maintenance run ---
 	test.setNow(test.now.Add(3 * time.Hour))
-	assert.NoErr(t, test.bucket.RunMaintenance())
+	test.runMaintenance()
 	// Expected changes:
 	//  - File locks are extended for non-marked-as-deleted files
 	time11AM := time.Date(2025, time.June, 20, 11, 0, 0, 0, time.UTC)
@@ -152,7 +155,7 @@ func TestMaintenance(t *testing.T) {
 
 	// --- 7AM : fourth maintenance run ---
 	test.setNow(test.now.Add(1 * time.Hour))
-	assert.NoErr(t, test.bucket.RunMaintenance())
+	test.runMaintenance()
 	// Expected changes:
 	//  - File locks are extended for non-marked-as-deleted files
 	time12PM := time.Date(2025, time.June, 20, 12, 0, 0, 0, time.UTC)
@@ -164,3 +167,219 @@ func TestMaintenance(t *testing.T) {
 	assert.True(t, len(test.primaryS3.GetVersions("_pickle/deleted")[0].Content) == 0)
 
 }
+
+func TestMaintenanceReport(t *testing.T) {
+	test := newTest(t)
+	test.setNow(time.Date(2025, time.June, 20, 0, 0, 0, 0, time.UTC))
+	test.setObjectLockHours(5)
+
+	filePath := path.Join(test.workingDir, "file.txt")
+	assert.NoErr(t, os.WriteFile(filePath, []byte("abc"), 0600))
+
+	active, err := test.bucket.UploadFile(filePath, "active.txt")
+	assert.NoErr(t, err)
+	trashed, err := test.bucket.UploadFile(filePath, "trashed.txt")
+	assert.NoErr(t, err)
+	assert.NoErr(t, test.bucket.DeleteFile(trashed.Key))
+
+	data := []byte("orphan")
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	_, err = test.client.PutObject("_pickle/checksum/orphaned.sha256", bytes.NewReader(data), 6, crc32c, sha256, nil)
+	assert.NoErr(t, err)
+	test.regenerateBucket()
+
+	activeChecksum := "_pickle/checksum/" + hex.EncodeToString([]byte(active.Key)) + ".sha256"
+	trashedChecksum := "_pickle/checksum/" + hex.EncodeToString([]byte(trashed.Key)) + ".sha256"
+	activeID := test.primaryS3.GetVersionIDByFuzzyKey("active.txt")
+
+	// a dry run reports everything, but changes nothing
+	test.setNow(test.now.Add(time.Hour))
+	report, err := test.bucket.RunMaintenance(bucket.MaintenanceOptions{DryRun: true})
+	assert.NoErr(t, err)
+
+	assert.True(t, report.DryRun)
+	assert.Equal(t, time.Date(2025, time.June, 20, 6, 0, 0, 0, time.UTC), report.RetainUntil)
+	assert.Equal(t, active.Key+", "+activeChecksum, maintenanceKeys(report.Extensions))
+	assert.Equal(t, "trash "+trashed.Key+", trash "+trashedChecksum+", orphan _pickle/checksum/orphaned.sha256", maintenanceDeletes(report.Deletes))
+	assert.Equal(t, 0, len(report.Locked))
+	assert.Equal(t, 0, len(report.Failures))
+
+	assert.Equal(t, time.Date(2025, time.June, 20, 5, 0, 0, 0, time.UTC), test.primaryS3.GetByVersionID(activeID).Retention.Until)
+	assert.Equal(t, 1, len(test.primaryS3.GetVersions("_pickle/checksum/orphaned.sha256")))
+
+	// a real run finds the trash is still locked
+	report = test.runMaintenance()
+
+	assert.True(t, !report.DryRun)
+	assert.Equal(t, active.Key+", "+activeChecksum, maintenanceKeys(report.Extensions))
+	assert.Equal(t, "orphan _pickle/checksum/orphaned.sha256", maintenanceDeletes(report.Deletes))
+	assert.Equal(t, trashed.Key+", "+trashedChecksum, maintenanceKeys(report.Locked))
+
+	assert.Equal(t, time.Date(2025, time.June, 20, 6, 0, 0, 0, time.UTC), test.primaryS3.GetByVersionID(activeID).Retention.Until)
+	assert.Equal(t, 0, len(test.primaryS3.GetVersions("_pickle/checksum/orphaned.sha256")))
+
+	// once the lock runs out the trash is deleted, and then dropped from the registry
+	test.setNow(test.now.Add(5 * time.Hour))
+	report = test.runMaintenance()
+	assert.Equal(t, "trash "+trashed.Key+", trash "+trashedChecksum, maintenanceDeletes(report.Deletes))
+	assert.Equal(t, 0, len(report.Locked))
+
+	report = test.runMaintenance()
+	assert.Equal(t, trashed.Key, strings.Join(report.RegistryRemovals, ", "))
+	assert.Equal(t, 0, len(report.Deletes))
+}
+
+func TestMaintenanceReportsHeldFiles(t *testing.T) {
+	test := newTest(t)
+	test.setObjectLockHours(5)
+
+	filePath := path.Join(test.workingDir, "file.txt")
+	assert.NoErr(t, os.WriteFile(filePath, []byte("abc"), 0600))
+	result, err := test.bucket.UploadFile(filePath, "held.txt")
+	assert.NoErr(t, err)
+	assert.NoErr(t, test.bucket.DeleteFile(result.Key))
+	assert.NoErr(t, test.bucket.SetLegalHold("held.txt", true))
+
+	report, err := test.bucket.RunMaintenance(bucket.MaintenanceOptions{DryRun: true})
+	assert.NoErr(t, err)
+	assert.Equal(t, 0, len(report.Deletes))
+	assert.Equal(t, result.Key+", _pickle/checksum/"+hex.EncodeToString([]byte(result.Key))+".sha256", maintenanceKeys(report.Held))
+}
+
+func TestMaintenanceReportsDeniedDeletesAsFailures(t *testing.T) {
+	test := newTest(t)
+
+	data := []byte("orphan")
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	_, err := test.client.PutObject("_pickle/checksum/orphaned.sha256", bytes.NewReader(data), 6, crc32c, sha256, nil)
+	assert.NoErr(t, err)
+	orphanID := test.primaryS3.GetVersionIDByFuzzyKey("orphaned.sha256")
+
+	// credentials without s3:DeleteObjectVersion get AccessDenied for each key, without
+	// mentioning object lock
+	test.primaryS3.SetInterceptor(func(r *http.Request, w http.ResponseWriter) bool {
+		if r.Method != http.MethodPost || !r.URL.Query().Has("delete") {
+			return false
+		}
+		_, _ = w.Write([]byte("<DeleteResult><Error><Key>_pickle/checksum/orphaned.sha256</Key><VersionId>" + orphanID + "</VersionId><Code>AccessDenied</Code><Message>Access Denied</Message></Error></DeleteResult>"))
+		return true
+	})
+
+	report, err := test.bucket.RunMaintenance(bucket.MaintenanceOptions{})
+	assert.NoErr(t, err)
+	assert.Equal(t, 0, len(report.Deletes))
+	assert.Equal(t, 0, len(report.Locked))
+	assert.Equal(t, 1, len(report.Failures))
+	assert.Equal(t, "_pickle/checksum/orphaned.sha256", report.Failures[0].Key)
+	assert.Equal(t, "AccessDenied: Access Denied", report.Failures[0].Error)
+}
+
+func TestMaintenanceRenewalWindow(t *testing.T) {
+	test := newTest(t)
+	test.setNow(time.Date(2025, time.June, 20, 0, 0, 0, 0, time.UTC))
+	test.setObjectLockHours(10)
+
+	filePath := path.Join(test.workingDir, "file.txt")
+	assert.NoErr(t, os.WriteFile(filePath, []byte("abc"), 0600))
+	_, err := test.bucket.UploadFile(filePath, "file.txt")
+	assert.NoErr(t, err)
+	fileID := test.primaryS3.GetVersionIDByFuzzyKey("file.txt")
+
+	options := bucket.MaintenanceOptions{RenewalWindow: 3 * time.Hour}
+
+	// locks the cache doesn't know about yet are extended
+	test.setNow(test.now.Add(time.Hour))
+	report, err := test.bucket.RunMaintenance(options)
+	assert.NoErr(t, err)
+	assert.Equal(t, 2, len(report.Extensions))
+	assert.Equal(t, 0, report.SkippedExtensions)
+	assert.Equal(t, 1, len(test.primaryS3.GetVersions("_pickle/locks")))
+
+	// a dry run doesn't touch the cache
+	test.setNow(test.now.Add(time.Hour))
+	report, err = test.bucket.RunMaintenance(bucket.MaintenanceOptions{DryRun: true, RenewalWindow: 3 * time.Hour})
+	assert.NoErr(t, err)
+	assert.Equal(t, 0, len(report.Extensions))
+	assert.Equal(t, 2, report.SkippedExtensions)
+	assert.Equal(t, 1, len(test.primaryS3.GetVersions("_pickle/locks")))
+
+	// the lock ends at 11AM, well after the window
+	report, err = test.bucket.RunMaintenance(options)
+	assert.NoErr(t, err)
+	assert.Equal(t, 0, len(report.Extensions))
+	assert.Equal(t, 2, report.SkippedExtensions)
+	assert.Equal(t, time.Date(2025, time.June, 20, 11, 0, 0, 0, time.UTC), test.primaryS3.GetByVersionID(fileID).Retention.Until)
+
+	// once the lock ends within the window it is extended again
+	test.setNow(time.Date(2025, time.June, 20, 8, 30, 0, 0, time.UTC))
+	report, err = test.bucket.RunMaintenance(options)
+	assert.NoErr(t, err)
+	assert.Equal(t, 2, len(report.Extensions))
+	assert.Equal(t, 0, report.SkippedExtensions)
+	assert.Equal(t, time.Date(2025, time.June, 20, 18, 30, 0, 0, time.UTC), test.primaryS3.GetByVersionID(fileID).Retention.Until)
+
+	// without a window every lock is extended
+	report = test.runMaintenance()
+	assert.Equal(t, 2, len(report.Extensions))
+	assert.Equal(t, 0, report.SkippedExtensions)
+}
+
+func TestMaintenanceIgnoresUntrustedLockCache(t *testing.T) {
+	test := newTest(t)
+	test.setNow(time.Date(2025, time.June, 20, 0, 0, 0, 0, time.UTC))
+	test.setObjectLockHours(10)
+
+	filePath := path.Join(test.workingDir, "file.txt")
+	assert.NoErr(t, os.WriteFile(filePath, []byte("abc"), 0600))
+	_, err := test.bucket.UploadFile(filePath, "file.txt")
+	assert.NoErr(t, err)
+
+	options := bucket.MaintenanceOptions{RenewalWindow: 3 * time.Hour}
+	_, err = test.bucket.RunMaintenance(options)
+	assert.NoErr(t, err)
+
+	// push every cached lock far into the future, keeping the old signature
+	versions := test.primaryS3.GetVersions("_pickle/locks")
+	assert.Equal(t, 1, len(versions))
+	var signed struct {
+		Locks     map[string]time.Time `json:"locks"`
+		Signature string               `json:"signature"`
+	}
+	assert.NoErr(t, json.Unmarshal(versions[0].Content, &signed))
+	assert.Equal(t, 2, len(signed.Locks))
+	for id := range signed.Locks {
+		signed.Locks[id] = time.Date(2100, time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+	versions[0].Content, err = json.Marshal(signed)
+	assert.NoErr(t, err)
+
+	test.regenerateBucket()
+	report, err := test.bucket.RunMaintenance(options)
+	assert.NoErr(t, err)
+	assert.Equal(t, 2, len(report.Extensions))
+	assert.Equal(t, 0, report.SkippedExtensions)
+
+	// without a key the cache can't be checked, so it isn't used at all
+	test.key = nil
+	test.regenerateBucket()
+	report, err = test.bucket.RunMaintenance(options)
+	assert.NoErr(t, err)
+	assert.Equal(t, 2, len(report.Extensions))
+	assert.Equal(t, 0, report.SkippedExtensions)
+}
+
+func maintenanceKeys(objects []bucket.MaintenanceObject) string {
+	keys := []string{}
+	for _, object := range objects {
+		keys = append(keys, object.Key)
+	}
+	return strings.Join(keys, ", ")
+}
+
+func maintenanceDeletes(deletes []bucket.MaintenanceDelete) string {
+	keys := []string{}
+	for _, object := range deletes {
+		keys = append(keys, string(object.Reason)+" "+object.Key)
+	}
+	return strings.Join(keys, ", ")
+}
@@ -0,0 +1,190 @@
+package bucket
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+)
+
+var (
+	manifestKey = "_pickle/manifest"
+)
+
+type Manifest struct {
+	GeneratedAt time.Time       `json:"generatedAt"`
+	Files       []ManifestEntry `json:"files"`
+}
+
+type ManifestEntry struct {
+	Key        string `json:"key"`
+	VersionID  string `json:"versionID"`
+	Path       string `json:"path"`
+	Size       uint64 `json:"size"`
+	SHA256     string `json:"sha256"`
+	PickleID   string `json:"pickleID"`
+	UploadedAt string `json:"uploadedAt"`
+	Deleted    bool   `json:"deleted"`
+}
+
+// signedManifest is the plaintext that gets age-encrypted into the manifest object.
+type signedManifest struct {
+	Manifest  json.RawMessage `json:"manifest"`
+	Signature string          `json:"signature"`
+}
+
+// GetManifest loads and verifies the latest manifest written by maintenance, without listing
+// the bucket.
+func (b *Bucket) GetManifest() (*Manifest, error) {
+	if b.key == nil {
+		return nil, fmt.Errorf("key is not configured")
+	}
+
+	// the latest version is read directly, so loading the manifest doesn't need a listing
+	src, err := b.storage.GetObject(manifestKey, "")
+	if err != nil {
+		return nil, fmt.Errorf("get manifest: %w", err)
+	}
+	defer func() { _ = src.Close() }()
+
+	decrypted, err := age.Decrypt(src, b.key)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt manifest: %w", err)
+	}
+
+	var signed signedManifest
+	if err := json.NewDecoder(decrypted).Decode(&signed); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+
+	expectedSignature, err := b.signManifest(signed.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	actualSignature, err := hex.DecodeString(signed.Signature)
+	if err != nil || !hmac.Equal(expectedSignature, actualSignature) {
+		return nil, fmt.Errorf("manifest signature is invalid")
+	}
+
+	manifest := &Manifest{}
+	if err := json.Unmarshal(signed.Manifest, manifest); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+
+	return manifest, nil
+}
+
+func (b *Bucket) writeManifest() error {
+	versionResult, err := b.getObjectVersions()
+	if err != nil {
+		return err
+	}
+
+	deletedFiles, err := b.getDeletedFiles()
+	if err != nil {
+		return err
+	}
+
+	// reuse entries from the previous manifest to avoid a HeadObject per file
+	known := map[string]ManifestEntry{}
+	if previous, err := b.GetManifest(); err == nil {
+		for _, entry := range previous.Files {
+			known[entry.Key+"/"+entry.VersionID] = entry
+		}
+	} else {
+		slog.Info("could not load previous manifest, rebuilding", "error", err)
+	}
+
+	// Flip versions to process oldest first.
+	versions := slices.Clone(versionResult.Versions)
+	slices.Reverse(versions)
+
+	seen := map[string]bool{}
+	manifest := Manifest{GeneratedAt: b.now().UTC(), Files: []ManifestEntry{}}
+	for _, version := range versions {
+		if !isDataFile(version.Key) || seen[version.Key] {
+			continue
+		}
+		seen[version.Key] = true
+
+		entry, ok := known[version.Key+"/"+version.VersionId]
+		if !ok {
+			meta, err := b.storage.HeadObject(version.Key, version.VersionId)
+			if err != nil {
+				return fmt.Errorf("get meta %s: %w", version.Key, err)
+			}
+
+			path, _ := splitDataKey(version.Key)
+			entry = ManifestEntry{
+				Key:        version.Key,
+				VersionID:  version.VersionId,
+				Path:       path,
+				Size:       version.Size,
+				SHA256:     meta.PickleSHA256,
+				PickleID:   meta.PickleID,
+				UploadedAt: version.LastModified,
+			}
+		}
+		entry.Deleted = deletedFiles.isDeleted(version.Key)
+
+		manifest.Files = append(manifest.Files, entry)
+	}
+
+	slices.SortFunc(manifest.Files, func(a, b ManifestEntry) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	serialized, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("encode manifest: %w", err)
+	}
+
+	signature, err := b.signManifest(serialized)
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := json.Marshal(signedManifest{Manifest: serialized, Signature: hex.EncodeToString(signature)})
+	if err != nil {
+		return fmt.Errorf("encode manifest: %w", err)
+	}
+
+	encrypted := &bytes.Buffer{}
+	w, err := age.Encrypt(encrypted, b.key.Recipient())
+	if err != nil {
+		return fmt.Errorf("age encrypt: %w", err)
+	}
+	if _, err := io.Copy(w, bytes.NewReader(plaintext)); err != nil {
+		return fmt.Errorf("copy to age: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("close writer: %w", err)
+	}
+
+	response, err := putBytes(b.storage, manifestKey, encrypted.Bytes(), nil)
+	if err != nil {
+		return fmt.Errorf("upload manifest: %w", err)
+	}
+
+	return deleteOtherVersions(b.storage, versionResult, manifestKey, response.VersionID)
+}
+
+func (b *Bucket) signManifest(manifest []byte) ([]byte, error) {
+	key, err := b.deriveKey("manifest")
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(manifest)
+	return mac.Sum(nil), nil
+}
@@ -0,0 +1,125 @@
+package bucket_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"sync/atomic"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/bradenrayhorn/pickle/internal/testutils/assert"
+)
+
+func TestMaintenanceWritesManifest(t *testing.T) {
+	test := newTest(t)
+	test.setObjectLockHours(5)
+
+	// create file to upload
+	filePath := path.Join(test.workingDir, "file.txt")
+	err := os.WriteFile(filePath, []byte("abc"), 0600)
+	assert.NoErr(t, err)
+
+	// upload a few files and delete one
+	_, err = test.bucket.UploadFile(filePath, "a.txt")
+	assert.NoErr(t, err)
+	_, err = test.bucket.UploadFile(filePath, "nested/b.txt")
+	assert.NoErr(t, err)
+
+	files, err := test.bucket.GetFiles()
+	assert.NoErr(t, err)
+	assert.Equal(t, 2, len(files))
+	assert.NoErr(t, test.bucket.DeleteFile(files[1].Key))
+
+	// run maintenance
+	test.regenerateBucket()
+	test.runMaintenance()
+
+	// loading the manifest doesn't list the bucket
+	var listings atomic.Int32
+	test.primaryS3.SetInterceptor(func(r *http.Request, w http.ResponseWriter) bool {
+		if r.URL.Query().Has("versions") {
+			listings.Add(1)
+		}
+		return false
+	})
+
+	test.regenerateBucket()
+	manifest, err := test.bucket.GetManifest()
+	assert.NoErr(t, err)
+	assert.Equal(t, 2, len(manifest.Files))
+	assert.Equal(t, int32(0), listings.Load())
+	test.primaryS3.SetInterceptor(nil)
+
+	a := manifest.Files[0]
+	assert.Equal(t, files[0].Key, a.Key)
+	assert.Equal(t, files[0].VersionID, a.VersionID)
+	assert.Equal(t, "a.txt", a.Path)
+	assert.Equal(t, false, a.Deleted)
+	assert.NotZero(t, a.PickleID)
+	assert.NotZero(t, a.SHA256)
+	assert.NotZero(t, a.Size)
+
+	b := manifest.Files[1]
+	assert.Equal(t, "nested/b.txt", b.Path)
+	assert.Equal(t, true, b.Deleted)
+
+	// running maintenance again keeps a single manifest version
+	test.regenerateBucket()
+	test.runMaintenance()
+	assert.Equal(t, 1, len(test.primaryS3.GetVersions("_pickle/manifest")))
+
+	test.regenerateBucket()
+	manifest2, err := test.bucket.GetManifest()
+	assert.NoErr(t, err)
+	assert.Equal(t, a, manifest2.Files[0])
+}
+
+func TestManifestRejectsTampering(t *testing.T) {
+	test := newTest(t)
+
+	filePath := path.Join(test.workingDir, "file.txt")
+	err := os.WriteFile(filePath, []byte("abc"), 0600)
+	assert.NoErr(t, err)
+
+	_, err = test.bucket.UploadFile(filePath, "a.txt")
+	assert.NoErr(t, err)
+	test.runMaintenance()
+
+	versions := test.primaryS3.GetVersions("_pickle/manifest")
+	assert.Equal(t, 1, len(versions))
+	original := versions[0].Content
+
+	// mess with manifest bits
+	versions[0].Content = []byte{1, 2, 3, 4}
+
+	test.regenerateBucket()
+	_, err = test.bucket.GetManifest()
+	assert.ErrContains(t, err, "decrypt manifest")
+
+	// anyone can encrypt to the recipient, so a changed manifest must fail the signature
+	decrypted, err := age.Decrypt(bytes.NewReader(original), test.key)
+	assert.NoErr(t, err)
+	var signed struct {
+		Manifest  map[string]any `json:"manifest"`
+		Signature string         `json:"signature"`
+	}
+	assert.NoErr(t, json.NewDecoder(decrypted).Decode(&signed))
+	signed.Manifest["files"] = []any{}
+	plaintext, err := json.Marshal(signed)
+	assert.NoErr(t, err)
+
+	encrypted := &bytes.Buffer{}
+	w, err := age.Encrypt(encrypted, test.key.Recipient())
+	assert.NoErr(t, err)
+	_, err = w.Write(plaintext)
+	assert.NoErr(t, err)
+	assert.NoErr(t, w.Close())
+	versions[0].Content = encrypted.Bytes()
+
+	test.regenerateBucket()
+	_, err = test.bucket.GetManifest()
+	assert.ErrContains(t, err, "manifest signature is invalid")
+}
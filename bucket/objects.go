@@ -0,0 +1,88 @@
+package bucket
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash/crc32"
+	"strings"
+
+	"github.com/bradenrayhorn/pickle/s3"
+)
+
+func putBytes(storage Storage, key string, data []byte, retention *s3.ObjectLockRetention) (*s3.PutObjectResponse, error) {
+	checksum := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	if _, err := checksum.Write(data); err != nil {
+		return nil, fmt.Errorf("write crc32 sum: %w", err)
+	}
+
+	sha256Checksum := sha256.Sum256(data)
+
+	return storage.PutObjectWithMetadata(key, bytes.NewReader(data), int64(len(data)), checksum.Sum(nil), sha256Checksum[:], retention, nil)
+}
+
+// deleteOtherVersions removes every version of key except keepVersionID.
+func deleteOtherVersions(storage Storage, versions *s3.ListAllObjectVersionsResult, key string, keepVersionID string) error {
+	toDelete := []s3.ObjectIdentifier{}
+	for _, version := range versions.Versions {
+		if version.Key == key && version.VersionId != keepVersionID {
+			toDelete = append(toDelete, s3.ObjectIdentifier{Key: version.Key, VersionID: version.VersionId})
+		}
+	}
+
+	if len(toDelete) > 0 {
+		if _, err := storage.DeleteObjects(toDelete); err != nil {
+			return fmt.Errorf("delete objects: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// readRegistry returns the non-empty lines of the latest version of a registry object, or none
+// if it was never written.
+func readRegistry(storage Storage, versions *s3.ListAllObjectVersionsResult, key string) ([]string, error) {
+	var versionID string
+	for _, version := range versions.Versions {
+		if version.Key == key && version.IsLatest {
+			versionID = version.VersionId
+			break
+		}
+	}
+
+	if versionID == "" {
+		return nil, nil
+	}
+
+	src, err := storage.GetObject(key, versionID)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", key, err)
+	}
+	defer func() { _ = src.Close() }()
+
+	lines := []string{}
+	scanner := bufio.NewScanner(src)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", key, err)
+	}
+
+	return lines, nil
+}
+
+// writeRegistry uploads a new version of a registry object and removes the old ones.
+func writeRegistry(storage Storage, versions *s3.ListAllObjectVersionsResult, key string, data []byte) error {
+	response, err := putBytes(storage, key, data, nil)
+	if err != nil {
+		return err
+	}
+
+	return deleteOtherVersions(storage, versions, key, response.VersionID)
+}
@@ -0,0 +1,44 @@
+package bucket
+
+import (
+	"log/slog"
+)
+
+// restoreOptions reconcile by pickle-id like a backup, but never delete and never trust or
+// write cached state, so the primary ends up with nothing but the restored objects.
+var restoreOptions = BackupOptions{FullScan: true}
+
+// RestoreFromBackup copies every object that is missing from primary back from a backup,
+// keeping keys, metadata and locks. Nothing is ever deleted, in either bucket.
+func RestoreFromBackup(backup Storage, primary Storage) (*BackupPlan, error) {
+	slog.Info("restoring from pickle backup...")
+
+	plan, err := PlanRestore(backup, primary)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyBackupPlan(backup, primary, plan, slog.Default()); err != nil {
+		return plan, err
+	}
+
+	slog.Info("pickle restore complete")
+
+	return plan, nil
+}
+
+// PlanRestore returns what RestoreFromBackup would change, without changing anything.
+func PlanRestore(backup Storage, primary Storage) (*BackupPlan, error) {
+	src, err := listBackupSource(backup)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := planBackup(src, primary, restoreOptions, slog.Default())
+	if err != nil {
+		return nil, err
+	}
+	plan.skipState = true
+
+	return plan, nil
+}
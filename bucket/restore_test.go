@@ -0,0 +1,122 @@
+package bucket_test
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/bradenrayhorn/pickle/bucket"
+	"github.com/bradenrayhorn/pickle/internal/memstorage"
+	"github.com/bradenrayhorn/pickle/internal/testutils/assert"
+)
+
+func TestRestoreFromBackup(t *testing.T) {
+	test := newTest(t)
+	test.setObjectLockHours(3)
+
+	backup := memstorage.New()
+	backup.SetNow(test.now)
+
+	// create files to upload
+	filePath := path.Join(test.workingDir, "file.txt")
+	err := os.WriteFile(filePath, []byte("abc"), 0600)
+	assert.NoErr(t, err)
+
+	upload, err := test.bucket.UploadFile(filePath, "a.txt")
+	assert.NoErr(t, err)
+	trashed, err := test.bucket.UploadFile(filePath, "b.txt")
+	assert.NoErr(t, err)
+	assert.NoErr(t, test.bucket.DeleteFile(trashed.Key))
+
+	assert.NoErr(t, bucket.BackupBucket(test.client, backup, bucket.BackupOptions{}))
+	backupVersions, err := backup.ListAllObjectVersions("")
+	assert.NoErr(t, err)
+
+	// primary bucket is lost
+	test.primaryS3.Reset()
+
+	plan, err := bucket.PlanRestore(backup, test.client)
+	assert.NoErr(t, err)
+	assert.Equal(t, 5, len(plan.Uploads))
+	assert.Equal(t, 0, len(test.primaryS3.GetVersions(upload.Key)))
+
+	plan, err = bucket.RestoreFromBackup(backup, test.client)
+	assert.NoErr(t, err)
+	assert.Equal(t, 5, len(plan.Uploads))
+
+	// files, checksums and the delete registry are back
+	test.regenerateBucket()
+	files, err := test.bucket.GetFiles()
+	assert.NoErr(t, err)
+	assert.Equal(t, 1, len(files))
+	assert.Equal(t, upload.Key, files[0].Key)
+
+	files, err = test.bucket.GetTrashedFiles()
+	assert.NoErr(t, err)
+	assert.Equal(t, 1, len(files))
+	assert.Equal(t, trashed.Key, files[0].Key)
+
+	downloadPath := path.Join(test.workingDir, "download.txt")
+	assert.NoErr(t, test.bucket.DownloadFile(upload.Key, downloadPath))
+	content, err := os.ReadFile(downloadPath)
+	assert.NoErr(t, err)
+	assert.Equal(t, "abc", string(content))
+
+	// locks are kept
+	backupMeta, err := backup.HeadObject(upload.Key, "")
+	assert.NoErr(t, err)
+	primaryMeta, err := test.client.HeadObject(upload.Key, "")
+	assert.NoErr(t, err)
+	assert.Equal(t, backupMeta.PickleID, primaryMeta.PickleID)
+	assert.Equal(t, backupMeta.ObjectLockRetainUntilDate, primaryMeta.ObjectLockRetainUntilDate)
+
+	// no backup state is written to the primary
+	assert.Equal(t, 0, len(test.primaryS3.GetVersions("_pickle/backup/state")))
+
+	// the backup is untouched, and a second restore has nothing to do
+	after, err := backup.ListAllObjectVersions("")
+	assert.NoErr(t, err)
+	assert.Equal(t, backupVersions, after)
+
+	plan, err = bucket.PlanRestore(backup, test.client)
+	assert.NoErr(t, err)
+	assert.True(t, plan.IsEmpty())
+}
+
+func TestRestoreDropsExpiredLocks(t *testing.T) {
+	test := newTest(t)
+	restoreAt := test.now
+
+	// the file was locked for three hours, five hours ago
+	test.setNow(restoreAt.Add(-5 * time.Hour))
+	test.setObjectLockHours(3)
+
+	backup := memstorage.New()
+	backup.SetNow(test.now)
+
+	filePath := path.Join(test.workingDir, "file.txt")
+	assert.NoErr(t, os.WriteFile(filePath, []byte("abc"), 0600))
+	upload, err := test.bucket.UploadFile(filePath, "a.txt")
+	assert.NoErr(t, err)
+
+	assert.NoErr(t, bucket.BackupBucket(test.client, backup, bucket.BackupOptions{NowFunc: func() time.Time { return test.now }}))
+
+	// primary bucket is lost, and restored once the lock has run out
+	test.setNow(restoreAt)
+	backup.SetNow(restoreAt)
+	test.primaryS3.Reset()
+
+	plan, err := bucket.RestoreFromBackup(backup, test.client)
+	assert.NoErr(t, err)
+	assert.Equal(t, 2, len(plan.Uploads))
+
+	backupMeta, err := backup.HeadObject(upload.Key, "")
+	assert.NoErr(t, err)
+	assert.Equal(t, restoreAt.Add(-2*time.Hour).Truncate(time.Second), backupMeta.ObjectLockRetainUntilDate)
+
+	primaryMeta, err := test.client.HeadObject(upload.Key, "")
+	assert.NoErr(t, err)
+	assert.Equal(t, backupMeta.PickleID, primaryMeta.PickleID)
+	assert.True(t, primaryMeta.ObjectLockRetainUntilDate.IsZero())
+}
@@ -0,0 +1,217 @@
+package bucket
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/bradenrayhorn/pickle/s3"
+	"github.com/segmentio/ksuid"
+)
+
+const sharePrefix = "_pickle/share/"
+
+type presigner interface {
+	PresignGet(key string, versionID string, expiry time.Duration) (string, error)
+}
+
+type ShareResult struct {
+	URL     string    `json:"url"`
+	Expires time.Time `json:"expires"`
+	// Identity is the age secret key that decrypts the shared copy. It is empty when the file
+	// was shared to a recipient's own public key.
+	Identity     string `json:"identity"`
+	Instructions string `json:"instructions"`
+}
+
+// ShareFile creates a time-limited download link for a file. The bucket's own key can't be
+// handed out, so the file is encrypted again for recipient, an age public key, and uploaded as a
+// separate copy. Without a recipient a new key is generated and returned with the link. Expired
+// copies are removed by maintenance.
+func (b *Bucket) ShareFile(bucketKey string, recipient string, expiry time.Duration) (ShareResult, error) {
+	if b.key == nil {
+		return ShareResult{}, fmt.Errorf("key is not configured")
+	}
+
+	storage, ok := b.storage.(presigner)
+	if !ok {
+		return ShareResult{}, fmt.Errorf("storage does not support sharing")
+	}
+
+	if expiry < time.Second || expiry > s3.MaxPresignExpiry {
+		return ShareResult{}, fmt.Errorf("share expiry must be between 1 second and %s", s3.MaxPresignExpiry)
+	}
+
+	var identity *age.X25519Identity
+	var shareRecipient age.Recipient
+	if recipient != "" {
+		parsed, err := age.ParseX25519Recipient(recipient)
+		if err != nil {
+			return ShareResult{}, fmt.Errorf("parse recipient: %w", err)
+		}
+		shareRecipient = parsed
+	} else {
+		generated, err := age.GenerateX25519Identity()
+		if err != nil {
+			return ShareResult{}, fmt.Errorf("generate share key: %w", err)
+		}
+		identity = generated
+		shareRecipient = generated.Recipient()
+	}
+
+	versionID, err := b.getObjectVersionForKey(bucketKey)
+	if err != nil {
+		return ShareResult{}, err
+	}
+
+	meta, err := b.storage.HeadObject(bucketKey, versionID)
+	if err != nil {
+		return ShareResult{}, fmt.Errorf("get meta %s: %w", bucketKey, err)
+	}
+
+	expires := b.now().Add(expiry)
+	shareID, err := ksuid.NewRandomWithTime(b.now())
+	if err != nil {
+		return ShareResult{}, fmt.Errorf("generate share id: %w", err)
+	}
+	shareKey := fmt.Sprintf("%s%d/%s.age", sharePrefix, expires.Unix(), shareID.String())
+
+	if err := b.uploadShare(bucketKey, versionID, shareKey, shareRecipient); err != nil {
+		return ShareResult{}, err
+	}
+
+	url, err := storage.PresignGet(shareKey, "", expiry)
+	if err != nil {
+		return ShareResult{}, fmt.Errorf("presign %s: %w", shareKey, err)
+	}
+
+	result := ShareResult{URL: url, Expires: expires}
+	if identity != nil {
+		result.Identity = identity.String()
+	}
+	result.Instructions = shareInstructions(bucketKey, url, meta.PickleCompression, identity != nil)
+
+	return result, nil
+}
+
+// uploadShare decrypts an object and encrypts it again for recipient. The content stays
+// compressed, the recipient decompresses it after decrypting.
+func (b *Bucket) uploadShare(bucketKey string, versionID string, shareKey string, recipient age.Recipient) error {
+	workingDir, err := os.MkdirTemp("", "pickle-*")
+	if err != nil {
+		return fmt.Errorf("make working: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(workingDir) }()
+
+	objectReader, err := b.storage.GetObject(bucketKey, versionID)
+	if err != nil {
+		return fmt.Errorf("get object %s: %w", bucketKey, err)
+	}
+	defer func() { _ = objectReader.Close() }()
+
+	decryptedReader, err := age.Decrypt(objectReader, b.key)
+	if err != nil {
+		return fmt.Errorf("decrypt %s: %w", bucketKey, err)
+	}
+
+	sharePath := filepath.Join(workingDir, "share.age")
+	share, err := os.Create(sharePath)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", sharePath, err)
+	}
+	defer func() { _ = share.Close() }()
+
+	crc32cHash := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	sha256Hash := sha256.New()
+	w, err := age.Encrypt(io.MultiWriter(share, crc32cHash, sha256Hash), recipient)
+	if err != nil {
+		return fmt.Errorf("age encrypt: %w", err)
+	}
+	if _, err := io.Copy(w, decryptedReader); err != nil {
+		return fmt.Errorf("copy to age: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("close writer: %w", err)
+	}
+
+	size, err := share.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := share.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	// shares are not locked so that maintenance can remove them once they expire
+	_, err = b.storage.PutObjectWithMetadata(shareKey, share, size, crc32cHash.Sum(nil), sha256Hash.Sum(nil), nil, nil)
+	if err != nil {
+		return fmt.Errorf("upload share: %w", err)
+	}
+
+	return nil
+}
+
+func shareInstructions(bucketKey string, url string, compression string, withIdentity bool) string {
+	name, _ := splitDataKey(bucketKey)
+	name = path.Base(name)
+
+	identityFile := "your-key.txt"
+	if withIdentity {
+		identityFile = "key.txt"
+	}
+
+	var b strings.Builder
+	if withIdentity {
+		b.WriteString("Save the key to key.txt, then run:\n\n")
+	} else {
+		b.WriteString("Run:\n\n")
+	}
+	fmt.Fprintf(&b, "curl -o %s '%s'\n", shellQuote(name+".age"), url)
+
+	decrypt := fmt.Sprintf("age -d -i %s %s", identityFile, shellQuote(name+".age"))
+	switch compression {
+	case CompressionGzip:
+		decrypt += " | gunzip"
+	case CompressionZstd:
+		decrypt += " | zstd -d"
+	}
+	fmt.Fprintf(&b, "%s > %s\n", decrypt, shellQuote(name))
+
+	return b.String()
+}
+
+func shellQuote(s string) string {
+	safe := strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./", r))
+	}) == -1
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// expiredShares returns the shared copies whose links have expired.
+func expiredShares(versions []s3.VersionInfo, now time.Time) []s3.ObjectIdentifier {
+	expired := []s3.ObjectIdentifier{}
+	for _, version := range versions {
+		rest, ok := strings.CutPrefix(version.Key, sharePrefix)
+		if !ok {
+			continue
+		}
+
+		expiresAt, _, _ := strings.Cut(rest, "/")
+		expires, err := strconv.ParseInt(expiresAt, 10, 64)
+		if err != nil || now.Unix() > expires {
+			expired = append(expired, s3.ObjectIdentifier{Key: version.Key, VersionID: version.VersionId})
+		}
+	}
+	return expired
+}
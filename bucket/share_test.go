@@ -0,0 +1,145 @@
+package bucket_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/bradenrayhorn/pickle/bucket"
+	"github.com/bradenrayhorn/pickle/internal/memstorage"
+	"github.com/bradenrayhorn/pickle/internal/testutils/assert"
+)
+
+func downloadShare(t *testing.T, url string) (int, []byte) {
+	resp, err := http.Get(url)
+	assert.NoErr(t, err)
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	assert.NoErr(t, err)
+	return resp.StatusCode, body
+}
+
+func TestShareFile(t *testing.T) {
+	test := newTest(t)
+	test.setCompression(bucket.CompressionGzip)
+
+	filePath := path.Join(test.workingDir, "file.txt")
+	assert.NoErr(t, os.WriteFile(filePath, []byte("abc"), 0600))
+	upload, err := test.bucket.UploadFile(filePath, "folder/report.txt")
+	assert.NoErr(t, err)
+
+	share, err := test.bucket.ShareFile(upload.Key, "", time.Hour)
+	assert.NoErr(t, err)
+	assert.Equal(t, test.now.Add(time.Hour), share.Expires)
+	assert.True(t, strings.Contains(share.Instructions, "curl -o report.txt.age '"+share.URL+"'"))
+	assert.True(t, strings.Contains(share.Instructions, "age -d -i key.txt report.txt.age | gunzip > report.txt"))
+
+	// the link works without credentials, and the generated key decrypts it
+	status, body := downloadShare(t, share.URL)
+	assert.Equal(t, http.StatusOK, status)
+
+	identity, err := age.ParseX25519Identity(share.Identity)
+	assert.NoErr(t, err)
+	decrypted, err := age.Decrypt(bytes.NewReader(body), identity)
+	assert.NoErr(t, err)
+	decompressed, err := gzip.NewReader(decrypted)
+	assert.NoErr(t, err)
+	content, err := io.ReadAll(decompressed)
+	assert.NoErr(t, err)
+	assert.Equal(t, "abc", string(content))
+
+	// the bucket's own key can't decrypt the shared copy
+	_, err = age.Decrypt(bytes.NewReader(body), test.key)
+	assert.ErrContains(t, err, "no identity matched")
+
+	// the shared copy is not listed as a file
+	files, err := test.bucket.GetFiles()
+	assert.NoErr(t, err)
+	assert.Equal(t, 1, len(files))
+
+	// once expired, the link stops working and maintenance removes the copy
+	test.setNow(test.now.Add(2 * time.Hour))
+	status, _ = downloadShare(t, share.URL)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	test.runMaintenance()
+	versions, err := test.client.ListAllObjectVersions("_pickle/share/")
+	assert.NoErr(t, err)
+	assert.Equal(t, 0, len(versions.Versions))
+}
+
+func TestShareFileToRecipient(t *testing.T) {
+	test := newTest(t)
+
+	filePath := path.Join(test.workingDir, "file.txt")
+	assert.NoErr(t, os.WriteFile(filePath, []byte("abc"), 0600))
+	upload, err := test.bucket.UploadFile(filePath, "report.txt")
+	assert.NoErr(t, err)
+
+	recipient, err := age.GenerateX25519Identity()
+	assert.NoErr(t, err)
+
+	share, err := test.bucket.ShareFile(upload.Key, recipient.Recipient().String(), time.Hour)
+	assert.NoErr(t, err)
+	assert.Equal(t, "", share.Identity)
+	assert.True(t, strings.Contains(share.Instructions, "age -d -i your-key.txt report.txt.age > report.txt"))
+
+	status, body := downloadShare(t, share.URL)
+	assert.Equal(t, http.StatusOK, status)
+
+	decrypted, err := age.Decrypt(bytes.NewReader(body), recipient)
+	assert.NoErr(t, err)
+	content, err := io.ReadAll(decrypted)
+	assert.NoErr(t, err)
+	assert.Equal(t, "abc", string(content))
+
+	// unexpired shares are kept by maintenance
+	test.runMaintenance()
+	versions, err := test.client.ListAllObjectVersions("_pickle/share/")
+	assert.NoErr(t, err)
+	assert.Equal(t, 1, len(versions.Versions))
+}
+
+func TestSharedCopiesAreNotBackedUp(t *testing.T) {
+	test := newTest(t)
+
+	filePath := path.Join(test.workingDir, "file.txt")
+	assert.NoErr(t, os.WriteFile(filePath, []byte("abc"), 0600))
+	upload, err := test.bucket.UploadFile(filePath, "report.txt")
+	assert.NoErr(t, err)
+
+	_, err = test.bucket.ShareFile(upload.Key, "", time.Hour)
+	assert.NoErr(t, err)
+
+	backup := memstorage.New()
+	backup.SetNow(test.now)
+	assert.NoErr(t, bucket.BackupBucket(test.client, backup, bucket.BackupOptions{}))
+
+	versions, err := backup.ListAllObjectVersions("_pickle/share/")
+	assert.NoErr(t, err)
+	assert.Equal(t, 0, len(versions.Versions))
+	assert.Equal(t, 1, len(backup.GetVersions(upload.Key)))
+
+	// and verify does not miss them
+	report, err := bucket.VerifyBackup(test.client, backup, bucket.VerifyOptions{})
+	assert.NoErr(t, err)
+	assert.Equal(t, 0, len(report.Mismatches))
+}
+
+func TestShareFileNeedsPresigning(t *testing.T) {
+	key, err := age.GenerateX25519Identity()
+	assert.NoErr(t, err)
+	b, err := bucket.New(&bucket.Config{Storage: memstorage.New(), Key: key})
+	assert.NoErr(t, err)
+
+	_, err = b.ShareFile("report.txt.age.1", "", time.Hour)
+	assert.ErrContains(t, err, "storage does not support sharing")
+}
@@ -0,0 +1,73 @@
+package bucket
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/bradenrayhorn/pickle/s3"
+)
+
+// Storage is the versioned, lockable object store that a bucket lives in. *s3.Client is the
+// primary implementation.
+type Storage interface {
+	ListAllObjectVersions(prefix string) (*s3.ListAllObjectVersionsResult, error)
+	GetObject(key string, versionID string) (io.ReadCloser, error)
+	HeadObject(key string, versionID string) (*s3.ObjectMetadata, error)
+	PutObjectWithMetadata(key string, data io.ReadSeeker, dataLength int64, crc32cChecksum []byte, sha256Checksum []byte, retention *s3.ObjectLockRetention, metadata map[string]string) (*s3.PutObjectResponse, error)
+	PutObjectRetention(key string, versionID string, retention *s3.ObjectLockRetention) error
+	DeleteObjects(objects []s3.ObjectIdentifier) (*s3.DeleteObjectsResult, error)
+
+	// GetObjectStream and PutObjectStream copy an object as-is, including its metadata and lock.
+	GetObjectStream(key string, versionID string) (*s3.ObjectStream, error)
+	PutObjectStream(key string, stream *s3.ObjectStream) error
+}
+
+var _ Storage = (*s3.Client)(nil)
+
+// copyObject copies an object between two storages, keeping its metadata and lock. Locks that
+// have expired at now are left out, as storage refuses to lock an object in the past.
+func copyObject(to Storage, toKey string, from Storage, key string, versionID string, now time.Time) error {
+	if toClient, ok := to.(*s3.Client); ok {
+		if fromClient, ok := from.(*s3.Client); ok {
+			// Buckets on the same endpoint can copy without downloading the object, if the
+			// credentials are allowed to.
+			if toClient.SharesEndpointWith(fromClient) {
+				err := serverSideCopy(toClient, toKey, fromClient, key, versionID, now)
+				if !errors.Is(err, s3.ErrCopyNotAllowed) {
+					return err
+				}
+				slog.Warn("server-side copy not allowed, streaming instead", "key", key, "error", err)
+			}
+
+			// S3 to S3 copies can retry the whole transfer.
+			return toClient.StreamObjectTo(toKey, key, versionID, fromClient, now)
+		}
+	}
+
+	stream, err := from.GetObjectStream(key, versionID)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = stream.Body.Close() }()
+
+	if stream.Retention.ExpiredAt(now) {
+		stream.Retention = nil
+	}
+
+	return to.PutObjectStream(toKey, stream)
+}
+
+func serverSideCopy(to *s3.Client, toKey string, from *s3.Client, key string, versionID string, now time.Time) error {
+	source, err := from.CopySourceFor(key, versionID)
+	if err != nil {
+		return err
+	}
+	if source.Retention.ExpiredAt(now) {
+		source.Retention = nil
+	}
+
+	_, err = to.CopyObject(toKey, source)
+	return err
+}
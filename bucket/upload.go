@@ -1,7 +1,6 @@
 package bucket
 
 import (
-	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
@@ -9,120 +8,163 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"regexp"
-	"time"
+	"strings"
+	"unicode"
 
 	"filippo.io/age"
 	"github.com/bradenrayhorn/pickle/s3"
 	"github.com/segmentio/ksuid"
 )
 
-func (b *Bucket) UploadFile(diskPath string, targetPath string) error {
+type UploadResult struct {
+	Key string `json:"key"`
+	// Unchanged is set when the newest file at the path already had identical content. Nothing
+	// is uploaded in that case, the existing file's lock is extended instead.
+	Unchanged bool `json:"unchanged"`
+}
+
+func (b *Bucket) UploadFile(diskPath string, targetPath string) (UploadResult, error) {
 	if b.key == nil {
-		return fmt.Errorf("key is not configured")
+		return UploadResult{}, fmt.Errorf("key is not configured")
+	}
+
+	contentHMAC, err := b.contentHMAC(diskPath)
+	if err != nil {
+		return UploadResult{}, err
+	}
+
+	lockTime := b.lockRetention()
+
+	// skip the upload if the content is already stored at this path
+	existingKey, err := b.findIdenticalFile(cleanKeyName(targetPath), contentHMAC)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	if existingKey != "" {
+		if err := b.extendLock(existingKey, lockTime); err != nil {
+			return UploadResult{}, err
+		}
+		return UploadResult{Key: existingKey, Unchanged: true}, nil
+	}
+
+	key, err := b.uploadFile(diskPath, targetPath, contentHMAC, lockTime)
+	if err != nil {
+		return UploadResult{}, err
 	}
+	return UploadResult{Key: key}, nil
+}
 
+func (b *Bucket) uploadFile(diskPath string, targetPath string, contentHMAC string, lockTime *s3.ObjectLockRetention) (string, error) {
 	workingDir, err := os.MkdirTemp("", "pickle-*")
 	if err != nil {
-		return fmt.Errorf("make working: %w", err)
+		return "", fmt.Errorf("make working: %w", err)
 	}
 	defer func() { _ = os.RemoveAll(workingDir) }()
 
 	src, err := os.Open(diskPath)
 	if err != nil {
-		return fmt.Errorf("open file at %s: %w", diskPath, err)
+		return "", fmt.Errorf("open file at %s: %w", diskPath, err)
 	}
+	defer func() { _ = src.Close() }()
 
 	archivePath := filepath.Join(workingDir, "archive.age")
 	archive, err := os.Create(archivePath)
 	if err != nil {
-		return fmt.Errorf("create %s: %w", archivePath, err)
+		return "", fmt.Errorf("create %s: %w", archivePath, err)
 	}
 	defer func() { _ = archive.Close() }()
 
 	w, err := age.Encrypt(archive, b.key.Recipient())
 	if err != nil {
-		return fmt.Errorf("age encrypt: %w", err)
+		return "", fmt.Errorf("age encrypt: %w", err)
+	}
+
+	compression := b.compressionFor(targetPath)
+	cw, err := b.compressWriter(w, compression)
+	if err != nil {
+		return "", fmt.Errorf("compress: %w", err)
 	}
 
-	_, err = io.Copy(w, src)
+	_, err = io.Copy(cw, src)
 	if err != nil {
-		return fmt.Errorf("copy to age: %w", err)
+		return "", fmt.Errorf("copy to age: %w", err)
 	}
 
+	if err := cw.Close(); err != nil {
+		return "", fmt.Errorf("close compressor: %w", err)
+	}
 	if err := w.Close(); err != nil {
-		return fmt.Errorf("close writer: %w", err)
+		return "", fmt.Errorf("close writer: %w", err)
 	}
 	if err := archive.Close(); err != nil {
-		return fmt.Errorf("close encrypted file: %w", err)
+		return "", fmt.Errorf("close encrypted file: %w", err)
 	}
 
 	stat, err := os.Stat(archivePath)
 	if err != nil {
-		return fmt.Errorf("file stat: %w", err)
+		return "", fmt.Errorf("file stat: %w", err)
 	}
 
 	archive, err = os.Open(archivePath)
 	if err != nil {
-		return fmt.Errorf("open %s: %w", archivePath, err)
+		return "", fmt.Errorf("open %s: %w", archivePath, err)
 	}
 	defer func() { _ = archive.Close() }()
 
 	// get crc32c checksum
 	checksum := crc32.New(crc32.MakeTable(crc32.Castagnoli))
 	if _, err := io.Copy(checksum, archive); err != nil {
-		return err
+		return "", err
 	}
 	if _, err := archive.Seek(0, io.SeekStart); err != nil {
-		return err
+		return "", err
 	}
 	crc32cSum := checksum.Sum(nil)
 
 	// get shasum
 	hash := sha256.New()
 	if _, err := io.Copy(hash, archive); err != nil {
-		return err
+		return "", err
 	}
 	if _, err := archive.Seek(0, io.SeekStart); err != nil {
-		return err
+		return "", err
 	}
 	sha256Sum := hash.Sum(nil)
 	sha256SumHex := []byte(hex.EncodeToString(sha256Sum))
 
-	lockTime := &s3.ObjectLockRetention{
-		Mode:  "COMPLIANCE",
-		Until: b.now().Add(time.Hour * time.Duration(b.objectLockHours)),
+	// findIdenticalFile picks the newest file by its ID, so IDs follow the bucket's clock
+	fileID, err := ksuid.NewRandomWithTime(b.now())
+	if err != nil {
+		return "", fmt.Errorf("generate file id: %w", err)
 	}
-
-	fileID := ksuid.New()
 	keyName := cleanKeyName(targetPath + ".age." + fileID.String())
 
-	_, err = b.client.PutObject(keyName, archive, stat.Size(), crc32cSum, sha256Sum, lockTime)
-	if err != nil {
-		return fmt.Errorf("upload to s3: %w", err)
+	metadata := map[string]string{
+		"pickle-content-hmac": contentHMAC,
+	}
+	if compression != CompressionNone {
+		metadata["pickle-compression"] = compression
 	}
 
-	sha256SHA256Checksum := sha256.Sum256(sha256SumHex)
-	sha256CRC32Cchecksum := crc32.New(crc32.MakeTable(crc32.Castagnoli))
-	_, err = sha256CRC32Cchecksum.Write(sha256SumHex)
+	_, err = b.storage.PutObjectWithMetadata(keyName, archive, stat.Size(), crc32cSum, sha256Sum, lockTime, metadata)
 	if err != nil {
-		return fmt.Errorf("crc32c checksum: %w", err)
+		return "", fmt.Errorf("upload to s3: %w", err)
 	}
-	_, err = b.client.PutObject(getChecksumPath(keyName), bytes.NewReader(sha256SumHex), int64(len(sha256SumHex)), sha256CRC32Cchecksum.Sum(nil), sha256SHA256Checksum[:], lockTime)
+
+	_, err = putBytes(b.storage, getChecksumPath(keyName), sha256SumHex, lockTime)
 	if err != nil {
-		return fmt.Errorf("upload to s3: %w", err)
+		return "", fmt.Errorf("upload to s3: %w", err)
 	}
-	return nil
+	return keyName, nil
 }
 
-var (
-	whitespaceRegex = regexp.MustCompile(`\s+`)
-	unsafeRegex     = regexp.MustCompile(`[^0-9a-zA-Z!\-_.*'()/]`)
-)
-
+// cleanKeyName makes a path safe to use as an object key. Any printable character can be
+// signed, so only control characters and invalid UTF-8 are removed.
 func cleanKeyName(input string) string {
-	result := whitespaceRegex.ReplaceAllString(input, "_")
-	result = unsafeRegex.ReplaceAllString(result, "")
-
-	return result
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.ToValidUTF8(input, ""))
 }
@@ -1,10 +1,16 @@
 package bucket_test
 
 import (
+	"encoding/hex"
 	"os"
 	"path"
+	"strings"
 	"testing"
+	"time"
 
+	"filippo.io/age"
+	"github.com/bradenrayhorn/pickle/bucket"
+	"github.com/bradenrayhorn/pickle/internal/memstorage"
 	"github.com/bradenrayhorn/pickle/internal/testutils/assert"
 )
 
@@ -17,7 +23,7 @@ func TestUploadAndDownload(t *testing.T) {
 	assert.NoErr(t, err)
 
 	// upload
-	err = test.bucket.UploadFile(filePath, "here.txt")
+	_, err = test.bucket.UploadFile(filePath, "here.txt")
 	assert.NoErr(t, err)
 
 	// get the file
@@ -48,7 +54,7 @@ func TestUploadAndDownloadWithNestedPaths(t *testing.T) {
 	assert.NoErr(t, err)
 
 	// upload
-	err = test.bucket.UploadFile(filePath, "in-folder/here.txt")
+	_, err = test.bucket.UploadFile(filePath, "in-folder/here.txt")
 	assert.NoErr(t, err)
 
 	// get the file
@@ -70,6 +76,33 @@ func TestUploadAndDownloadWithNestedPaths(t *testing.T) {
 	assert.Equal(t, "abc", string(downloaded))
 }
 
+func TestUploadAndDownloadWithUnusualPaths(t *testing.T) {
+	test := newTest(t)
+
+	filePath := path.Join(test.workingDir, "file.txt")
+	err := os.WriteFile(filePath, []byte("abc"), 0600)
+	assert.NoErr(t, err)
+
+	// spaces, unicode and reserved characters are kept, control characters are removed
+	_, err = test.bucket.UploadFile(filePath, "my folder/Résumé (final) 1+1=2?\t.txt")
+	assert.NoErr(t, err)
+
+	files, err := test.bucket.GetFiles()
+	assert.NoErr(t, err)
+	assert.Equal(t, 1, len(files))
+	upload := files[0]
+
+	assert.Equal(t, "my folder/Résumé (final) 1+1=2?.txt", upload.Path)
+
+	downloadPath := path.Join(test.workingDir, "out.txt")
+	err = test.bucket.DownloadFile(upload.Key, downloadPath)
+	assert.NoErr(t, err)
+
+	downloaded, err := os.ReadFile(downloadPath)
+	assert.NoErr(t, err)
+	assert.Equal(t, "abc", string(downloaded))
+}
+
 func TestDownloadVerifiesChecksum(t *testing.T) {
 	test := newTest(t)
 
@@ -79,7 +112,7 @@ func TestDownloadVerifiesChecksum(t *testing.T) {
 	assert.NoErr(t, err)
 
 	// upload
-	err = test.bucket.UploadFile(filePath, "here.txt")
+	_, err = test.bucket.UploadFile(filePath, "here.txt")
 	assert.NoErr(t, err)
 
 	// get file
@@ -97,3 +130,193 @@ func TestDownloadVerifiesChecksum(t *testing.T) {
 	err = test.bucket.DownloadFile(upload.Key, downloadPath)
 	assert.ErrContains(t, err, "checksums do not match")
 }
+
+func TestUploadSkipsIdenticalContent(t *testing.T) {
+	test := newTest(t)
+	test.setNow(time.Date(2025, time.June, 20, 0, 0, 0, 0, time.UTC))
+	test.setObjectLockHours(5)
+
+	// create file to upload
+	filePath := path.Join(test.workingDir, "file.txt")
+	err := os.WriteFile(filePath, []byte("abc"), 0600)
+	assert.NoErr(t, err)
+
+	// upload
+	first, err := test.bucket.UploadFile(filePath, "here.txt")
+	assert.NoErr(t, err)
+	assert.Equal(t, false, first.Unchanged)
+
+	// upload the same content an hour later
+	test.setNow(test.now.Add(time.Hour))
+	second, err := test.bucket.UploadFile(filePath, "here.txt")
+	assert.NoErr(t, err)
+	assert.Equal(t, true, second.Unchanged)
+	assert.Equal(t, first.Key, second.Key)
+
+	// nothing new was uploaded, but the lock was extended
+	files, err := test.bucket.GetFiles()
+	assert.NoErr(t, err)
+	assert.Equal(t, 1, len(files))
+
+	time6AM := time.Date(2025, time.June, 20, 6, 0, 0, 0, time.UTC)
+	assert.HasOneVersion(t, test.primaryS3.GetVersions(first.Key), time6AM)
+	assert.HasOneVersion(t, test.primaryS3.GetVersions(hexChecksumPath(first.Key)), time6AM)
+
+	// the same content at another path is uploaded
+	other, err := test.bucket.UploadFile(filePath, "there.txt")
+	assert.NoErr(t, err)
+	assert.Equal(t, false, other.Unchanged)
+
+	// changed content is uploaded
+	test.setNow(test.now.Add(time.Hour))
+	err = os.WriteFile(filePath, []byte("def"), 0600)
+	assert.NoErr(t, err)
+	third, err := test.bucket.UploadFile(filePath, "here.txt")
+	assert.NoErr(t, err)
+	assert.Equal(t, false, third.Unchanged)
+	assert.NotEqual(t, first.Key, third.Key)
+
+	// going back to the original content is a new upload, since it is not the newest file
+	test.setNow(test.now.Add(time.Hour))
+	err = os.WriteFile(filePath, []byte("abc"), 0600)
+	assert.NoErr(t, err)
+	fourth, err := test.bucket.UploadFile(filePath, "here.txt")
+	assert.NoErr(t, err)
+	assert.Equal(t, false, fourth.Unchanged)
+}
+
+func TestUploadDoesNotSkipTrashedContent(t *testing.T) {
+	test := newTest(t)
+
+	// create file to upload
+	filePath := path.Join(test.workingDir, "file.txt")
+	err := os.WriteFile(filePath, []byte("abc"), 0600)
+	assert.NoErr(t, err)
+
+	// upload and trash it
+	first, err := test.bucket.UploadFile(filePath, "here.txt")
+	assert.NoErr(t, err)
+	assert.NoErr(t, test.bucket.DeleteFile(first.Key))
+
+	// uploading again creates a new file
+	second, err := test.bucket.UploadFile(filePath, "here.txt")
+	assert.NoErr(t, err)
+	assert.Equal(t, false, second.Unchanged)
+	assert.NotEqual(t, first.Key, second.Key)
+}
+
+func hexChecksumPath(key string) string {
+	return "_pickle/checksum/" + hex.EncodeToString([]byte(key)) + ".sha256"
+}
+
+func TestUploadAndDownloadWithCompression(t *testing.T) {
+	for _, compression := range []string{bucket.CompressionGzip, bucket.CompressionZstd} {
+		t.Run(compression, func(t *testing.T) {
+			test := newTest(t)
+			test.setCompression(compression)
+
+			// create a file that compresses well
+			filePath := path.Join(test.workingDir, "file.txt")
+			contents := strings.Repeat("pickle ", 1000)
+			err := os.WriteFile(filePath, []byte(contents), 0600)
+			assert.NoErr(t, err)
+
+			// upload
+			upload, err := test.bucket.UploadFile(filePath, "here.txt")
+			assert.NoErr(t, err)
+
+			// the stored object is compressed and marked as such
+			versions := test.primaryS3.GetVersions(upload.Key)
+			assert.Equal(t, 1, len(versions))
+			assert.Equal(t, compression, versions[0].Meta["pickle-compression"])
+			assert.True(t, len(versions[0].Content) < len(contents))
+
+			// download the file
+			downloadPath := path.Join(test.workingDir, "out.txt")
+			err = test.bucket.DownloadFile(upload.Key, downloadPath)
+			assert.NoErr(t, err)
+
+			downloaded, err := os.ReadFile(downloadPath)
+			assert.NoErr(t, err)
+			assert.Equal(t, contents, string(downloaded))
+
+			// compressed files can still be downloaded once compression is turned off
+			test.setCompression(bucket.CompressionNone)
+			err = test.bucket.DownloadFile(upload.Key, downloadPath)
+			assert.NoErr(t, err)
+
+			downloaded, err = os.ReadFile(downloadPath)
+			assert.NoErr(t, err)
+			assert.Equal(t, contents, string(downloaded))
+		})
+	}
+}
+
+func TestUploadSkipsCompressionForCompressedTypes(t *testing.T) {
+	test := newTest(t)
+	test.setCompression(bucket.CompressionGzip)
+
+	filePath := path.Join(test.workingDir, "file.zip")
+	err := os.WriteFile(filePath, []byte("abc"), 0600)
+	assert.NoErr(t, err)
+
+	upload, err := test.bucket.UploadFile(filePath, "archive.ZIP")
+	assert.NoErr(t, err)
+
+	versions := test.primaryS3.GetVersions(upload.Key)
+	assert.Equal(t, 1, len(versions))
+	assert.Equal(t, "", versions[0].Meta["pickle-compression"])
+
+	downloadPath := path.Join(test.workingDir, "out.zip")
+	err = test.bucket.DownloadFile(upload.Key, downloadPath)
+	assert.NoErr(t, err)
+
+	downloaded, err := os.ReadFile(downloadPath)
+	assert.NoErr(t, err)
+	assert.Equal(t, "abc", string(downloaded))
+}
+
+func TestInvalidCompressionIsRejected(t *testing.T) {
+	test := newTest(t)
+
+	_, err := bucket.New(&bucket.Config{Storage: test.client, Key: test.key, Compression: "lzma"})
+	assert.ErrContains(t, err, "unsupported compression")
+
+	_, err = bucket.New(&bucket.Config{Storage: test.client, Key: test.key, Compression: bucket.CompressionGzip, CompressionLevel: 12})
+	assert.ErrContains(t, err, "compression level")
+
+	_, err = bucket.New(&bucket.Config{Storage: test.client, Key: test.key, Compression: bucket.CompressionZstd, CompressionLevel: 23})
+	assert.ErrContains(t, err, "compression level")
+}
+
+func TestUploadAndDownloadWithMemoryStorage(t *testing.T) {
+	key, err := age.GenerateX25519Identity()
+	assert.NoErr(t, err)
+
+	b, err := bucket.New(&bucket.Config{Storage: memstorage.New(), Key: key})
+	assert.NoErr(t, err)
+
+	// create file to upload
+	workingDir := t.TempDir()
+	filePath := path.Join(workingDir, "file.txt")
+	err = os.WriteFile(filePath, []byte("abc"), 0600)
+	assert.NoErr(t, err)
+
+	// upload
+	upload, err := b.UploadFile(filePath, "here.txt")
+	assert.NoErr(t, err)
+
+	files, err := b.GetFiles()
+	assert.NoErr(t, err)
+	assert.Equal(t, 1, len(files))
+	assert.Equal(t, upload.Key, files[0].Key)
+
+	// download the file
+	downloadPath := path.Join(workingDir, "out.txt")
+	err = b.DownloadFile(upload.Key, downloadPath)
+	assert.NoErr(t, err)
+
+	downloaded, err := os.ReadFile(downloadPath)
+	assert.NoErr(t, err)
+	assert.Equal(t, "abc", string(downloaded))
+}
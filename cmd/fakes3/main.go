@@ -25,6 +25,11 @@ func main() {
 	signal.Notify(c, os.Interrupt)
 
 	server := fakes3.NewFakeS3(bucket)
+
+	// requests must be signed with these keys
+	if keyID := os.Getenv("FAKES3_ACCESS_KEY_ID"); keyID != "" {
+		server.SetCredentials(keyID, os.Getenv("FAKES3_SECRET_KEY"))
+	}
 	server.StartServerWithHostPort(host, port)
 
 	fmt.Printf("started fakeS3 at %s\n", server.GetEndpoint())
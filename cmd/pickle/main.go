@@ -4,19 +4,45 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
+	"filippo.io/age"
 	"github.com/bradenrayhorn/pickle/bucket"
 	"github.com/bradenrayhorn/pickle/connection"
+	"github.com/bradenrayhorn/pickle/localfs"
 	"github.com/bradenrayhorn/pickle/s3"
 )
 
 func main() {
 	maintainCmd := flag.NewFlagSet("maintain", flag.ExitOnError)
+	maintainDryRun := maintainCmd.Bool("dry-run", false, "print what maintenance would do without changing anything")
+	maintainJSON := maintainCmd.Bool("json", false, "print the report as JSON")
+	maintainRenewalWindowHours := maintainCmd.Int("renewal-window-hours", 0, "only extend locks that end within this many hours, needs the age key, 0 extends every lock")
 	backupCmd := flag.NewFlagSet("backup", flag.ExitOnError)
+	backupFromDir := backupCmd.String("from-dir", "", "back up from a local directory instead of the connection")
+	backupToDir := backupCmd.String("to-dir", "", "back up to a local directory instead of PICKLE_BACKUP_S3_*")
+	backupDryRun := backupCmd.Bool("dry-run", false, "print the backup plan without changing anything")
+	backupJSON := backupCmd.Bool("json", false, "print the dry-run plan as JSON")
+	backupDelete := backupCmd.Bool("delete", false, "delete objects from the target that are no longer in the source")
+	backupDeleteAfterDays := backupCmd.Int("delete-after-days", 0, "only delete objects that have been missing from the source for this many days")
+	backupMaxDelete := backupCmd.Int("max-delete", 0, "abort if more than this many objects would be deleted")
+	backupMaxDeletePercent := backupCmd.Float64("max-delete-percent", 0, "abort if more than this percent of the target would be deleted")
+	backupFullScan := backupCmd.Bool("full-scan", false, "ignore cached metadata and read every version")
+	backupTargets := backupCmd.String("targets", "", "back up to every target listed in this JSON file, in parallel")
+	verifyCmd := flag.NewFlagSet("backup verify", flag.ExitOnError)
+	verifyFromDir := verifyCmd.String("from-dir", "", "verify a backup of a local directory instead of the connection")
+	verifyToDir := verifyCmd.String("to-dir", "", "verify a backup in a local directory instead of PICKLE_BACKUP_S3_*")
+	verifyRehashPercent := verifyCmd.Float64("rehash-percent", 0, "download and hash this percent of the backed up objects")
+	verifyJSON := verifyCmd.Bool("json", false, "print the report as JSON")
+	restoreCmd := flag.NewFlagSet("restore-from-backup", flag.ExitOnError)
+	restoreFromDir := restoreCmd.String("from-dir", "", "restore from a backup in a local directory instead of PICKLE_BACKUP_S3_*")
+	restoreToDir := restoreCmd.String("to-dir", "", "restore into a local directory instead of the connection")
+	restoreDryRun := restoreCmd.Bool("dry-run", false, "print the restore plan without changing anything")
+	restoreJSON := restoreCmd.Bool("json", false, "print the plan as JSON")
 
 	// Check if a command was provided
 	if len(os.Args) < 2 {
-		fmt.Println("Expected 'maintain' or 'backup' command")
+		fmt.Println("Expected 'maintain', 'backup', 'restore-from-backup' or 'admin' command")
 		os.Exit(1)
 	}
 
@@ -35,39 +61,210 @@ func main() {
 			os.Exit(1)
 		}
 
-		bucket, err := bucket.New(config)
+		b, err := bucket.New(config)
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
 
-		if err := bucket.RunMaintenance(); err != nil {
+		report, err := b.RunMaintenance(bucket.MaintenanceOptions{
+			DryRun:        *maintainDryRun,
+			RenewalWindow: time.Duration(*maintainRenewalWindowHours) * time.Hour,
+		})
+		if printErr := printMaintenanceReport(os.Stdout, report, *maintainJSON); printErr != nil {
+			fmt.Println(printErr)
+			os.Exit(1)
+		}
+		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
 		return
 	case "backup":
+		if len(os.Args) > 2 && os.Args[2] == "verify" {
+			err := verifyCmd.Parse(os.Args[3:])
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			source, err := loadBackupSource(*verifyFromDir)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			target, err := loadBackupTarget(*verifyToDir)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			report, err := bucket.VerifyBackup(source, target, bucket.VerifyOptions{RehashPercent: *verifyRehashPercent})
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			if err := printVerifyReport(os.Stdout, report, *verifyJSON); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			if len(report.Mismatches) > 0 {
+				os.Exit(2)
+			}
+			return
+		}
+
 		err := backupCmd.Parse(os.Args[2:])
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
 
-		_, s3config, err := loadConfig()
+		source, err := loadBackupSource(*backupFromDir)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		options := bucket.BackupOptions{
+			Delete:           *backupDelete,
+			DeleteDelay:      time.Duration(*backupDeleteAfterDays) * 24 * time.Hour,
+			MaxDeletes:       *backupMaxDelete,
+			MaxDeletePercent: *backupMaxDeletePercent,
+			FullScan:         *backupFullScan,
+		}
+
+		if *backupTargets != "" {
+			if *backupToDir != "" {
+				fmt.Println("-targets and -to-dir cannot be used together")
+				os.Exit(1)
+			}
+
+			targets, err := loadBackupTargets(*backupTargets)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			run := bucket.BackupToTargets
+			if *backupDryRun {
+				run = bucket.PlanBackupToTargets
+			}
+
+			results, err := run(source, targets, options)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			failed, err := printBackupResults(os.Stdout, results, *backupDryRun, *backupJSON)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			if failed {
+				os.Exit(1)
+			}
+			return
+		}
+
+		target, err := loadBackupTarget(*backupToDir)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if *backupDryRun {
+			plan, err := bucket.PlanBackup(source, target, options)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			if err := printBackupPlan(os.Stdout, plan, *backupJSON); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		if err := bucket.BackupBucket(source, target, options); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	case "restore-from-backup":
+		err := restoreCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		// the backup target becomes the source, and the connection the target
+		backup, err := loadBackupTarget(*restoreFromDir)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		primary, err := loadBackupSource(*restoreToDir)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		restore := bucket.RestoreFromBackup
+		if *restoreDryRun {
+			restore = bucket.PlanRestore
+		}
+
+		plan, err := restore(backup, primary)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if err := printBackupPlan(os.Stdout, plan, *restoreJSON); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	case "admin":
+		// admin commands bypass GOVERNANCE locks, the credentials need s3:BypassGovernanceRetention
+		if len(os.Args) < 3 {
+			fmt.Println("Expected 'purge <key>' or 'shorten-retention' admin command")
+			os.Exit(1)
+		}
+
+		config, _, err := loadConfig()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		bucket, err := bucket.New(config)
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
-		backupTargetConfig := loadBackupTargetConfig()
 
-		if err := bucket.BackupBucket(s3config, backupTargetConfig); err != nil {
+		switch {
+		case os.Args[2] == "purge" && len(os.Args) == 4:
+			err = bucket.PurgeFile(os.Args[3])
+		case os.Args[2] == "shorten-retention" && len(os.Args) == 3:
+			err = bucket.ShortenRetention()
+		default:
+			fmt.Println("Expected 'purge <key>' or 'shorten-retention' admin command")
+			os.Exit(1)
+		}
+		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
 		return
 	default:
 		fmt.Printf("Unknown command: %s\n", os.Args[1])
-		fmt.Println("Expected 'maintain' or 'backup' command")
+		fmt.Println("Expected 'maintain', 'backup', 'restore-from-backup' or 'admin' command")
 		os.Exit(1)
 	}
 }
@@ -85,15 +282,60 @@ func loadConfig() (*bucket.Config, s3.Config, error) {
 		KeyID:        conn.KeyID,
 		KeySecret:    conn.KeySecret,
 		StorageClass: conn.StorageClass,
+
+		// without keys in the connection, credentials come from the environment
+		Credentials:     credentialsFor(conn.KeyID, os.Getenv("PICKLE_CREDENTIAL_PROCESS"), ""),
+		AddressingStyle: s3.AddressingStyle(conn.AddressingStyle),
+	}
+	if err := s3.ApplyTransportEnv(&s3config, "PICKLE_S3_"); err != nil {
+		return nil, s3.Config{}, err
+	}
+
+	// the key is optional here, maintenance only needs it to write the manifest
+	var key *age.X25519Identity
+	if conn.AgePrivateKey != "" {
+		key, err = age.ParseX25519Identity(conn.AgePrivateKey)
+		if err != nil {
+			return nil, s3.Config{}, fmt.Errorf("parse age identity: %w", err)
+		}
 	}
 
 	return &bucket.Config{
-		Client:          s3.NewClient(s3config),
+		Storage:         s3.NewClient(s3config),
+		Key:             key,
 		ObjectLockHours: conn.ObjectLockHours,
+		ObjectLockMode:  conn.ObjectLockMode,
+
+		Compression:      conn.Compression,
+		CompressionLevel: conn.CompressionLevel,
 	}, s3config, nil
 }
 
-func loadBackupTargetConfig() s3.Config {
+func loadBackupSource(dir string) (bucket.Storage, error) {
+	if dir != "" {
+		return localfs.New(dir)
+	}
+
+	config, _, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return config.Storage, nil
+}
+
+func loadBackupTarget(dir string) (bucket.Storage, error) {
+	if dir != "" {
+		return localfs.New(dir)
+	}
+
+	config, err := loadBackupTargetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return s3.NewClient(config), nil
+}
+
+func loadBackupTargetConfig() (s3.Config, error) {
 	config := s3.Config{
 		URL:          os.Getenv("PICKLE_BACKUP_S3_URL"),
 		Region:       os.Getenv("PICKLE_BACKUP_S3_REGION"),
@@ -101,7 +343,32 @@ func loadBackupTargetConfig() s3.Config {
 		KeySecret:    os.Getenv("PICKLE_BACKUP_S3_KEY_SECRET"),
 		Bucket:       os.Getenv("PICKLE_BACKUP_S3_BUCKET"),
 		StorageClass: os.Getenv("PICKLE_BACKUP_S3_STORAGE_CLASS"),
+
+		Credentials: credentialsFor(
+			os.Getenv("PICKLE_BACKUP_S3_KEY_ID"),
+			os.Getenv("PICKLE_BACKUP_S3_CREDENTIAL_PROCESS"),
+			os.Getenv("PICKLE_BACKUP_S3_PROFILE"),
+		),
+		AddressingStyle: s3.AddressingStyle(os.Getenv("PICKLE_BACKUP_S3_ADDRESSING_STYLE")),
+	}
+	if err := s3.ApplyTransportEnv(&config, "PICKLE_BACKUP_S3_"); err != nil {
+		return s3.Config{}, err
 	}
 
-	return config
+	return config, nil
+}
+
+// credentialsFor picks where credentials come from when a connection has no keys: a credential
+// process, a profile of the shared credentials file, or else the default chain.
+func credentialsFor(keyID, process, profile string) s3.CredentialsProvider {
+	switch {
+	case keyID != "":
+		return nil
+	case process != "":
+		return s3.ProcessCredentials{Command: process}
+	case profile != "":
+		return s3.SharedCredentials{Profile: profile}
+	default:
+		return s3.DefaultCredentials()
+	}
 }
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bradenrayhorn/pickle/bucket"
+)
+
+func printBackupPlan(w io.Writer, plan *bucket.BackupPlan, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(plan)
+	}
+
+	if plan.IsEmpty() && len(plan.PendingDeletes) == 0 {
+		_, err := fmt.Fprintln(w, "Everything is up to date, nothing to do.")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ACTION\tKEY\tVERSION\tDETAIL")
+	for _, object := range plan.Uploads {
+		_, _ = fmt.Fprintf(tw, "upload\t%s\t%s\t\n", object.Key, object.VersionID)
+	}
+	for _, extension := range plan.LockExtensions {
+		_, _ = fmt.Fprintf(tw, "extend lock\t%s\t%s\t%s -> %s\n", extension.Key, extension.VersionID, formatLockDate(extension.From), formatLockDate(extension.Until))
+	}
+	for _, object := range plan.Deletes {
+		_, _ = fmt.Fprintf(tw, "delete\t%s\t%s\tnot in source\n", object.Key, object.VersionID)
+	}
+	for _, object := range plan.Duplicates {
+		_, _ = fmt.Fprintf(tw, "delete\t%s\t%s\tduplicate\n", object.Key, object.VersionID)
+	}
+	for _, pending := range plan.PendingDeletes {
+		_, _ = fmt.Fprintf(tw, "pending delete\t%s\t%s\tafter %s\n", pending.Key, pending.VersionID, pending.DeleteAfter.Format(time.RFC3339))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "\n%d uploads, %d lock extensions, %d deletes, %d duplicates, %d pending deletes\n",
+		len(plan.Uploads), len(plan.LockExtensions), len(plan.Deletes), len(plan.Duplicates), len(plan.PendingDeletes))
+	return err
+}
+
+// printBackupResults prints the outcome of each target, and reports whether any of them failed.
+func printBackupResults(w io.Writer, results []bucket.BackupResult, dryRun bool, asJSON bool) (bool, error) {
+	failed := false
+	for _, result := range results {
+		if result.Err != nil {
+			failed = true
+		}
+	}
+
+	if asJSON {
+		type jsonResult struct {
+			Name  string             `json:"name"`
+			Plan  *bucket.BackupPlan `json:"plan"`
+			Error string             `json:"error,omitempty"`
+		}
+
+		out := []jsonResult{}
+		for _, result := range results {
+			r := jsonResult{Name: result.Name, Plan: result.Plan}
+			if result.Err != nil {
+				r.Error = result.Err.Error()
+			}
+			out = append(out, r)
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return failed, encoder.Encode(out)
+	}
+
+	for i, result := range results {
+		if dryRun && i > 0 {
+			_, _ = fmt.Fprintln(w)
+		}
+
+		if dryRun && result.Plan != nil && result.Err == nil {
+			_, _ = fmt.Fprintf(w, "== %s ==\n", result.Name)
+			if err := printBackupPlan(w, result.Plan, false); err != nil {
+				return failed, err
+			}
+			continue
+		}
+
+		switch {
+		case result.Err != nil:
+			_, _ = fmt.Fprintf(w, "%s: failed: %v\n", result.Name, result.Err)
+		case result.Plan != nil:
+			_, _ = fmt.Fprintf(w, "%s: ok, %d uploads, %d lock extensions, %d deletes, %d duplicates\n",
+				result.Name, len(result.Plan.Uploads), len(result.Plan.LockExtensions), len(result.Plan.Deletes), len(result.Plan.Duplicates))
+		default:
+			_, _ = fmt.Fprintf(w, "%s: ok\n", result.Name)
+		}
+	}
+
+	return failed, nil
+}
+
+func printMaintenanceReport(w io.Writer, report *bucket.MaintenanceReport, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ACTION\tKEY\tVERSION\tDETAIL")
+	for _, key := range report.RegistryRemovals {
+		_, _ = fmt.Fprintf(tw, "unregister\t%s\t\tno longer in bucket\n", key)
+	}
+	for _, object := range report.Extensions {
+		_, _ = fmt.Fprintf(tw, "extend lock\t%s\t%s\tuntil %s\n", object.Key, object.VersionID, formatLockDate(report.RetainUntil))
+	}
+	for _, object := range report.Deletes {
+		_, _ = fmt.Fprintf(tw, "delete\t%s\t%s\t%s\n", object.Key, object.VersionID, object.Reason)
+	}
+	for _, object := range report.Locked {
+		_, _ = fmt.Fprintf(tw, "keep\t%s\t%s\tstill locked\n", object.Key, object.VersionID)
+	}
+	for _, object := range report.Held {
+		_, _ = fmt.Fprintf(tw, "keep\t%s\t%s\tlegal hold\n", object.Key, object.VersionID)
+	}
+	for _, failure := range report.Failures {
+		_, _ = fmt.Fprintf(tw, "failed %s\t%s\t%s\t%s\n", failure.Step, failure.Key, failure.VersionID, failure.Error)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	prefix := ""
+	if report.DryRun {
+		prefix = "dry run: "
+	}
+	_, err := fmt.Fprintf(w, "\n%s%d registry removals, %d lock extensions (%d skipped), %d deletes, %d still locked, %d held, %d failures\n", prefix,
+		len(report.RegistryRemovals), len(report.Extensions), report.SkippedExtensions, len(report.Deletes), len(report.Locked), len(report.Held), len(report.Failures))
+	return err
+}
+
+func printVerifyReport(w io.Writer, report *bucket.VerifyReport, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	if len(report.Mismatches) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "PROBLEM\tKEY\tVERSION\tSOURCE\tTARGET")
+		for _, mismatch := range report.Mismatches {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", mismatch.Problem, mismatch.Key, mismatch.VersionID, mismatch.Source, mismatch.Target)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintln(w)
+	}
+
+	_, err := fmt.Fprintf(w, "%d objects checked, %d re-hashed, %d mismatches\n", report.Checked, report.Rehashed, len(report.Mismatches))
+	return err
+}
+
+func formatLockDate(t time.Time) string {
+	if t.IsZero() {
+		return "unlocked"
+	}
+	return t.Format(time.RFC3339)
+}
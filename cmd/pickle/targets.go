@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/bradenrayhorn/pickle/bucket"
+	"github.com/bradenrayhorn/pickle/localfs"
+	"github.com/bradenrayhorn/pickle/s3"
+)
+
+// targetsFile lists backup targets, for example:
+//
+//	{"targets": [
+//	  {"name": "b2", "s3": {"url": "...", "region": "...", "bucket": "...", "keyID": "...", "keySecret": "..."}},
+//	  {"name": "aws", "s3": {"url": "...", "region": "...", "bucket": "...", "profile": "backup", "stallTimeout": "5m"}},
+//	  {"name": "nas", "dir": "/mnt/nas/pickle"}
+//	]}
+type targetsFile struct {
+	Targets []struct {
+		Name string    `json:"name"`
+		Dir  string    `json:"dir"`
+		S3   *s3Target `json:"s3"`
+	} `json:"targets"`
+}
+
+type s3Target struct {
+	URL          string `json:"url"`
+	Region       string `json:"region"`
+	Bucket       string `json:"bucket"`
+	KeyID        string `json:"keyID"`
+	KeySecret    string `json:"keySecret"`
+	StorageClass string `json:"storageClass"`
+
+	// used instead of keyID and keySecret
+	CredentialProcess string `json:"credentialProcess"`
+	Profile           string `json:"profile"`
+
+	AddressingStyle string `json:"addressingStyle"`
+
+	Proxy  string `json:"proxy"`
+	CAFile string `json:"caFile"`
+	// in bytes per second
+	UploadRateLimit   int64 `json:"uploadRateLimit"`
+	DownloadRateLimit int64 `json:"downloadRateLimit"`
+	// durations such as "2m"
+	StallTimeout string `json:"stallTimeout"`
+	IdleTimeout  string `json:"idleTimeout"`
+}
+
+func loadBackupTargets(path string) ([]bucket.BackupTarget, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read targets: %w", err)
+	}
+
+	var file targetsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse targets: %w", err)
+	}
+
+	if len(file.Targets) == 0 {
+		return nil, fmt.Errorf("no targets in %s", path)
+	}
+
+	targets := []bucket.BackupTarget{}
+	for i, target := range file.Targets {
+		name := target.Name
+		if name == "" {
+			name = fmt.Sprintf("target-%d", i+1)
+		}
+
+		switch {
+		case target.Dir != "" && target.S3 != nil:
+			return nil, fmt.Errorf("target %s: only one of dir and s3 can be set", name)
+		case target.Dir != "":
+			storage, err := localfs.New(target.Dir)
+			if err != nil {
+				return nil, fmt.Errorf("target %s: %w", name, err)
+			}
+			targets = append(targets, bucket.BackupTarget{Name: name, Storage: storage})
+		case target.S3 != nil:
+			config, err := target.S3.config()
+			if err != nil {
+				return nil, fmt.Errorf("target %s: %w", name, err)
+			}
+			targets = append(targets, bucket.BackupTarget{Name: name, Storage: s3.NewClient(config)})
+		default:
+			return nil, fmt.Errorf("target %s: one of dir and s3 must be set", name)
+		}
+	}
+
+	return targets, nil
+}
+
+func (t *s3Target) config() (s3.Config, error) {
+	config := s3.Config{
+		URL:          t.URL,
+		Region:       t.Region,
+		Bucket:       t.Bucket,
+		KeyID:        t.KeyID,
+		KeySecret:    t.KeySecret,
+		StorageClass: t.StorageClass,
+
+		Credentials:     credentialsFor(t.KeyID, t.CredentialProcess, t.Profile),
+		AddressingStyle: s3.AddressingStyle(t.AddressingStyle),
+
+		UploadRateLimit:   t.UploadRateLimit,
+		DownloadRateLimit: t.DownloadRateLimit,
+	}
+	if t.Proxy != "" {
+		proxy, err := url.Parse(t.Proxy)
+		if err != nil {
+			return s3.Config{}, fmt.Errorf("parse proxy: %w", err)
+		}
+		config.Proxy = proxy
+	}
+	durations := []struct {
+		name  string
+		value string
+		field *time.Duration
+	}{
+		{"stallTimeout", t.StallTimeout, &config.StallTimeout},
+		{"idleTimeout", t.IdleTimeout, &config.IdleTimeout},
+	}
+	for _, duration := range durations {
+		if duration.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(duration.value)
+		if err != nil {
+			return s3.Config{}, fmt.Errorf("parse %s: %w", duration.name, err)
+		}
+		*duration.field = parsed
+	}
+	if t.CAFile != "" {
+		pool, err := s3.LoadRootCAs(t.CAFile)
+		if err != nil {
+			return s3.Config{}, err
+		}
+		config.RootCAs = pool
+	}
+
+	return config, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bradenrayhorn/pickle/internal/testutils/assert"
+	"github.com/bradenrayhorn/pickle/localfs"
+	"github.com/bradenrayhorn/pickle/s3"
+)
+
+func writeTargets(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "targets.json")
+	assert.NoErr(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadBackupTargets(t *testing.T) {
+	path := writeTargets(t, `{"targets": [
+		{"name": "nas", "dir": "`+t.TempDir()+`"},
+		{"s3": {"url": "localhost:9000", "region": "my-region", "bucket": "my-bucket", "keyID": "keyid", "keySecret": "shh"}}
+	]}`)
+
+	targets, err := loadBackupTargets(path)
+	assert.NoErr(t, err)
+	assert.Equal(t, 2, len(targets))
+
+	assert.Equal(t, "nas", targets[0].Name)
+	_, ok := targets[0].Storage.(*localfs.Storage)
+	assert.True(t, ok)
+
+	// unnamed targets are numbered
+	assert.Equal(t, "target-2", targets[1].Name)
+	_, ok = targets[1].Storage.(*s3.Client)
+	assert.True(t, ok)
+}
+
+func TestLoadBackupTargetsRejectsInvalidTargets(t *testing.T) {
+	tests := map[string]string{
+		`{"targets": []}`: "no targets",
+		`{"targets": [{"name": "both", "dir": "/tmp", "s3": {}}]}`: "target both: only one of dir and s3 can be set",
+		`{"targets": [{"name": "neither"}]}`:                       "target neither: one of dir and s3 must be set",
+		`{"targets": `:                                             "parse targets",
+	}
+	for content, expected := range tests {
+		_, err := loadBackupTargets(writeTargets(t, content))
+		assert.ErrContains(t, err, expected)
+	}
+}
+
+func TestS3TargetTransportOptions(t *testing.T) {
+	var target s3Target
+	assert.NoErr(t, json.Unmarshal([]byte(`{
+		"url": "localhost:9000", "bucket": "my-bucket",
+		"proxy": "http://proxy:3128",
+		"uploadRateLimit": 1024, "downloadRateLimit": 2048,
+		"stallTimeout": "5m", "idleTimeout": "30s"
+	}`), &target))
+
+	config, err := target.config()
+	assert.NoErr(t, err)
+	assert.Equal(t, "proxy:3128", config.Proxy.Host)
+	assert.Equal(t, int64(1024), config.UploadRateLimit)
+	assert.Equal(t, int64(2048), config.DownloadRateLimit)
+	assert.Equal(t, 5*time.Minute, config.StallTimeout)
+	assert.Equal(t, 30*time.Second, config.IdleTimeout)
+
+	// left out, the client's defaults apply
+	config, err = (&s3Target{}).config()
+	assert.NoErr(t, err)
+	assert.Equal(t, time.Duration(0), config.StallTimeout)
+	assert.Equal(t, time.Duration(0), config.IdleTimeout)
+}
+
+func TestS3TargetRejectsInvalidDurations(t *testing.T) {
+	tests := map[string]string{
+		`{"targets": [{"name": "stall", "s3": {"stallTimeout": "5"}}]}`:      "target stall: parse stallTimeout",
+		`{"targets": [{"name": "idle", "s3": {"idleTimeout": "soon"}}]}`:     "target idle: parse idleTimeout",
+		`{"targets": [{"name": "proxy", "s3": {"proxy": "http://%zz"}}]}`:    "target proxy: parse proxy",
+		`{"targets": [{"name": "ca", "s3": {"caFile": "/does/not/exist"}}]}`: "target ca: read CA file",
+	}
+	for content, expected := range tests {
+		_, err := loadBackupTargets(writeTargets(t, content))
+		assert.ErrContains(t, err, expected)
+	}
+}
@@ -14,8 +14,14 @@ type Config struct {
 	KeyID        string `json:"keyID"`
 	KeySecret    string `json:"keySecret"`
 
+	AddressingStyle string `json:"addressingStyle"`
+
 	AgePrivateKey   string `json:"ageKey"`
 	ObjectLockHours int    `json:"objectLockHours"`
+	ObjectLockMode  string `json:"objectLockMode"`
+
+	Compression      string `json:"compression"`
+	CompressionLevel int    `json:"compressionLevel"`
 }
 
 type configV1 struct {
@@ -26,8 +32,14 @@ type configV1 struct {
 	KeyID        string `json:"k"`
 	KeySecret    string `json:"ks"`
 
+	AddressingStyle string `json:"as,omitempty"`
+
 	AgePrivateKey   string `json:"a"`
 	ObjectLockHours int    `json:"l"`
+	ObjectLockMode  string `json:"lm,omitempty"`
+
+	Compression      string `json:"z,omitempty"`
+	CompressionLevel int    `json:"zl,omitempty"`
 }
 
 type versionedConfig struct {
@@ -24,6 +24,8 @@ export const test = base.extend<{ tempDir: string; connection: string }, {}>({
         env: {
           ...process.env,
           FAKES3_HTTP_PORT: `${port}`,
+          FAKES3_ACCESS_KEY_ID: 'key-id',
+          FAKES3_SECRET_KEY: 'shh',
         },
       });
 
@@ -37,7 +39,7 @@ export const test = base.extend<{ tempDir: string; connection: string }, {}>({
           k: 'key-id',
           ks: 'shh',
           a: 'AGE-SECRET-KEY-1U3PMPY7ACSYU7CRZWJMW4A74LJ9874NQ8SWJDQE2JUNSVH80AKFSZMY8LV',
-          l: 0,
+          l: 1,
         },
       };
       await use(Buffer.from(JSON.stringify(credentials)).toString('base64'));
@@ -8,6 +8,7 @@ type File = {
   lastModified: string;
   size: string;
   hasMultipleVersions: boolean;
+  legalHold: boolean;
 };
 
 type Directory = {
@@ -43,6 +44,7 @@ export function buildFileList(
       lastModified: file.lastModified,
       size: file.size,
       hasMultipleVersions: false,
+      legalHold: file.legalHold,
     }));
   }
 
@@ -71,6 +73,7 @@ export function buildFileList(
       lastModified: latest.lastModified,
       size: latest.size,
       hasMultipleVersions: versions.length > 1,
+      legalHold: versions.some((v) => v.legalHold),
     };
     return file;
   });
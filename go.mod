@@ -4,6 +4,7 @@ go 1.24.4
 
 require (
 	filippo.io/age v1.2.1
+	github.com/klauspost/compress v1.18.0
 	github.com/segmentio/ksuid v1.0.4
 	github.com/wailsapp/wails/v2 v2.10.1
 )
@@ -0,0 +1,309 @@
+package fakes3
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type errorResponse struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+
+	RequestTime string `xml:"RequestTime,omitempty"`
+	ServerTime  string `xml:"ServerTime,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	writeErrorResponse(w, status, errorResponse{Code: code, Message: message})
+}
+
+func writeErrorResponse(w http.ResponseWriter, status int, response errorResponse) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(response)
+}
+
+// SetCredentials changes the keys that requests must be signed with. It defaults to keyid/shh.
+func (s *FakeS3) SetCredentials(accessKeyID string, secretKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.accessKeyID = accessKeyID
+	s.secretKey = secretKey
+}
+
+// SetClockSkew moves the server's clock, which requests are checked against, away from the
+// local clock.
+func (s *FakeS3) SetClockSkew(skew time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clockSkew = skew
+}
+
+// maxRequestSkew is how far a request's date may be from the server's clock.
+const maxRequestSkew = 15 * time.Minute
+
+// checkSignature verifies a request signed in its Authorization header, including the date and
+// the payload hash. It writes an error and returns false if anything doesn't match.
+func (s *FakeS3) checkSignature(w http.ResponseWriter, r *http.Request) bool {
+	s.mu.RLock()
+	accessKeyID, secretKey, serverTime := s.accessKeyID, s.secretKey, time.Now().Add(s.clockSkew)
+	s.mu.RUnlock()
+
+	authorization, ok := strings.CutPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ")
+	if !ok {
+		writeError(w, http.StatusForbidden, "AccessDenied", "Access Denied")
+		return false
+	}
+
+	fields := map[string]string{}
+	for _, field := range strings.Split(authorization, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		fields[key] = value
+	}
+
+	// credential is keyID/date/region/s3/aws4_request
+	credential := strings.Split(fields["Credential"], "/")
+	if len(credential) != 5 || credential[3] != "s3" || credential[4] != "aws4_request" || fields["SignedHeaders"] == "" {
+		writeError(w, http.StatusBadRequest, "AuthorizationHeaderMalformed", "The authorization header is malformed.")
+		return false
+	}
+	if credential[0] != accessKeyID {
+		writeError(w, http.StatusForbidden, "InvalidAccessKeyId", "The AWS Access Key Id you provided does not exist in our records.")
+		return false
+	}
+
+	amzDate := r.Header.Get("x-amz-date")
+	signedAt, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil || signedAt.Format("20060102") != credential[1] {
+		writeError(w, http.StatusForbidden, "AccessDenied", "AWS authentication requires a valid Date or x-amz-date header")
+		return false
+	}
+	if skew := serverTime.Sub(signedAt); skew > maxRequestSkew || skew < -maxRequestSkew {
+		w.Header().Set("Date", serverTime.UTC().Format(http.TimeFormat))
+		writeErrorResponse(w, http.StatusForbidden, errorResponse{
+			Code:        "RequestTimeTooSkewed",
+			Message:     "The difference between the request time and the current time is too large.",
+			RequestTime: signedAt.Format(time.RFC3339),
+			ServerTime:  serverTime.UTC().Format(time.RFC3339),
+		})
+		return false
+	}
+
+	payloadHash := r.Header.Get("x-amz-content-sha256")
+	if payloadHash == "" {
+		writeError(w, http.StatusBadRequest, "InvalidRequest", "Missing required header for this request: x-amz-content-sha256")
+		return false
+	}
+	streaming := strings.HasPrefix(payloadHash, "STREAMING-")
+	if payloadHash != "UNSIGNED-PAYLOAD" && !streaming {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody", "The request body could not be read.")
+			return false
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		bodyHash := sha256.Sum256(body)
+		if hex.EncodeToString(bodyHash[:]) != payloadHash {
+			writeError(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed.")
+			return false
+		}
+	}
+
+	signedHeaders := strings.Split(fields["SignedHeaders"], ";")
+	if !slices.Contains(signedHeaders, "host") {
+		writeError(w, http.StatusForbidden, "AccessDenied", "The host header must be signed.")
+		return false
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		awsURIEncode(r.URL.Path, false),
+		awsCanonicalQuery(r.URL.Query()),
+		canonicalHeaders(r, signedHeaders),
+		fields["SignedHeaders"],
+		payloadHash,
+	}, "\n")
+
+	expected := awsSignature(secretKey, amzDate, credential[1:4], canonicalRequest)
+	if !hmac.Equal([]byte(expected), []byte(fields["Signature"])) {
+		writeError(w, http.StatusForbidden, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided. Check your key and signing method.")
+		return false
+	}
+
+	if streaming {
+		signer := &chunkVerifier{
+			key:      awsSigningKey(secretKey, credential[1:4]),
+			amzDate:  amzDate,
+			scope:    strings.Join(credential[1:5], "/"),
+			previous: expected,
+		}
+		if err := decodeChunked(r, payloadHash, signer); err != nil {
+			writeError(w, http.StatusForbidden, "SignatureDoesNotMatch", fmt.Sprintf("The chunked body is invalid: %v", err))
+			return false
+		}
+	}
+
+	return true
+}
+
+// canonicalHeaders lists the signed headers with their values trimmed and inner spaces folded.
+func canonicalHeaders(r *http.Request, signedHeaders []string) string {
+	canonical := ""
+	for _, header := range signedHeaders {
+		values := r.Header.Values(header)
+		switch header {
+		case "host":
+			values = []string{r.Host}
+		case "content-length":
+			values = []string{strconv.FormatInt(r.ContentLength, 10)}
+		}
+
+		folded := make([]string, len(values))
+		for i, value := range values {
+			folded[i] = strings.Join(strings.Fields(value), " ")
+		}
+		canonical += header + ":" + strings.Join(folded, ",") + "\n"
+	}
+	return canonical
+}
+
+// checkPresigned verifies a request signed in its query string. It writes an error and returns
+// false if the signature is wrong or has expired.
+func (s *FakeS3) checkPresigned(w http.ResponseWriter, r *http.Request) bool {
+	s.mu.RLock()
+	accessKeyID, secretKey, now := s.accessKeyID, s.secretKey, s.now
+	s.mu.RUnlock()
+
+	query := r.URL.Query()
+	if query.Get("X-Amz-Algorithm") != "AWS4-HMAC-SHA256" {
+		writeError(w, http.StatusBadRequest, "AuthorizationQueryParametersError", "unsupported algorithm")
+		return false
+	}
+
+	// credential is keyID/date/region/s3/aws4_request
+	credential := strings.Split(query.Get("X-Amz-Credential"), "/")
+	if len(credential) != 5 || credential[3] != "s3" || credential[4] != "aws4_request" {
+		writeError(w, http.StatusBadRequest, "AuthorizationQueryParametersError", "invalid credential")
+		return false
+	}
+	if credential[0] != accessKeyID {
+		writeError(w, http.StatusForbidden, "InvalidAccessKeyId", "unknown access key")
+		return false
+	}
+
+	signedAt, err := time.Parse("20060102T150405Z", query.Get("X-Amz-Date"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "AuthorizationQueryParametersError", "invalid date")
+		return false
+	}
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || expires < 1 || expires > 7*24*60*60 {
+		writeError(w, http.StatusBadRequest, "AuthorizationQueryParametersError", "invalid expiry")
+		return false
+	}
+	if now.After(signedAt.Add(time.Duration(expires) * time.Second)) {
+		writeError(w, http.StatusForbidden, "AccessDenied", "Request has expired")
+		return false
+	}
+
+	signedHeaders := strings.Split(query.Get("X-Amz-SignedHeaders"), ";")
+
+	unsigned := url.Values{}
+	for key, values := range query {
+		if key != "X-Amz-Signature" {
+			unsigned[key] = values
+		}
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		awsURIEncode(r.URL.Path, false),
+		awsCanonicalQuery(unsigned),
+		canonicalHeaders(r, signedHeaders),
+		strings.Join(signedHeaders, ";"),
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	expected := awsSignature(secretKey, query.Get("X-Amz-Date"), credential[1:4], canonicalRequest)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("X-Amz-Signature"))) {
+		writeError(w, http.StatusForbidden, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided. Check your key and signing method.")
+		return false
+	}
+
+	return true
+}
+
+// awsSignature signs a canonical request. scope is the date, region and service.
+func awsSignature(secretKey string, amzDate string, scope []string, canonicalRequest string) string {
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		strings.Join(scope, "/") + "/aws4_request",
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	return hex.EncodeToString(hmacSum(awsSigningKey(secretKey, scope), stringToSign))
+}
+
+func awsSigningKey(secretKey string, scope []string) []byte {
+	key := []byte("AWS4" + secretKey)
+	for _, part := range append(slices.Clone(scope), "aws4_request") {
+		key = hmacSum(key, part)
+	}
+	return key
+}
+
+func hmacSum(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		unreserved := (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || strings.IndexByte("-_.~", c) >= 0
+		if unreserved || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+		} else {
+			b.WriteString(fmt.Sprintf("%%%02X", c))
+		}
+	}
+	return b.String()
+}
+
+func awsCanonicalQuery(query url.Values) string {
+	keys := []string{}
+	for key := range query {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		return strings.Compare(awsURIEncode(a, true), awsURIEncode(b, true))
+	})
+
+	pairs := []string{}
+	for _, key := range keys {
+		values := slices.Clone(query[key])
+		slices.Sort(values)
+		for _, value := range values {
+			pairs = append(pairs, awsURIEncode(key, true)+"="+awsURIEncode(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
@@ -0,0 +1,72 @@
+package fakes3
+
+import (
+	"encoding/xml"
+	"net/http"
+)
+
+type versioningConfiguration struct {
+	XMLName xml.Name `xml:"VersioningConfiguration"`
+	Status  string   `xml:"Status,omitempty"`
+}
+
+type objectLockConfiguration struct {
+	XMLName           xml.Name        `xml:"ObjectLockConfiguration"`
+	ObjectLockEnabled string          `xml:"ObjectLockEnabled"`
+	Rule              *objectLockRule `xml:"Rule,omitempty"`
+}
+
+type objectLockRule struct {
+	DefaultRetention DefaultRetention `xml:"DefaultRetention"`
+}
+
+type DefaultRetention struct {
+	Mode  string `xml:"Mode"`
+	Days  int    `xml:"Days,omitempty"`
+	Years int    `xml:"Years,omitempty"`
+}
+
+// SetVersioning changes the versioning status that is reported. It defaults to Enabled, versions
+// are kept either way.
+func (s *FakeS3) SetVersioning(status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.versioning = status
+}
+
+// SetObjectLock changes whether the bucket reports object lock as enabled, and its default
+// retention. It defaults to enabled without a default retention.
+func (s *FakeS3) SetObjectLock(enabled bool, defaultRetention *DefaultRetention) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objectLockEnabled = enabled
+	s.defaultRetention = defaultRetention
+}
+
+func (s *FakeS3) handleGetBucketVersioning(w http.ResponseWriter) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(versioningConfiguration{Status: s.versioning})
+}
+
+func (s *FakeS3) handleGetObjectLockConfiguration(w http.ResponseWriter) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.objectLockEnabled {
+		writeError(w, http.StatusNotFound, "ObjectLockConfigurationNotFoundError", "Object Lock configuration does not exist for this bucket")
+		return
+	}
+
+	config := objectLockConfiguration{ObjectLockEnabled: "Enabled"}
+	if s.defaultRetention != nil {
+		config.Rule = &objectLockRule{DefaultRetention: *s.defaultRetention}
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(config)
+}
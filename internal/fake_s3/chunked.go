@@ -0,0 +1,136 @@
+package fakes3
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// chunkVerifier checks the signatures of an aws-chunked body. Each signature covers the one
+// before it, starting from the signature of the request headers.
+type chunkVerifier struct {
+	key      []byte
+	amzDate  string
+	scope    string
+	previous string
+}
+
+func (v *chunkVerifier) verify(signature string, algorithm string, parts ...string) error {
+	stringToSign := strings.Join(append([]string{algorithm, v.amzDate, v.scope, v.previous}, parts...), "\n")
+	expected := hex.EncodeToString(hmacSum(v.key, stringToSign))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("signature does not match")
+	}
+	v.previous = expected
+	return nil
+}
+
+// decodeChunked replaces the aws-chunked body of r with the decoded data, checking every chunk's
+// signature on the way. Trailing headers are moved onto the request.
+func decodeChunked(r *http.Request, payloadHash string, verifier *chunkVerifier) error {
+	withTrailer := payloadHash == "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+	if !withTrailer && payloadHash != "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" {
+		return fmt.Errorf("unsupported payload %s", payloadHash)
+	}
+
+	decodedLength, err := strconv.ParseInt(r.Header.Get("x-amz-decoded-content-length"), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid x-amz-decoded-content-length: %w", err)
+	}
+
+	body := bufio.NewReader(r.Body)
+	var decoded bytes.Buffer
+	for {
+		line, err := readChunkLine(body)
+		if err != nil {
+			return err
+		}
+
+		sizeHex, signature, ok := strings.Cut(line, ";chunk-signature=")
+		if !ok {
+			return fmt.Errorf("missing chunk signature")
+		}
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil || size < 0 {
+			return fmt.Errorf("invalid chunk size %q", sizeHex)
+		}
+
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(body, chunk); err != nil {
+			return fmt.Errorf("read chunk: %w", err)
+		}
+		chunkHash := sha256.Sum256(chunk)
+		if err := verifier.verify(signature, "AWS4-HMAC-SHA256-PAYLOAD", emptySHA256, hex.EncodeToString(chunkHash[:])); err != nil {
+			return fmt.Errorf("chunk: %w", err)
+		}
+		decoded.Write(chunk)
+
+		if size == 0 {
+			break
+		}
+		if line, err := readChunkLine(body); err != nil || line != "" {
+			return fmt.Errorf("chunk is longer than its size")
+		}
+	}
+
+	if withTrailer {
+		trailers := ""
+		for {
+			line, err := readChunkLine(body)
+			if err != nil {
+				return err
+			}
+
+			if signature, ok := strings.CutPrefix(line, "x-amz-trailer-signature:"); ok {
+				trailerHash := sha256.Sum256([]byte(trailers))
+				if err := verifier.verify(signature, "AWS4-HMAC-SHA256-TRAILER", hex.EncodeToString(trailerHash[:])); err != nil {
+					return fmt.Errorf("trailer: %w", err)
+				}
+				break
+			}
+
+			name, value, ok := strings.Cut(line, ":")
+			if !ok {
+				return fmt.Errorf("invalid trailer %q", line)
+			}
+			if !strings.Contains(r.Header.Get("x-amz-trailer"), name) {
+				return fmt.Errorf("trailer %s was not declared", name)
+			}
+			r.Header.Set(name, value)
+			trailers += line + "\n"
+		}
+	}
+
+	if line, err := readChunkLine(body); err != nil || line != "" {
+		return fmt.Errorf("missing end of body")
+	}
+	if int64(decoded.Len()) != decodedLength {
+		return fmt.Errorf("decoded %d bytes, expected %d", decoded.Len(), decodedLength)
+	}
+
+	r.Body = io.NopCloser(&decoded)
+	r.ContentLength = decodedLength
+	r.Header.Del("Content-Encoding")
+	return nil
+}
+
+func readChunkLine(body *bufio.Reader) (string, error) {
+	line, err := body.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("read chunk line: %w", err)
+	}
+	line, ok := strings.CutSuffix(line, "\r\n")
+	if !ok {
+		return "", fmt.Errorf("chunk line must end with CRLF")
+	}
+	return line, nil
+}
@@ -0,0 +1,174 @@
+package fakes3
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"hash/crc32"
+	"maps"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type copyObjectResult struct {
+	XMLName        xml.Name `xml:"CopyObjectResult"`
+	ETag           string   `xml:"ETag"`
+	LastModified   string   `xml:"LastModified"`
+	ChecksumCRC32C string   `xml:"ChecksumCRC32C"`
+}
+
+// ServeBucket makes this server also answer requests for another bucket, as if both lived on
+// the same endpoint. Objects can then be copied between them.
+func (s *FakeS3) ServeBucket(other *FakeS3) {
+	s.mu.Lock()
+	s.peers[other.bucket] = other
+	s.mu.Unlock()
+
+	other.mu.Lock()
+	other.peers[s.bucket] = s
+	other.mu.Unlock()
+}
+
+func (s *FakeS3) lookupBucket(bucket string) *FakeS3 {
+	if bucket == s.bucket {
+		return s
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.peers[bucket]
+}
+
+// readCopySource finds the object version named by the x-amz-copy-source header and returns a
+// copy of it, limited to x-amz-copy-source-range if set.
+func (s *FakeS3) readCopySource(r *http.Request) (*ObjectVersion, int, error) {
+	source := strings.TrimPrefix(r.Header.Get("x-amz-copy-source"), "/")
+	path, rawQuery, _ := strings.Cut(source, "?")
+	bucket, escapedKey, ok := strings.Cut(path, "/")
+	if !ok {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid copy source %q", source)
+	}
+	key, err := url.PathUnescape(escapedKey)
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid copy source %q", source)
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid copy source %q", source)
+	}
+
+	from := s.lookupBucket(bucket)
+	if from == nil {
+		return nil, http.StatusForbidden, fmt.Errorf("access denied to bucket %s", bucket)
+	}
+
+	from.mu.RLock()
+	defer from.mu.RUnlock()
+
+	version := from.findVersion(key, query.Get("versionId"))
+	if version == nil || version.DeleteMarker {
+		return nil, http.StatusNotFound, fmt.Errorf("copy source %s not found", source)
+	}
+
+	copied := *version
+	copied.Meta = maps.Clone(version.Meta)
+
+	if byteRange := r.Header.Get("x-amz-copy-source-range"); byteRange != "" {
+		start, end, err := parseByteRange(byteRange, len(version.Content))
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		copied.Content = version.Content[start : end+1]
+	}
+
+	return &copied, 0, nil
+}
+
+func parseByteRange(byteRange string, size int) (int, int, error) {
+	startString, endString, ok := strings.Cut(strings.TrimPrefix(byteRange, "bytes="), "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid range %q", byteRange)
+	}
+	start, err := strconv.Atoi(startString)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid range %q", byteRange)
+	}
+	end, err := strconv.Atoi(endString)
+	if err != nil || start > end || end >= size {
+		return 0, 0, fmt.Errorf("invalid range %q", byteRange)
+	}
+	return start, end, nil
+}
+
+func (s *FakeS3) findVersion(key string, versionID string) *ObjectVersion {
+	versions := s.objects[key]
+	if versionID != "" {
+		return versions[versionID]
+	}
+
+	var latest *ObjectVersion
+	for _, version := range versions {
+		if latest == nil || version.VersionID > latest.VersionID {
+			latest = version
+		}
+	}
+	return latest
+}
+
+func crc32cOf(content []byte) string {
+	crc := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	_, _ = crc.Write(content)
+	return base64.StdEncoding.EncodeToString(crc.Sum(nil))
+}
+
+func (s *FakeS3) handleCopyObject(w http.ResponseWriter, r *http.Request, key string) {
+	source, status, err := s.readCopySource(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	obj := &ObjectVersion{
+		Key:          key,
+		Content:      source.Content,
+		LastModified: s.now,
+		StorageClass: "STANDARD",
+		ChecksumType: checksumAlgorithmCRC32C,
+		Checksum:     crc32cOf(source.Content),
+		Meta:         source.Meta,
+	}
+
+	if sc := r.Header.Get("x-amz-storage-class"); sc != "" {
+		obj.StorageClass = sc
+	}
+
+	if r.Header.Get("x-amz-metadata-directive") == "REPLACE" {
+		obj.Meta = requestMeta(r)
+	}
+
+	// object lock is never copied
+	obj.Retention = requestRetention(r)
+	obj.LegalHold = r.Header.Get("x-amz-object-lock-legal-hold") == "ON"
+	if s.retentionInPast(obj.Retention) {
+		http.Error(w, "RetainUntil must be after now", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.saveVersion(obj)
+	w.Header().Set("x-amz-version-id", obj.VersionID)
+
+	result := copyObjectResult{
+		ETag:           fmt.Sprintf("%q", obj.Checksum),
+		LastModified:   obj.LastModified.Format(time.RFC3339),
+		ChecksumCRC32C: obj.Checksum,
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	_ = xml.NewEncoder(w).Encode(result)
+}
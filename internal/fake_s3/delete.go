@@ -51,6 +51,8 @@ func (s *FakeS3) handleDeleteObjects(w http.ResponseWriter, r *http.Request) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	bypassGovernance := bypassesGovernance(r)
+
 	result := deleteVersionsResult{
 		Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/",
 	}
@@ -63,12 +65,12 @@ func (s *FakeS3) handleDeleteObjects(w http.ResponseWriter, r *http.Request) {
 			if versionID != "" {
 				// Delete specific version
 				if version, versionExists := versions[versionID]; versionExists {
-					if version.Retention != nil && version.Retention.Until.After(s.now) {
+					if version.LegalHold || version.Retention.locks(s.now, bypassGovernance) {
 						result.Error = append(result.Error, deletedError{
 							Key:       key,
 							VersionID: versionID,
-							Code:      "ObjectLocked",
-							Message:   "Object is locked",
+							Code:      "AccessDenied",
+							Message:   "Access Denied because object protected by object lock.",
 						})
 						continue
 					}
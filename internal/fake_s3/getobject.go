@@ -14,7 +14,6 @@ func (s *FakeS3) handleGetObject(w http.ResponseWriter, r *http.Request, key str
 
 	if version != nil {
 		w.Header().Set("Content-Type", "application/octet-stream")
-		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(version.Content)))
 
 		_, _ = w.Write(version.Content)
 	}
@@ -43,7 +42,7 @@ func (s *FakeS3) getObjectAndWriteHeaders(w http.ResponseWriter, r *http.Request
 		slices.SortFunc(keyVersions, func(a *ObjectVersion, b *ObjectVersion) int {
 			return strings.Compare(a.VersionID, b.VersionID)
 		})
-		version = keyVersions[0]
+		version = keyVersions[len(keyVersions)-1]
 	} else {
 		// find specific version
 		version = versions[versionID]
@@ -69,12 +68,16 @@ func (s *FakeS3) getObjectAndWriteHeaders(w http.ResponseWriter, r *http.Request
 		w.Header().Set("x-amz-object-lock-mode", version.Retention.Mode)
 		w.Header().Set("x-amz-object-lock-retain-until-date", version.Retention.Until.Format(time.RFC3339))
 	}
+	if version.LegalHold {
+		w.Header().Set("x-amz-object-lock-legal-hold", "ON")
+	}
 
 	// meta
 	for k, v := range version.Meta {
 		w.Header().Set("x-amz-meta-"+k, v)
 	}
 
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(version.Content)))
 	w.Header().Set("x-amz-version-id", version.VersionID)
 	w.Header().Set("x-amz-storage-class", version.StorageClass)
 	w.Header().Set("LastModified", version.LastModified.Format(time.RFC3339))
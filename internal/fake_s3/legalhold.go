@@ -0,0 +1,73 @@
+package fakes3
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+type legalHold struct {
+	XMLName xml.Name `xml:"LegalHold"`
+	Status  string   `xml:"Status"`
+}
+
+func (s *FakeS3) handlePutObjectLegalHold(w http.ResponseWriter, r *http.Request, key string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var hold legalHold
+	if err := xml.Unmarshal(body, &hold); err != nil {
+		http.Error(w, fmt.Sprintf("Error parsing XML: %v", err), http.StatusBadRequest)
+		return
+	}
+	if hold.Status != "ON" && hold.Status != "OFF" {
+		writeError(w, http.StatusBadRequest, "MalformedXML", "Status must be ON or OFF")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj := s.findLockableVersion(w, r, key)
+	if obj == nil {
+		return
+	}
+
+	obj.LegalHold = hold.Status == "ON"
+}
+
+func (s *FakeS3) handleGetObjectLegalHold(w http.ResponseWriter, r *http.Request, key string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	obj := s.findLockableVersion(w, r, key)
+	if obj == nil {
+		return
+	}
+
+	if !obj.LegalHold {
+		writeError(w, http.StatusNotFound, "NoSuchObjectLockConfiguration", "The specified object does not have a ObjectLock configuration")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(legalHold{Status: "ON"})
+}
+
+// findLockableVersion returns the version named by the versionId query, or writes an error
+// response and returns nil. The caller must hold the lock.
+func (s *FakeS3) findLockableVersion(w http.ResponseWriter, r *http.Request, key string) *ObjectVersion {
+	versionID := r.URL.Query().Get("versionId")
+
+	obj := s.objects[key][versionID]
+	if obj == nil || obj.DeleteMarker {
+		writeError(w, http.StatusNotFound, "NoSuchVersion", "The specified version does not exist.")
+		return nil
+	}
+
+	return obj
+}
@@ -0,0 +1,179 @@
+package fakes3
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+type multipartUpload struct {
+	key          string
+	storageClass string
+	meta         map[string]string
+	retention    *ObjectLockRetention
+	parts        map[int][]byte
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+type copyPartResult struct {
+	XMLName        xml.Name `xml:"CopyPartResult"`
+	ETag           string   `xml:"ETag"`
+	ChecksumCRC32C string   `xml:"ChecksumCRC32C"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+	Bucket  string   `xml:"Bucket"`
+	Key     string   `xml:"Key"`
+	ETag    string   `xml:"ETag"`
+}
+
+// GetMultipartUploadCount returns the number of multipart uploads that are still in progress.
+func (s *FakeS3) GetMultipartUploadCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.uploads)
+}
+
+func (s *FakeS3) handleCreateMultipartUpload(w http.ResponseWriter, r *http.Request, key string) {
+	upload := &multipartUpload{
+		key:          key,
+		storageClass: "STANDARD",
+		meta:         requestMeta(r),
+		retention:    requestRetention(r),
+		parts:        map[int][]byte{},
+	}
+	if sc := r.Header.Get("x-amz-storage-class"); sc != "" {
+		upload.storageClass = sc
+	}
+	if s.retentionInPast(upload.retention) {
+		http.Error(w, "RetainUntil must be after now", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.nextUploadID++
+	uploadID := fmt.Sprintf("upload-%04d", s.nextUploadID)
+	s.uploads[uploadID] = upload
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	_ = xml.NewEncoder(w).Encode(initiateMultipartUploadResult{Bucket: s.bucket, Key: key, UploadID: uploadID})
+}
+
+func (s *FakeS3) handleUploadPartCopy(w http.ResponseWriter, r *http.Request, key string) {
+	partNumber, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || partNumber < 1 {
+		http.Error(w, "invalid part number", http.StatusBadRequest)
+		return
+	}
+
+	if r.Header.Get("x-amz-copy-source") == "" {
+		http.Error(w, "Not Implemented", http.StatusNotImplemented)
+		return
+	}
+
+	source, status, err := s.readCopySource(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	s.mu.Lock()
+	upload, ok := s.uploads[r.URL.Query().Get("uploadId")]
+	if ok && upload.key == key {
+		upload.parts[partNumber] = source.Content
+	}
+	s.mu.Unlock()
+
+	if !ok || upload.key != key {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return
+	}
+
+	checksum := crc32cOf(source.Content)
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	_ = xml.NewEncoder(w).Encode(copyPartResult{ETag: fmt.Sprintf("%q", checksum), ChecksumCRC32C: checksum})
+}
+
+func (s *FakeS3) handleCompleteMultipartUpload(w http.ResponseWriter, r *http.Request, key string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var complete struct {
+		Parts []struct {
+			PartNumber int    `xml:"PartNumber"`
+			ETag       string `xml:"ETag"`
+		} `xml:"Part"`
+	}
+	if err := xml.Unmarshal(body, &complete); err != nil {
+		http.Error(w, fmt.Sprintf("Error parsing XML: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uploadID := r.URL.Query().Get("uploadId")
+	upload, ok := s.uploads[uploadID]
+	if !ok || upload.key != key {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return
+	}
+
+	content := []byte{}
+	for i, part := range complete.Parts {
+		data, ok := upload.parts[part.PartNumber]
+		if !ok || part.PartNumber != i+1 || part.ETag != fmt.Sprintf("%q", crc32cOf(data)) {
+			http.Error(w, fmt.Sprintf("invalid part %d", part.PartNumber), http.StatusBadRequest)
+			return
+		}
+		content = append(content, data...)
+	}
+
+	checksum := crc32cOf(content)
+	if proposed := r.Header.Get(checksumHeaderCRC32C); proposed != "" && proposed != checksum {
+		http.Error(w, fmt.Sprintf("Proposed checksum '%s' does not equal expected '%s'", proposed, checksum), http.StatusBadRequest)
+		return
+	}
+
+	obj := &ObjectVersion{
+		Key:          key,
+		Content:      content,
+		LastModified: s.now,
+		StorageClass: upload.storageClass,
+		ChecksumType: checksumAlgorithmCRC32C,
+		Checksum:     checksum,
+		Retention:    upload.retention,
+		Meta:         upload.meta,
+	}
+	s.saveVersion(obj)
+	delete(s.uploads, uploadID)
+
+	w.Header().Set("x-amz-version-id", obj.VersionID)
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	_ = xml.NewEncoder(w).Encode(completeMultipartUploadResult{Bucket: s.bucket, Key: key, ETag: fmt.Sprintf("%q", checksum)})
+}
+
+func (s *FakeS3) handleAbortMultipartUpload(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	delete(s.uploads, r.URL.Query().Get("uploadId"))
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -27,7 +27,6 @@ func (s *FakeS3) handlePutObject(w http.ResponseWriter, r *http.Request, key str
 		Content:      body,
 		LastModified: s.now,
 		StorageClass: "STANDARD",
-		Meta:         map[string]string{},
 	}
 
 	// storage class
@@ -61,40 +60,64 @@ func (s *FakeS3) handlePutObject(w http.ResponseWriter, r *http.Request, key str
 	}
 
 	// meta
+	obj.Meta = requestMeta(r)
+
+	// object retention
+	obj.Retention = requestRetention(r)
+	obj.LegalHold = r.Header.Get("x-amz-object-lock-legal-hold") == "ON"
+	if s.retentionInPast(obj.Retention) {
+		http.Error(w, "RetainUntil must be after now", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.saveVersion(obj)
+	w.Header().Set("x-amz-version-id", obj.VersionID)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func requestMeta(r *http.Request) map[string]string {
+	meta := map[string]string{}
 	for k, v := range r.Header {
 		k = strings.ToLower(k)
 		if strings.HasPrefix(k, "x-amz-meta-") && len(v) == 1 {
-			obj.Meta[strings.TrimPrefix(k, "x-amz-meta-")] = v[0]
+			meta[strings.TrimPrefix(k, "x-amz-meta-")] = v[0]
 		}
 	}
+	return meta
+}
 
-	// object retention
+func requestRetention(r *http.Request) *ObjectLockRetention {
 	lockMode := r.Header.Get("x-amz-object-lock-mode")
 	lockDate := r.Header.Get("x-amz-object-lock-retain-until-date")
 	if lockMode != "" && lockDate != "" {
 		retainUntil, err := time.Parse(time.RFC3339, lockDate)
 		if err == nil {
-			obj.Retention = &ObjectLockRetention{
+			return &ObjectLockRetention{
 				Mode:  lockMode,
 				Until: retainUntil,
 			}
 		}
 	}
+	return nil
+}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// retentionInPast reports whether a new object would be locked until a date that has already
+// passed, which S3 refuses.
+func (s *FakeS3) retentionInPast(retention *ObjectLockRetention) bool {
+	return retention != nil && retention.Until.Before(s.now.Truncate(time.Second))
+}
 
-	// generate version id
-	versionID := s.generateVersionID()
-	obj.VersionID = versionID
-	w.Header().Set("x-amz-version-id", versionID)
+// saveVersion stores obj as a new version of its key. The caller must hold the lock.
+func (s *FakeS3) saveVersion(obj *ObjectVersion) {
+	obj.VersionID = s.generateVersionID()
 
-	// save object
-	if _, exists := s.objects[key]; !exists {
-		s.objects[key] = make(map[string]*ObjectVersion)
+	if _, exists := s.objects[obj.Key]; !exists {
+		s.objects[obj.Key] = make(map[string]*ObjectVersion)
 	}
 
-	s.objects[key][versionID] = obj
-
-	w.WriteHeader(http.StatusOK)
+	s.objects[obj.Key][obj.VersionID] = obj
 }
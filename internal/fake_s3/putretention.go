@@ -65,6 +65,15 @@ func (s *FakeS3) handlePutObjectRetention(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// an active lock can only be extended, or raised from GOVERNANCE to COMPLIANCE
+	if current := obj.Retention; current.locks(s.now, false) {
+		weakened := retainUntil.Before(current.Until) || (current.Mode == "COMPLIANCE" && retentionReq.Mode != "COMPLIANCE")
+		if weakened && current.locks(s.now, bypassesGovernance(r)) {
+			writeError(w, http.StatusForbidden, "AccessDenied", "Access Denied because object protected by object lock.")
+			return
+		}
+	}
+
 	obj.Retention = &ObjectLockRetention{
 		Mode:  retentionReq.Mode,
 		Until: retainUntil,
@@ -26,6 +26,7 @@ type ObjectVersion struct {
 	ChecksumType string
 	Checksum     string
 	Retention    *ObjectLockRetention
+	LegalHold    bool
 	Meta         map[string]string
 }
 
@@ -34,6 +35,19 @@ type ObjectLockRetention struct {
 	Until time.Time
 }
 
+// locks reports whether the retention still protects its version. GOVERNANCE retention can be
+// bypassed, COMPLIANCE retention can't.
+func (r *ObjectLockRetention) locks(now time.Time, bypassGovernance bool) bool {
+	if r == nil || !r.Until.After(now) {
+		return false
+	}
+	return r.Mode != "GOVERNANCE" || !bypassGovernance
+}
+
+func bypassesGovernance(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("x-amz-bypass-governance-retention"), "true")
+}
+
 type FakeS3 struct {
 	mu            sync.RWMutex
 	server        *http.Server
@@ -43,6 +57,21 @@ type FakeS3 struct {
 	now           time.Time
 
 	boundHost string
+	basePath  string
+
+	accessKeyID string
+	secretKey   string
+	clockSkew   time.Duration
+
+	versioning        string
+	objectLockEnabled bool
+	defaultRetention  *DefaultRetention
+
+	// other buckets served from the same endpoint
+	peers map[string]*FakeS3
+
+	uploads      map[string]*multipartUpload
+	nextUploadID int
 
 	interceptor func(r *http.Request, w http.ResponseWriter) bool
 }
@@ -52,6 +81,14 @@ func NewFakeS3(bucket string) *FakeS3 {
 		objects: make(map[string]map[string]*ObjectVersion),
 		bucket:  bucket,
 		now:     time.Now().UTC(),
+		peers:   map[string]*FakeS3{},
+		uploads: map[string]*multipartUpload{},
+
+		accessKeyID: "keyid",
+		secretKey:   "shh",
+
+		versioning:        "Enabled",
+		objectLockEnabled: true,
 	}
 }
 
@@ -72,9 +109,11 @@ func (s *FakeS3) StartServerWithHostPort(host, port string) {
 	}
 	s.boundHost = ln.Addr().String()
 
-	s.server = &http.Server{Handler: http.HandlerFunc(s.handleRequest)}
+	// StopServer clears s.server, so the goroutine must not read it
+	server := &http.Server{Handler: http.HandlerFunc(s.handleRequest)}
+	s.server = server
 
-	go func() { _ = s.server.Serve(ln) }()
+	go func() { _ = server.Serve(ln) }()
 }
 
 func (s *FakeS3) StopServer() {
@@ -92,6 +131,11 @@ func (s *FakeS3) SetInterceptor(i func(r *http.Request, w http.ResponseWriter) b
 	s.interceptor = i
 }
 
+// SetBasePath serves the buckets below a path prefix, as some S3 compatible servers do.
+func (s *FakeS3) SetBasePath(basePath string) {
+	s.basePath = strings.TrimRight(basePath, "/")
+}
+
 func (s *FakeS3) GetEndpoint() string {
 	return s.boundHost
 }
@@ -101,6 +145,7 @@ func (s *FakeS3) Reset() {
 	defer s.mu.Unlock()
 
 	s.objects = make(map[string]map[string]*ObjectVersion)
+	s.uploads = map[string]*multipartUpload{}
 }
 
 func (s *FakeS3) GetVersions(key string) []*ObjectVersion {
@@ -152,6 +197,18 @@ func (s *FakeS3) GetVersionIDByFuzzyKey(keyContains string) string {
 	panic("no key containing " + keyContains)
 }
 
+func (s *FakeS3) bucketFromHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	name, _, ok := strings.Cut(host, ".")
+	if ok && s.lookupBucket(name) != nil {
+		return name
+	}
+	return ""
+}
+
 func (s *FakeS3) generateVersionID() string {
 	s.nextVersionID++
 	return fmt.Sprintf("%04d", s.nextVersionID)
@@ -164,16 +221,25 @@ func (s *FakeS3) handleRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse the bucket and key from the URL path
+	path, ok := strings.CutPrefix(r.URL.Path, s.basePath+"/")
+	if !ok {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	// Parse the bucket and key from the host and path
+	// Virtual-hosted format: {bucket}.{host}/{key}
 	// Path format: /{bucket}/{key}
-	parts := strings.SplitN(r.URL.Path, "/", 3)
-	bucket := ""
-	key := ""
-	if len(parts) > 1 {
-		bucket = parts[1]
+	bucket, key := s.bucketFromHost(r.Host), path
+	if bucket == "" {
+		bucket, key, _ = strings.Cut(path, "/")
 	}
-	if len(parts) > 2 {
-		key = parts[2]
+
+	s.mu.RLock()
+	clockSkew := s.clockSkew
+	s.mu.RUnlock()
+	if clockSkew != 0 {
+		w.Header().Set("Date", time.Now().Add(clockSkew).UTC().Format(http.TimeFormat))
 	}
 
 	if s.interceptor != nil {
@@ -182,11 +248,26 @@ func (s *FakeS3) handleRequest(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if r.URL.Query().Has("X-Amz-Signature") {
+		if !s.checkPresigned(w, r) {
+			return
+		}
+	} else if !s.checkSignature(w, r) {
+		return
+	}
+
 	if bucket != s.bucket {
+		if peer := s.lookupBucket(bucket); peer != nil {
+			peer.handleRequest(w, r)
+			return
+		}
+
 		http.Error(w, "Invalid bucket", http.StatusBadRequest)
 		return
 	}
 
+	query := r.URL.Query()
+
 	// Dispatch based on the HTTP method and query parameters
 	switch r.Method {
 	case http.MethodHead:
@@ -196,22 +277,44 @@ func (s *FakeS3) handleRequest(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Not Implmemented", http.StatusNotImplemented)
 		}
 	case http.MethodGet:
-		if key != "" {
+		if key != "" && query.Has("legal-hold") {
+			s.handleGetObjectLegalHold(w, r, key)
+		} else if key != "" {
 			s.handleGetObject(w, r, key)
 		} else if _, ok := r.URL.Query()["versions"]; ok {
 			s.handleListObjectVersions(w, r, bucket)
+		} else if query.Has("versioning") {
+			s.handleGetBucketVersioning(w)
+		} else if query.Has("object-lock") {
+			s.handleGetObjectLockConfiguration(w)
 		} else {
 			http.Error(w, "Not Implmemented", http.StatusNotImplemented)
 		}
 	case http.MethodPut:
-		if _, ok := r.URL.Query()["retention"]; ok {
+		if _, ok := query["retention"]; ok {
 			s.handlePutObjectRetention(w, r, key)
+		} else if query.Has("legal-hold") {
+			s.handlePutObjectLegalHold(w, r, key)
+		} else if query.Has("uploadId") {
+			s.handleUploadPartCopy(w, r, key)
+		} else if r.Header.Get("x-amz-copy-source") != "" {
+			s.handleCopyObject(w, r, key)
 		} else {
 			s.handlePutObject(w, r, key)
 		}
 	case http.MethodPost:
-		if _, ok := r.URL.Query()["delete"]; ok {
+		if _, ok := query["delete"]; ok {
 			s.handleDeleteObjects(w, r)
+		} else if query.Has("uploads") {
+			s.handleCreateMultipartUpload(w, r, key)
+		} else if query.Has("uploadId") {
+			s.handleCompleteMultipartUpload(w, r, key)
+		} else {
+			http.Error(w, "Not Implemented", http.StatusNotImplemented)
+		}
+	case http.MethodDelete:
+		if query.Has("uploadId") {
+			s.handleAbortMultipartUpload(w, r)
 		} else {
 			http.Error(w, "Not Implemented", http.StatusNotImplemented)
 		}
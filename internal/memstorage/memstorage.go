@@ -0,0 +1,339 @@
+// Package memstorage is an in-memory bucket.Storage for tests. It keeps every version of an
+// object and enforces object lock the same way S3 does.
+package memstorage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bradenrayhorn/pickle/s3"
+	"github.com/segmentio/ksuid"
+)
+
+type object struct {
+	key          string
+	versionID    string
+	content      []byte
+	lastModified time.Time
+	deleteMarker bool
+	crc32c       string
+	retention    *s3.ObjectLockRetention
+	metadata     map[string]string
+}
+
+type Storage struct {
+	mu            sync.Mutex
+	objects       map[string][]*object // map[key]versions, oldest first
+	nextVersionID int
+	now           time.Time
+}
+
+func New() *Storage {
+	return &Storage{
+		objects: map[string][]*object{},
+		now:     time.Now().UTC(),
+	}
+}
+
+func (s *Storage) SetNow(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.now = now.UTC()
+}
+
+func (s *Storage) ListAllObjectVersions(prefix string) (*s3.ListAllObjectVersionsResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := slices.Sorted(maps.Keys(s.objects))
+
+	result := &s3.ListAllObjectVersionsResult{}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		// newest to oldest
+		versions := s.objects[key]
+		for i := len(versions) - 1; i >= 0; i-- {
+			version := versions[i]
+			isLatest := i == len(versions)-1
+
+			if version.deleteMarker {
+				result.DeleteMarkers = append(result.DeleteMarkers, s3.DeleteMarker{
+					Key:       version.key,
+					VersionId: version.versionID,
+					IsLatest:  isLatest,
+				})
+			} else {
+				result.Versions = append(result.Versions, s3.VersionInfo{
+					Key:          version.key,
+					VersionId:    version.versionID,
+					IsLatest:     isLatest,
+					LastModified: version.lastModified.Format(time.RFC3339),
+					Size:         uint64(len(version.content)),
+					StorageClass: "STANDARD",
+				})
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func (s *Storage) GetObject(key string, versionID string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	version, err := s.find(key, versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.NopCloser(bytes.NewReader(version.content)), nil
+}
+
+func (s *Storage) HeadObject(key string, versionID string) (*s3.ObjectMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	version, err := s.find(key, versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	sha256 := version.metadata["pickle-sha256"]
+	if sha256 == "" {
+		return nil, fmt.Errorf("pickle-sha256 metadata missing from %s %s", key, versionID)
+	}
+	id := version.metadata["pickle-id"]
+	if id == "" {
+		return nil, fmt.Errorf("pickle-id metadata missing from %s %s", key, versionID)
+	}
+
+	meta := &s3.ObjectMetadata{
+		Key:               key,
+		VersionID:         version.versionID,
+		PickleSHA256:      sha256,
+		PickleID:          id,
+		PickleContentHMAC: version.metadata["pickle-content-hmac"],
+		PickleCompression: version.metadata["pickle-compression"],
+		Size:              int64(len(version.content)),
+	}
+	if version.retention != nil {
+		meta.ObjectLockMode = version.retention.Mode
+		meta.ObjectLockRetainUntilDate = version.retention.Until
+	}
+
+	return meta, nil
+}
+
+func (s *Storage) PutObjectWithMetadata(key string, data io.ReadSeeker, dataLength int64, crc32cChecksum []byte, sha256Checksum []byte, retention *s3.ObjectLockRetention, metadata map[string]string) (*s3.PutObjectResponse, error) {
+	content, err := io.ReadAll(data)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) != dataLength {
+		return nil, fmt.Errorf("expected %d bytes, got %d", dataLength, len(content))
+	}
+
+	objectMetadata := maps.Clone(metadata)
+	if objectMetadata == nil {
+		objectMetadata = map[string]string{}
+	}
+	objectMetadata["pickle-sha256"] = hex.EncodeToString(sha256Checksum)
+	objectMetadata["pickle-id"] = ksuid.New().String()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	version, err := s.put(key, content, base64.StdEncoding.EncodeToString(crc32cChecksum), retention, objectMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3.PutObjectResponse{VersionID: version.versionID}, nil
+}
+
+func (s *Storage) PutObjectRetention(key string, versionID string, retention *s3.ObjectLockRetention) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	version, err := s.find(key, versionID)
+	if err != nil {
+		return err
+	}
+
+	until := retention.Until.Truncate(time.Second)
+	if until.Before(s.now.Truncate(time.Second)) {
+		return fmt.Errorf("retain until must be after now")
+	}
+	// an active lock can only be extended, or raised from GOVERNANCE to COMPLIANCE
+	if current := version.retention; current != nil && current.Until.After(s.now) {
+		weakened := until.Before(current.Until) || (current.Mode == s3.LockModeCompliance && retention.Mode != s3.LockModeCompliance)
+		if weakened {
+			return fmt.Errorf("%w: %s %s is locked in %s mode until %s", s3.ErrObjectLocked, key, versionID, current.Mode, current.Until.Format(time.RFC3339))
+		}
+	}
+
+	version.retention = &s3.ObjectLockRetention{Mode: retention.Mode, Until: until}
+	return nil
+}
+
+func (s *Storage) DeleteObjects(objects []s3.ObjectIdentifier) (*s3.DeleteObjectsResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := &s3.DeleteObjectsResult{}
+	for _, identifier := range objects {
+		versions, ok := s.objects[identifier.Key]
+		if !ok {
+			continue
+		}
+
+		if identifier.VersionID == "" {
+			s.objects[identifier.Key] = append(versions, &object{
+				key:          identifier.Key,
+				versionID:    s.generateVersionID(),
+				lastModified: s.now,
+				deleteMarker: true,
+			})
+			continue
+		}
+
+		i := slices.IndexFunc(versions, func(o *object) bool { return o.versionID == identifier.VersionID })
+		if i < 0 {
+			continue
+		}
+
+		if retention := versions[i].retention; retention != nil && retention.Until.After(s.now) {
+			result.Error = append(result.Error, s3.DeletedError{
+				Key:       identifier.Key,
+				VersionID: identifier.VersionID,
+				Code:      "AccessDenied",
+				Message:   "Access Denied because object protected by object lock.",
+			})
+			continue
+		}
+
+		s.objects[identifier.Key] = slices.Delete(versions, i, i+1)
+		if len(s.objects[identifier.Key]) == 0 {
+			delete(s.objects, identifier.Key)
+		}
+	}
+
+	return result, nil
+}
+
+func (s *Storage) GetObjectStream(key string, versionID string) (*s3.ObjectStream, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	version, err := s.find(key, versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := &s3.ObjectStream{
+		Body:           io.NopCloser(bytes.NewReader(version.content)),
+		ContentLength:  int64(len(version.content)),
+		ChecksumCRC32C: version.crc32c,
+		Metadata:       maps.Clone(version.metadata),
+	}
+	if version.retention != nil {
+		retention := *version.retention
+		stream.Retention = &retention
+	}
+
+	return stream, nil
+}
+
+func (s *Storage) PutObjectStream(key string, stream *s3.ObjectStream) error {
+	content, err := io.ReadAll(stream.Body)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.put(key, content, stream.ChecksumCRC32C, stream.Retention, maps.Clone(stream.Metadata))
+	return err
+}
+
+// GetVersions returns all versions of a key, oldest first.
+func (s *Storage) GetVersions(key string) [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	contents := [][]byte{}
+	for _, version := range s.objects[key] {
+		if !version.deleteMarker {
+			contents = append(contents, version.content)
+		}
+	}
+	return contents
+}
+
+func (s *Storage) put(key string, content []byte, crc32cChecksum string, retention *s3.ObjectLockRetention, metadata map[string]string) (*object, error) {
+	crc := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	_, _ = crc.Write(content)
+	if expected := base64.StdEncoding.EncodeToString(crc.Sum(nil)); expected != crc32cChecksum {
+		return nil, fmt.Errorf("proposed checksum '%s' does not equal expected '%s'", crc32cChecksum, expected)
+	}
+
+	version := &object{
+		key:          key,
+		versionID:    s.generateVersionID(),
+		content:      content,
+		lastModified: s.now,
+		crc32c:       crc32cChecksum,
+		metadata:     metadata,
+	}
+	if retention != nil {
+		version.retention = &s3.ObjectLockRetention{Mode: retention.Mode, Until: retention.Until.Truncate(time.Second)}
+		if version.retention.Until.Before(s.now.Truncate(time.Second)) {
+			return nil, fmt.Errorf("retain until must be after now")
+		}
+	}
+
+	s.objects[key] = append(s.objects[key], version)
+	return version, nil
+}
+
+func (s *Storage) find(key string, versionID string) (*object, error) {
+	versions := s.objects[key]
+
+	var version *object
+	if versionID == "" {
+		if len(versions) > 0 {
+			version = versions[len(versions)-1]
+		}
+	} else {
+		i := slices.IndexFunc(versions, func(o *object) bool { return o.versionID == versionID })
+		if i >= 0 {
+			version = versions[i]
+		}
+	}
+
+	if version == nil || version.deleteMarker {
+		return nil, fmt.Errorf("%s %s not found", key, versionID)
+	}
+
+	return version, nil
+}
+
+func (s *Storage) generateVersionID() string {
+	s.nextVersionID++
+	return fmt.Sprintf("%04d", s.nextVersionID)
+}
@@ -0,0 +1,47 @@
+package memstorage_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	fakes3 "github.com/bradenrayhorn/pickle/internal/fake_s3"
+	"github.com/bradenrayhorn/pickle/internal/memstorage"
+	"github.com/bradenrayhorn/pickle/internal/testutils/assert"
+	"github.com/bradenrayhorn/pickle/s3"
+)
+
+func TestObjectLock(t *testing.T) {
+	storage := memstorage.New()
+
+	now := time.Date(2025, time.June, 20, 0, 0, 0, 0, time.UTC)
+	storage.SetNow(now)
+
+	data := []byte("abc")
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	compliance, err := storage.PutObjectWithMetadata("compliance.txt", bytes.NewReader(data), 3, crc32c, sha256, &s3.ObjectLockRetention{Mode: s3.LockModeCompliance, Until: now.Add(time.Hour)}, nil)
+	assert.NoErr(t, err)
+
+	// can't delete a locked file
+	res, err := storage.DeleteObjects([]s3.ObjectIdentifier{{Key: "compliance.txt", VersionID: compliance.VersionID}})
+	assert.NoErr(t, err)
+	assert.Equal(t, 1, len(res.Error))
+	assert.True(t, res.Error[0].IsObjectLocked())
+
+	// can extend a compliance lock, but not shorten or downgrade it
+	assert.NoErr(t, storage.PutObjectRetention("compliance.txt", compliance.VersionID, &s3.ObjectLockRetention{Mode: s3.LockModeCompliance, Until: now.Add(2 * time.Hour)}))
+	err = storage.PutObjectRetention("compliance.txt", compliance.VersionID, &s3.ObjectLockRetention{Mode: s3.LockModeCompliance, Until: now.Add(30 * time.Minute)})
+	assert.True(t, errors.Is(err, s3.ErrObjectLocked))
+	err = storage.PutObjectRetention("compliance.txt", compliance.VersionID, &s3.ObjectLockRetention{Mode: s3.LockModeGovernance, Until: now.Add(3 * time.Hour)})
+	assert.True(t, errors.Is(err, s3.ErrObjectLocked))
+
+	// a governance lock can be raised to compliance
+	governance, err := storage.PutObjectWithMetadata("governance.txt", bytes.NewReader(data), 3, crc32c, sha256, &s3.ObjectLockRetention{Mode: s3.LockModeGovernance, Until: now.Add(time.Hour)}, nil)
+	assert.NoErr(t, err)
+	assert.NoErr(t, storage.PutObjectRetention("governance.txt", governance.VersionID, &s3.ObjectLockRetention{Mode: s3.LockModeCompliance, Until: now.Add(time.Hour)}))
+
+	// once the lock runs out it can be set to anything
+	storage.SetNow(now.Add(3 * time.Hour))
+	assert.NoErr(t, storage.PutObjectRetention("compliance.txt", compliance.VersionID, &s3.ObjectLockRetention{Mode: s3.LockModeGovernance, Until: now.Add(4 * time.Hour)}))
+}
@@ -0,0 +1,474 @@
+// Package localfs stores a bucket in a local directory, such as a NAS or an external drive.
+//
+// Every version of an object is kept as a data file next to a JSON sidecar holding its
+// metadata and lock. The versions of a key share a directory named by the SHA-256 of the key,
+// keys can be longer than a file name may be, so the key itself is only kept in the sidecars.
+// Object lock is simulated: locked versions can't be deleted and COMPLIANCE locks can't be
+// shortened.
+package localfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bradenrayhorn/pickle/s3"
+	"github.com/segmentio/ksuid"
+)
+
+type sidecar struct {
+	Key          string                  `json:"key"`
+	VersionID    string                  `json:"versionID"`
+	LastModified time.Time               `json:"lastModified"`
+	DeleteMarker bool                    `json:"deleteMarker,omitempty"`
+	Size         int64                   `json:"size"`
+	CRC32C       string                  `json:"crc32c,omitempty"`
+	Retention    *s3.ObjectLockRetention `json:"retention,omitempty"`
+	Metadata     map[string]string       `json:"metadata,omitempty"`
+}
+
+type Storage struct {
+	mu   sync.Mutex
+	root string
+	now  func() time.Time
+}
+
+func New(root string) (*Storage, error) {
+	if err := os.MkdirAll(filepath.Join(root, "objects"), 0700); err != nil {
+		return nil, fmt.Errorf("create %s: %w", root, err)
+	}
+
+	return &Storage{
+		root: root,
+		now:  func() time.Time { return time.Now().UTC() },
+	}, nil
+}
+
+func (s *Storage) SetNow(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.now = func() time.Time { return now.UTC() }
+}
+
+func (s *Storage) ListAllObjectVersions(prefix string) (*s3.ListAllObjectVersionsResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(filepath.Join(s.root, "objects"))
+	if err != nil {
+		return nil, fmt.Errorf("read objects: %w", err)
+	}
+
+	keys := [][]*sidecar{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		versions, err := s.readVersionsIn(filepath.Join(s.root, "objects", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if len(versions) > 0 && strings.HasPrefix(versions[0].Key, prefix) {
+			keys = append(keys, versions)
+		}
+	}
+	slices.SortFunc(keys, func(a, b []*sidecar) int {
+		return strings.Compare(a[0].Key, b[0].Key)
+	})
+
+	result := &s3.ListAllObjectVersionsResult{}
+	for _, versions := range keys {
+
+		// newest to oldest
+		for i := len(versions) - 1; i >= 0; i-- {
+			version := versions[i]
+			isLatest := i == len(versions)-1
+
+			if version.DeleteMarker {
+				result.DeleteMarkers = append(result.DeleteMarkers, s3.DeleteMarker{
+					Key:       version.Key,
+					VersionId: version.VersionID,
+					IsLatest:  isLatest,
+				})
+			} else {
+				result.Versions = append(result.Versions, s3.VersionInfo{
+					Key:          version.Key,
+					VersionId:    version.VersionID,
+					IsLatest:     isLatest,
+					LastModified: version.LastModified.Format(time.RFC3339),
+					Size:         uint64(version.Size),
+					StorageClass: "STANDARD",
+				})
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func (s *Storage) GetObject(key string, versionID string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	version, err := s.find(key, versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Open(s.dataPath(key, version.VersionID))
+}
+
+func (s *Storage) HeadObject(key string, versionID string) (*s3.ObjectMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	version, err := s.find(key, versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	sha256 := version.Metadata["pickle-sha256"]
+	if sha256 == "" {
+		return nil, fmt.Errorf("pickle-sha256 metadata missing from %s %s", key, versionID)
+	}
+	id := version.Metadata["pickle-id"]
+	if id == "" {
+		return nil, fmt.Errorf("pickle-id metadata missing from %s %s", key, versionID)
+	}
+
+	meta := &s3.ObjectMetadata{
+		Key:               key,
+		VersionID:         version.VersionID,
+		PickleSHA256:      sha256,
+		PickleID:          id,
+		PickleContentHMAC: version.Metadata["pickle-content-hmac"],
+		PickleCompression: version.Metadata["pickle-compression"],
+		Size:              version.Size,
+	}
+	if version.Retention != nil {
+		meta.ObjectLockMode = version.Retention.Mode
+		meta.ObjectLockRetainUntilDate = version.Retention.Until
+	}
+
+	return meta, nil
+}
+
+func (s *Storage) PutObjectWithMetadata(key string, data io.ReadSeeker, dataLength int64, crc32cChecksum []byte, sha256Checksum []byte, retention *s3.ObjectLockRetention, metadata map[string]string) (*s3.PutObjectResponse, error) {
+	objectMetadata := maps.Clone(metadata)
+	if objectMetadata == nil {
+		objectMetadata = map[string]string{}
+	}
+	objectMetadata["pickle-sha256"] = hex.EncodeToString(sha256Checksum)
+	objectMetadata["pickle-id"] = ksuid.New().String()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	version, err := s.put(key, data, dataLength, base64.StdEncoding.EncodeToString(crc32cChecksum), retention, objectMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3.PutObjectResponse{VersionID: version.VersionID}, nil
+}
+
+func (s *Storage) PutObjectRetention(key string, versionID string, retention *s3.ObjectLockRetention) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	version, err := s.find(key, versionID)
+	if err != nil {
+		return err
+	}
+
+	until := retention.Until.UTC().Truncate(time.Second)
+	if until.Before(s.now().Truncate(time.Second)) {
+		return fmt.Errorf("retain until must be after now")
+	}
+	if current := version.Retention; current != nil && current.Mode == "COMPLIANCE" && until.Before(current.Until) && current.Until.After(s.now()) {
+		return fmt.Errorf("%w: %s %s is locked in compliance mode until %s", s3.ErrObjectLocked, key, version.VersionID, current.Until.Format(time.RFC3339))
+	}
+
+	version.Retention = &s3.ObjectLockRetention{Mode: retention.Mode, Until: until}
+	return s.writeSidecar(version)
+}
+
+func (s *Storage) DeleteObjects(objects []s3.ObjectIdentifier) (*s3.DeleteObjectsResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := &s3.DeleteObjectsResult{}
+	for _, identifier := range objects {
+		versions, err := s.readVersions(identifier.Key)
+		if err != nil {
+			return nil, err
+		}
+		if len(versions) == 0 {
+			continue
+		}
+
+		if identifier.VersionID == "" {
+			marker := &sidecar{
+				Key:          identifier.Key,
+				VersionID:    s.generateVersionID(versions),
+				LastModified: s.now(),
+				DeleteMarker: true,
+			}
+			if err := s.writeSidecar(marker); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		i := slices.IndexFunc(versions, func(v *sidecar) bool { return v.VersionID == identifier.VersionID })
+		if i < 0 {
+			continue
+		}
+
+		if retention := versions[i].Retention; retention != nil && retention.Until.After(s.now()) {
+			result.Error = append(result.Error, s3.DeletedError{
+				Key:       identifier.Key,
+				VersionID: identifier.VersionID,
+				Code:      "AccessDenied",
+				Message:   "Access Denied because object protected by object lock.",
+			})
+			continue
+		}
+
+		// remove the sidecar first so a partial delete never leaves a version without data
+		if err := os.Remove(s.sidecarPath(identifier.Key, identifier.VersionID)); err != nil {
+			return nil, fmt.Errorf("delete %s %s: %w", identifier.Key, identifier.VersionID, err)
+		}
+		if err := os.Remove(s.dataPath(identifier.Key, identifier.VersionID)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("delete %s %s: %w", identifier.Key, identifier.VersionID, err)
+		}
+		if len(versions) == 1 {
+			_ = os.Remove(s.keyPath(identifier.Key))
+		}
+	}
+
+	return result, nil
+}
+
+func (s *Storage) GetObjectStream(key string, versionID string) (*s3.ObjectStream, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	version, err := s.find(key, versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := os.Open(s.dataPath(key, version.VersionID))
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3.ObjectStream{
+		Body:           body,
+		ContentLength:  version.Size,
+		ChecksumCRC32C: version.CRC32C,
+		Retention:      version.Retention,
+		Metadata:       maps.Clone(version.Metadata),
+	}, nil
+}
+
+func (s *Storage) PutObjectStream(key string, stream *s3.ObjectStream) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.put(key, stream.Body, stream.ContentLength, stream.ChecksumCRC32C, stream.Retention, maps.Clone(stream.Metadata))
+	return err
+}
+
+func (s *Storage) put(key string, data io.Reader, dataLength int64, crc32cChecksum string, retention *s3.ObjectLockRetention, metadata map[string]string) (*sidecar, error) {
+	versions, err := s.readVersions(key)
+	if err != nil {
+		return nil, err
+	}
+
+	version := &sidecar{
+		Key:          key,
+		VersionID:    s.generateVersionID(versions),
+		LastModified: s.now(),
+		Size:         dataLength,
+		CRC32C:       crc32cChecksum,
+		Metadata:     metadata,
+	}
+	if retention != nil {
+		version.Retention = &s3.ObjectLockRetention{Mode: retention.Mode, Until: retention.Until.UTC().Truncate(time.Second)}
+		if version.Retention.Until.Before(s.now().Truncate(time.Second)) {
+			return nil, fmt.Errorf("retain until must be after now")
+		}
+	}
+
+	if err := os.MkdirAll(s.keyPath(key), 0700); err != nil {
+		return nil, fmt.Errorf("create %s: %w", key, err)
+	}
+
+	crc := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	written, err := writeFileAtomic(s.dataPath(key, version.VersionID), io.TeeReader(data, crc))
+	if err != nil {
+		return nil, fmt.Errorf("write %s: %w", key, err)
+	}
+
+	if expected := base64.StdEncoding.EncodeToString(crc.Sum(nil)); expected != crc32cChecksum || written != dataLength {
+		_ = os.Remove(s.dataPath(key, version.VersionID))
+		return nil, fmt.Errorf("write %s: checksum or length does not match", key)
+	}
+
+	// the sidecar is written last, a version only exists once it has one
+	if err := s.writeSidecar(version); err != nil {
+		_ = os.Remove(s.dataPath(key, version.VersionID))
+		return nil, err
+	}
+
+	return version, nil
+}
+
+func (s *Storage) find(key string, versionID string) (*sidecar, error) {
+	versions, err := s.readVersions(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var version *sidecar
+	if versionID == "" {
+		if len(versions) > 0 {
+			version = versions[len(versions)-1]
+		}
+	} else {
+		i := slices.IndexFunc(versions, func(v *sidecar) bool { return v.VersionID == versionID })
+		if i >= 0 {
+			version = versions[i]
+		}
+	}
+
+	if version == nil || version.DeleteMarker {
+		return nil, fmt.Errorf("%s %s not found", key, versionID)
+	}
+
+	return version, nil
+}
+
+// readVersions returns all versions of a key, oldest first.
+func (s *Storage) readVersions(key string) ([]*sidecar, error) {
+	versions, err := s.readVersionsIn(s.keyPath(key))
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", key, err)
+	}
+	return versions, nil
+}
+
+func (s *Storage) readVersionsIn(dir string) ([]*sidecar, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []*sidecar{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	versions := []*sidecar{}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", entry.Name(), err)
+		}
+
+		version := &sidecar{}
+		if err := json.Unmarshal(data, version); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", entry.Name(), err)
+		}
+		versions = append(versions, version)
+	}
+
+	slices.SortFunc(versions, func(a, b *sidecar) int {
+		return strings.Compare(a.VersionID, b.VersionID)
+	})
+
+	return versions, nil
+}
+
+func (s *Storage) writeSidecar(version *sidecar) error {
+	data, err := json.Marshal(version)
+	if err != nil {
+		return fmt.Errorf("encode sidecar: %w", err)
+	}
+
+	if err := os.MkdirAll(s.keyPath(version.Key), 0700); err != nil {
+		return fmt.Errorf("create %s: %w", version.Key, err)
+	}
+
+	if _, err := writeFileAtomic(s.sidecarPath(version.Key, version.VersionID), bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("write sidecar: %w", err)
+	}
+	return nil
+}
+
+// generateVersionID returns an ID that sorts after the existing versions of the key, also when
+// the clock went back or the directory was written by an earlier run.
+func (s *Storage) generateVersionID(versions []*sidecar) string {
+	id := s.now().UnixNano()
+	if len(versions) > 0 {
+		if latest, err := strconv.ParseInt(versions[len(versions)-1].VersionID, 10, 64); err == nil {
+			id = max(id, latest+1)
+		}
+	}
+	return fmt.Sprintf("%019d", id)
+}
+
+func (s *Storage) keyPath(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(s.root, "objects", hex.EncodeToString(hash[:]))
+}
+
+func (s *Storage) dataPath(key string, versionID string) string {
+	return filepath.Join(s.keyPath(key), versionID+".data")
+}
+
+func (s *Storage) sidecarPath(key string, versionID string) string {
+	return filepath.Join(s.keyPath(key), versionID+".json")
+}
+
+func writeFileAtomic(path string, data io.Reader) (int64, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	written, err := io.Copy(tmp, data)
+	if err != nil {
+		_ = tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+
+	return written, os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,208 @@
+package localfs_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	fakes3 "github.com/bradenrayhorn/pickle/internal/fake_s3"
+	"github.com/bradenrayhorn/pickle/internal/testutils/assert"
+	"github.com/bradenrayhorn/pickle/localfs"
+	"github.com/bradenrayhorn/pickle/s3"
+)
+
+func TestCanPutListAndGetObjects(t *testing.T) {
+	root := t.TempDir()
+	storage, err := localfs.New(root)
+	assert.NoErr(t, err)
+
+	now := time.Date(2025, time.June, 20, 0, 0, 0, 0, time.UTC)
+	storage.SetNow(now)
+
+	// put two versions of a file
+	data := []byte("abc")
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	v1, err := storage.PutObjectWithMetadata("nested/my-file.txt", bytes.NewReader(data), 3, crc32c, sha256, nil, map[string]string{"pickle-compression": "gzip"})
+	assert.NoErr(t, err)
+	v2, err := storage.PutObjectWithMetadata("nested/my-file.txt", bytes.NewReader(data), 3, crc32c, sha256, nil, nil)
+	assert.NoErr(t, err)
+
+	// versions survive reopening the directory
+	storage, err = localfs.New(root)
+	assert.NoErr(t, err)
+
+	result, err := storage.ListAllObjectVersions("nested/")
+	assert.NoErr(t, err)
+	assert.Equal(t, 2, len(result.Versions))
+	assert.Equal(t, s3.VersionInfo{
+		Key:          "nested/my-file.txt",
+		VersionId:    v2.VersionID,
+		IsLatest:     true,
+		LastModified: now.Format(time.RFC3339),
+		Size:         3,
+		StorageClass: "STANDARD",
+	}, result.Versions[0])
+	assert.Equal(t, v1.VersionID, result.Versions[1].VersionId)
+
+	// can read data and metadata back
+	body, err := storage.GetObject("nested/my-file.txt", v1.VersionID)
+	assert.NoErr(t, err)
+	defer func() { _ = body.Close() }()
+	content, err := io.ReadAll(body)
+	assert.NoErr(t, err)
+	assert.Equal(t, "abc", string(content))
+
+	meta, err := storage.HeadObject("nested/my-file.txt", v1.VersionID)
+	assert.NoErr(t, err)
+	assert.Equal(t, hex.EncodeToString(sha256), meta.PickleSHA256)
+	assert.Equal(t, "gzip", meta.PickleCompression)
+	assert.NotZero(t, meta.PickleID)
+
+	// other prefixes are not listed
+	result, err = storage.ListAllObjectVersions("other/")
+	assert.NoErr(t, err)
+	assert.Equal(t, 0, len(result.Versions))
+}
+
+func TestLongAndDeepKeys(t *testing.T) {
+	root := t.TempDir()
+	storage, err := localfs.New(root)
+	assert.NoErr(t, err)
+
+	// far longer than the 255 bytes a file name may have
+	key := strings.Repeat("a-rather-long-directory-name/", 20) + "my-file.txt"
+
+	data := []byte("abc")
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	version, err := storage.PutObjectWithMetadata(key, bytes.NewReader(data), 3, crc32c, sha256, nil, nil)
+	assert.NoErr(t, err)
+
+	storage, err = localfs.New(root)
+	assert.NoErr(t, err)
+
+	result, err := storage.ListAllObjectVersions("a-rather-long-directory-name/")
+	assert.NoErr(t, err)
+	assert.Equal(t, 1, len(result.Versions))
+	assert.Equal(t, key, result.Versions[0].Key)
+	assert.Equal(t, version.VersionID, result.Versions[0].VersionId)
+
+	body, err := storage.GetObject(key, "")
+	assert.NoErr(t, err)
+	defer func() { _ = body.Close() }()
+	content, err := io.ReadAll(body)
+	assert.NoErr(t, err)
+	assert.Equal(t, "abc", string(content))
+}
+
+func TestVersionIDsFollowTheClockAndExistingVersions(t *testing.T) {
+	root := t.TempDir()
+	storage, err := localfs.New(root)
+	assert.NoErr(t, err)
+
+	now := time.Date(2025, time.June, 20, 0, 0, 0, 0, time.UTC)
+	storage.SetNow(now)
+
+	data := []byte("abc")
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	v1, err := storage.PutObjectWithMetadata("my-file.txt", bytes.NewReader(data), 3, crc32c, sha256, nil, nil)
+	assert.NoErr(t, err)
+	assert.Equal(t, fmt.Sprintf("%019d", now.UnixNano()), v1.VersionID)
+
+	// a new run with the clock set back still sorts after the versions on disk
+	storage, err = localfs.New(root)
+	assert.NoErr(t, err)
+	storage.SetNow(now.Add(-time.Hour))
+
+	v2, err := storage.PutObjectWithMetadata("my-file.txt", bytes.NewReader(data), 3, crc32c, sha256, nil, nil)
+	assert.NoErr(t, err)
+	assert.Equal(t, fmt.Sprintf("%019d", now.UnixNano()+1), v2.VersionID)
+
+	result, err := storage.ListAllObjectVersions("")
+	assert.NoErr(t, err)
+	assert.Equal(t, v2.VersionID, result.Versions[0].VersionId)
+	assert.True(t, result.Versions[0].IsLatest)
+}
+
+func TestRejectsBadChecksum(t *testing.T) {
+	storage, err := localfs.New(t.TempDir())
+	assert.NoErr(t, err)
+
+	crc32c, sha256 := fakes3.GetChecksums([]byte("xyz"))
+	_, err = storage.PutObjectWithMetadata("my-file.txt", bytes.NewReader([]byte("abc")), 3, crc32c, sha256, nil, nil)
+	assert.ErrContains(t, err, "checksum")
+
+	result, err := storage.ListAllObjectVersions("")
+	assert.NoErr(t, err)
+	assert.Equal(t, 0, len(result.Versions))
+}
+
+func TestObjectLock(t *testing.T) {
+	storage, err := localfs.New(t.TempDir())
+	assert.NoErr(t, err)
+
+	now := time.Date(2025, time.June, 20, 0, 0, 0, 0, time.UTC)
+	storage.SetNow(now)
+
+	data := []byte("abc")
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	version, err := storage.PutObjectWithMetadata("my-file.txt", bytes.NewReader(data), 3, crc32c, sha256, &s3.ObjectLockRetention{Mode: "COMPLIANCE", Until: now.Add(time.Hour)}, nil)
+	assert.NoErr(t, err)
+
+	// can't delete a locked file
+	res, err := storage.DeleteObjects([]s3.ObjectIdentifier{{Key: "my-file.txt", VersionID: version.VersionID}})
+	assert.NoErr(t, err)
+	assert.Equal(t, 1, len(res.Error))
+	assert.Equal(t, "Access Denied because object protected by object lock.", res.Error[0].Message)
+
+	// can extend the lock, but not shorten it
+	err = storage.PutObjectRetention("my-file.txt", version.VersionID, &s3.ObjectLockRetention{Mode: "COMPLIANCE", Until: now.Add(2 * time.Hour)})
+	assert.NoErr(t, err)
+	err = storage.PutObjectRetention("my-file.txt", version.VersionID, &s3.ObjectLockRetention{Mode: "COMPLIANCE", Until: now.Add(30 * time.Minute)})
+	assert.ErrContains(t, err, "locked in compliance mode")
+
+	meta, err := storage.HeadObject("my-file.txt", version.VersionID)
+	assert.NoErr(t, err)
+	assert.Equal(t, now.Add(2*time.Hour), meta.ObjectLockRetainUntilDate)
+
+	// once the lock expires the file can be deleted
+	storage.SetNow(now.Add(3 * time.Hour))
+	res, err = storage.DeleteObjects([]s3.ObjectIdentifier{{Key: "my-file.txt", VersionID: version.VersionID}})
+	assert.NoErr(t, err)
+	assert.Equal(t, 0, len(res.Error))
+
+	result, err := storage.ListAllObjectVersions("")
+	assert.NoErr(t, err)
+	assert.Equal(t, 0, len(result.Versions))
+}
+
+func TestObjectStreamKeepsMetadata(t *testing.T) {
+	src, err := localfs.New(t.TempDir())
+	assert.NoErr(t, err)
+	dst, err := localfs.New(t.TempDir())
+	assert.NoErr(t, err)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	data := []byte("abc")
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	version, err := src.PutObjectWithMetadata("my-file.txt", bytes.NewReader(data), 3, crc32c, sha256, &s3.ObjectLockRetention{Mode: "COMPLIANCE", Until: now.Add(time.Hour)}, nil)
+	assert.NoErr(t, err)
+
+	stream, err := src.GetObjectStream("my-file.txt", version.VersionID)
+	assert.NoErr(t, err)
+	assert.NoErr(t, dst.PutObjectStream("copied.txt", stream))
+	assert.NoErr(t, stream.Body.Close())
+
+	srcMeta, err := src.HeadObject("my-file.txt", "")
+	assert.NoErr(t, err)
+	dstMeta, err := dst.HeadObject("copied.txt", "")
+	assert.NoErr(t, err)
+
+	assert.Equal(t, srcMeta.PickleID, dstMeta.PickleID)
+	assert.Equal(t, srcMeta.PickleSHA256, dstMeta.PickleSHA256)
+	assert.Equal(t, "COMPLIANCE", dstMeta.ObjectLockMode)
+	assert.Equal(t, now.Add(time.Hour), dstMeta.ObjectLockRetainUntilDate)
+}
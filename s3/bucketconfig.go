@@ -0,0 +1,128 @@
+package s3
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	VersioningEnabled   = "Enabled"
+	VersioningSuspended = "Suspended"
+)
+
+type ObjectLockConfiguration struct {
+	Enabled bool
+
+	// DefaultRetention is applied to objects uploaded without a retention of their own. It is
+	// nil when the bucket has no default.
+	DefaultRetention *DefaultRetention
+}
+
+type DefaultRetention struct {
+	Mode  string
+	Days  int
+	Years int
+}
+
+// Period is how long the default retention locks an object for.
+func (r DefaultRetention) Period() time.Duration {
+	return time.Duration(r.Days)*24*time.Hour + time.Duration(r.Years)*365*24*time.Hour
+}
+
+// GetBucketVersioning returns the versioning status of the bucket, VersioningEnabled or
+// VersioningSuspended. It is empty if versioning was never turned on.
+func (c *Client) GetBucketVersioning() (string, error) {
+	var result struct {
+		Status string `xml:"Status"`
+	}
+
+	err := c.getBucketConfiguration("GetBucketVersioning", "versioning", &result)
+	if err != nil {
+		return "", err
+	}
+
+	return result.Status, nil
+}
+
+// GetObjectLockConfiguration returns the object lock configuration of the bucket. A bucket
+// created without object lock is reported as not enabled rather than as an error.
+func (c *Client) GetObjectLockConfiguration() (*ObjectLockConfiguration, error) {
+	var result struct {
+		ObjectLockEnabled string `xml:"ObjectLockEnabled"`
+		Rule              *struct {
+			DefaultRetention struct {
+				Mode  string `xml:"Mode"`
+				Days  int    `xml:"Days"`
+				Years int    `xml:"Years"`
+			} `xml:"DefaultRetention"`
+		} `xml:"Rule"`
+	}
+
+	err := c.getBucketConfiguration("GetObjectLockConfiguration", "object-lock", &result)
+	if err != nil {
+		if strings.Contains(err.Error(), "ObjectLockConfigurationNotFoundError") {
+			return &ObjectLockConfiguration{}, nil
+		}
+		return nil, err
+	}
+
+	config := &ObjectLockConfiguration{Enabled: result.ObjectLockEnabled == "Enabled"}
+	if result.Rule != nil {
+		config.DefaultRetention = &DefaultRetention{
+			Mode:  result.Rule.DefaultRetention.Mode,
+			Days:  result.Rule.DefaultRetention.Days,
+			Years: result.Rule.DefaultRetention.Years,
+		}
+	}
+
+	return config, nil
+}
+
+// getBucketConfiguration reads one of the bucket's configuration documents into result.
+func (c *Client) getBucketConfiguration(operation string, subresource string, result any) error {
+	query := url.Values{}
+	query.Set(subresource, "")
+
+	reqURL := c.buildURL("", query)
+
+	_, err := withRetries(func() (any, error) {
+		req, err := http.NewRequest(http.MethodGet, reqURL, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.signV4(req, nil); err != nil {
+			return nil, err
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, retriableError{err}
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			err := fmt.Errorf("%s failed with status: %s, response: %s", operation, resp.Status, string(body))
+
+			if resp.StatusCode >= 500 {
+				return nil, retriableError{err}
+			} else {
+				return nil, err
+			}
+		}
+
+		if err := xml.NewDecoder(resp.Body).Decode(result); err != nil {
+			return nil, fmt.Errorf("failed to parse %s XML: %v", operation, err)
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
@@ -0,0 +1,51 @@
+package s3_test
+
+import (
+	"testing"
+	"time"
+
+	fakes3 "github.com/bradenrayhorn/pickle/internal/fake_s3"
+	"github.com/bradenrayhorn/pickle/internal/testutils/assert"
+	"github.com/bradenrayhorn/pickle/s3"
+)
+
+func TestGetBucketVersioning(t *testing.T) {
+	sv, client := newSigningTestClient(t, "keyid", "shh")
+
+	status, err := client.GetBucketVersioning()
+	assert.NoErr(t, err)
+	assert.Equal(t, s3.VersioningEnabled, status)
+
+	sv.SetVersioning("Suspended")
+	status, err = client.GetBucketVersioning()
+	assert.NoErr(t, err)
+	assert.Equal(t, s3.VersioningSuspended, status)
+
+	sv.SetVersioning("")
+	status, err = client.GetBucketVersioning()
+	assert.NoErr(t, err)
+	assert.Equal(t, "", status)
+}
+
+func TestGetObjectLockConfiguration(t *testing.T) {
+	sv, client := newSigningTestClient(t, "keyid", "shh")
+
+	config, err := client.GetObjectLockConfiguration()
+	assert.NoErr(t, err)
+	assert.True(t, config.Enabled)
+	assert.True(t, config.DefaultRetention == nil)
+
+	sv.SetObjectLock(true, &fakes3.DefaultRetention{Mode: "GOVERNANCE", Days: 3})
+	config, err = client.GetObjectLockConfiguration()
+	assert.NoErr(t, err)
+	assert.True(t, config.Enabled)
+	assert.Equal(t, s3.DefaultRetention{Mode: "GOVERNANCE", Days: 3}, *config.DefaultRetention)
+	assert.Equal(t, 72*time.Hour, config.DefaultRetention.Period())
+
+	// a bucket without object lock has no configuration at all
+	sv.SetObjectLock(false, nil)
+	config, err = client.GetObjectLockConfiguration()
+	assert.NoErr(t, err)
+	assert.True(t, !config.Enabled)
+	assert.True(t, config.DefaultRetention == nil)
+}
@@ -0,0 +1,227 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	// streamingPayload is the payload hash of aws-chunked bodies whose chunks are signed one by
+	// one, followed by a signed trailer with the checksum.
+	streamingPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+
+	streamingChunkSize = 64 * 1024
+
+	chunkSignatureLength = 64
+	crc32cTrailerName    = "x-amz-checksum-crc32c"
+)
+
+// PutObjectChunked uploads data without knowing its checksums up front. The body is sent
+// aws-chunked, each chunk signed as it is read, and the CRC32C is sent in a trailer once all of
+// data has been read. Only data that is also an io.Seeker can be retried.
+func (c *Client) PutObjectChunked(key string, data io.Reader, dataLength int64, retention *ObjectLockRetention, metadata map[string]string) (*PutObjectResponse, error) {
+	reqURL := c.buildURL(key, nil)
+
+	put := func() (*PutObjectResponse, error) {
+		// always reset data reader at the start
+		if seeker, ok := data.(io.Seeker); ok {
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+
+		req, err := http.NewRequest(http.MethodPut, reqURL, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set("Content-Encoding", "aws-chunked")
+		req.Header.Set("x-amz-decoded-content-length", strconv.FormatInt(dataLength, 10))
+		req.Header.Set("x-amz-sdk-checksum-algorithm", "CRC32C")
+		req.Header.Set("x-amz-trailer", crc32cTrailerName)
+		req.ContentLength = chunkedLength(dataLength)
+
+		if retention != nil {
+			setRetentionHeaders(req, retention)
+		}
+
+		if c.storageClass != "" {
+			req.Header.Set("x-amz-storage-class", c.storageClass)
+		}
+
+		req.Header.Set("x-amz-meta-pickle-id", ksuid.New().String())
+		for k, v := range metadata {
+			req.Header.Set("x-amz-meta-"+k, v)
+		}
+
+		// sign the headers, the body is signed as it is sent
+		signer, err := c.signStreaming(req)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(&chunkedReader{
+			data:      io.LimitReader(data, dataLength),
+			remaining: dataLength,
+			signer:    signer,
+			crc32c:    crc32.New(crc32.MakeTable(crc32.Castagnoli)),
+		})
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, retriableError{err}
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+			body, _ := io.ReadAll(resp.Body)
+			err := fmt.Errorf("PutObject failed with status: %s, response: %s", resp.Status, string(body))
+
+			if resp.StatusCode >= 500 {
+				return nil, retriableError{err}
+			} else {
+				return nil, err
+			}
+		}
+
+		return &PutObjectResponse{
+			VersionID: resp.Header.Get("x-amz-version-id"),
+		}, nil
+	}
+
+	if _, ok := data.(io.Seeker); !ok {
+		// a stream can't be read a second time
+		return put()
+	}
+	return withRetries(put)
+}
+
+// chunkSigner signs the chunks of a streaming body. Every signature covers the one before it,
+// starting from the signature of the request headers.
+type chunkSigner struct {
+	key      []byte
+	amzDate  string
+	scope    string
+	previous string
+}
+
+func (c *Client) signStreaming(req *http.Request) (*chunkSigner, error) {
+	credentials, err := c.credentials.get()
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("x-amz-content-sha256", streamingPayload)
+	if credentials.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", credentials.SessionToken)
+	}
+
+	t := c.clock.now()
+	dateStamp := t.Format("20060102")
+	seed := signRequest(req, credentials, c.region, "s3", t, streamingPayload)
+
+	return &chunkSigner{
+		key:      signingKey(credentials.SecretAccessKey, dateStamp, c.region, "s3"),
+		amzDate:  t.Format("20060102T150405Z"),
+		scope:    fmt.Sprintf("%s/%s/s3/aws4_request", dateStamp, c.region),
+		previous: seed,
+	}, nil
+}
+
+func (s *chunkSigner) sign(algorithm string, parts ...string) string {
+	stringToSign := strings.Join(append([]string{algorithm, s.amzDate, s.scope, s.previous}, parts...), "\n")
+	s.previous = hex.EncodeToString(hmacSHA256(s.key, []byte(stringToSign)))
+	return s.previous
+}
+
+func (s *chunkSigner) signChunk(chunk []byte) string {
+	chunkHash := sha256.Sum256(chunk)
+	return s.sign("AWS4-HMAC-SHA256-PAYLOAD", emptyStringSHA256, hex.EncodeToString(chunkHash[:]))
+}
+
+func (s *chunkSigner) signTrailer(trailer string) string {
+	trailerHash := sha256.Sum256([]byte(trailer))
+	return s.sign("AWS4-HMAC-SHA256-TRAILER", hex.EncodeToString(trailerHash[:]))
+}
+
+// chunkedReader encodes data as signed chunks, ending with an empty chunk and the trailer.
+type chunkedReader struct {
+	data      io.Reader
+	remaining int64
+	signer    *chunkSigner
+	crc32c    hash.Hash32
+
+	chunk   []byte
+	encoded bytes.Buffer
+	done    bool
+}
+
+func (r *chunkedReader) Read(p []byte) (int, error) {
+	for r.encoded.Len() == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.nextChunk(); err != nil {
+			return 0, err
+		}
+	}
+	return r.encoded.Read(p)
+}
+
+func (r *chunkedReader) nextChunk() error {
+	if r.remaining == 0 {
+		fmt.Fprintf(&r.encoded, "0;chunk-signature=%s\r\n", r.signer.signChunk(nil))
+
+		trailer := crc32cTrailerName + ":" + base64.StdEncoding.EncodeToString(r.crc32c.Sum(nil))
+		fmt.Fprintf(&r.encoded, "%s\r\n", trailer)
+		fmt.Fprintf(&r.encoded, "x-amz-trailer-signature:%s\r\n\r\n", r.signer.signTrailer(trailer+"\n"))
+
+		r.done = true
+		return nil
+	}
+
+	if r.chunk == nil {
+		r.chunk = make([]byte, streamingChunkSize)
+	}
+	chunk := r.chunk[:min(int64(streamingChunkSize), r.remaining)]
+	if _, err := io.ReadFull(r.data, chunk); err != nil {
+		return fmt.Errorf("read chunk: %w", err)
+	}
+	r.remaining -= int64(len(chunk))
+	_, _ = r.crc32c.Write(chunk)
+
+	fmt.Fprintf(&r.encoded, "%x;chunk-signature=%s\r\n", len(chunk), r.signer.signChunk(chunk))
+	r.encoded.Write(chunk)
+	r.encoded.WriteString("\r\n")
+	return nil
+}
+
+// chunkedLength is the length of dataLength bytes once they are encoded as signed chunks.
+func chunkedLength(dataLength int64) int64 {
+	chunkLength := func(size int64) int64 {
+		return int64(len(strconv.FormatInt(size, 16))+len(";chunk-signature=")+chunkSignatureLength+2) + size + 2
+	}
+
+	length := (dataLength / streamingChunkSize) * chunkLength(streamingChunkSize)
+	if rest := dataLength % streamingChunkSize; rest > 0 {
+		length += chunkLength(rest)
+	}
+
+	// the final chunk has no data and no trailing line break
+	length += chunkLength(0) - 2
+
+	trailer := len(crc32cTrailerName+":") + base64.StdEncoding.EncodedLen(crc32.Size) + 2
+	trailerSignature := len("x-amz-trailer-signature:") + chunkSignatureLength + 2
+	return length + int64(trailer+trailerSignature+2)
+}
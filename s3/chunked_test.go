@@ -0,0 +1,119 @@
+package s3_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"testing"
+
+	fakes3 "github.com/bradenrayhorn/pickle/internal/fake_s3"
+	"github.com/bradenrayhorn/pickle/internal/testutils/assert"
+)
+
+// onlyReader hides the Seek method of a reader, like a pipe or a network stream.
+type onlyReader struct{ io.Reader }
+
+func randomBytes(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(rand.IntN(256))
+	}
+	return data
+}
+
+func TestPutObjectChunked(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"empty", 0},
+		{"smaller than a chunk", 100},
+		{"exactly one chunk", 64 * 1024},
+		{"several chunks", 150*1024 + 7},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, client := newSigningTestClient(t, "keyid", "shh")
+
+			data := randomBytes(test.size)
+			crc32c, sha256 := fakes3.GetChecksums(data)
+			metadata := map[string]string{"pickle-sha256": hex.EncodeToString(sha256)}
+
+			version, err := client.PutObjectChunked("my-file.txt", onlyReader{bytes.NewReader(data)}, int64(len(data)), nil, metadata)
+			assert.NoErr(t, err)
+
+			stream, err := client.GetObjectStream("my-file.txt", version.VersionID)
+			assert.NoErr(t, err)
+			got, err := io.ReadAll(stream.Body)
+			assert.NoErr(t, err)
+			_ = stream.Body.Close()
+
+			assert.True(t, bytes.Equal(data, got))
+			assert.Equal(t, base64.StdEncoding.EncodeToString(crc32c), stream.ChecksumCRC32C)
+			assert.Equal(t, hex.EncodeToString(sha256), stream.Metadata["pickle-sha256"])
+		})
+	}
+}
+
+func TestPutObjectChunkedRetriesSeekableData(t *testing.T) {
+	sv, client := newSigningTestClient(t, "keyid", "shh")
+
+	failures := 0
+	sv.SetInterceptor(func(r *http.Request, w http.ResponseWriter) bool {
+		if failures < 2 {
+			_, _ = io.Copy(io.Discard, r.Body)
+			w.WriteHeader(http.StatusInternalServerError)
+			failures++
+			return true
+		}
+		return false
+	})
+
+	// seekable data is sent again
+	data := randomBytes(100 * 1024)
+	_, err := client.PutObjectChunked("my-file.txt", bytes.NewReader(data), int64(len(data)), nil, nil)
+	assert.NoErr(t, err)
+
+	// a stream can only be sent once
+	failures = 0
+	_, err = client.PutObjectChunked("my-file.txt", onlyReader{bytes.NewReader(data)}, int64(len(data)), nil, nil)
+	assert.ErrContains(t, err, "500 Internal Server Error")
+	assert.Equal(t, 1, failures)
+}
+
+func TestPutObjectChunkedFailsOnShortData(t *testing.T) {
+	_, client := newSigningTestClient(t, "keyid", "shh")
+
+	_, err := client.PutObjectChunked("my-file.txt", onlyReader{bytes.NewReader([]byte("abc"))}, 10, nil, nil)
+	assert.ErrContains(t, err, "read chunk")
+}
+
+func TestServerVerifiesChunkSignatures(t *testing.T) {
+	sv, client := newSigningTestClient(t, "keyid", "shh")
+
+	// flip a byte of the first chunk's data after it was signed
+	sv.SetInterceptor(func(r *http.Request, w http.ResponseWriter) bool {
+		if r.Method != http.MethodPut {
+			return false
+		}
+
+		body, err := io.ReadAll(r.Body)
+		assert.NoErr(t, err)
+		dataStart := bytes.Index(body, []byte("\r\n")) + 2
+		body[dataStart] ^= 0xff
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		return false
+	})
+
+	data := randomBytes(100)
+	_, err := client.PutObjectChunked("my-file.txt", onlyReader{bytes.NewReader(data)}, int64(len(data)), nil, nil)
+	assert.ErrContains(t, err, "<Code>SignatureDoesNotMatch</Code>")
+
+	result, err := client.ListObjectVersions("", "", "", 500)
+	assert.NoErr(t, err)
+	assert.Equal(t, 0, len(result.Versions))
+}
@@ -8,28 +8,36 @@ import (
 )
 
 type Client struct {
-	endpoint     string
+	endpoint     endpoint
 	region       string
-	accessKey    string
-	secretKey    string
+	credentials  *credentialsCache
 	bucketName   string
 	storageClass string
 
-	insecure bool
-
+	clock      *clock
 	httpClient *http.Client
 }
 
 func NewClient(config Config) *Client {
+	credentials := config.Credentials
+	if credentials == nil && config.KeyID != "" {
+		credentials = StaticCredentials{AccessKeyID: config.KeyID, SecretAccessKey: config.KeySecret, SessionToken: config.SessionToken}
+	} else if credentials == nil {
+		credentials = DefaultCredentials()
+	}
+
+	clock := &clock{onSkew: config.OnClockSkew}
+
 	return &Client{
-		endpoint:     config.URL,
+		endpoint:     parseEndpoint(config),
 		region:       config.Region,
-		accessKey:    config.KeyID,
-		secretKey:    config.KeySecret,
+		credentials:  &credentialsCache{provider: credentials},
 		bucketName:   config.Bucket,
 		storageClass: config.StorageClass,
-		insecure:     config.Insecure,
-		httpClient:   &http.Client{Timeout: 600 * time.Second},
+		clock:        clock,
+		httpClient: &http.Client{
+			Transport: &skewTransport{base: newTransport(config), clock: clock},
+		},
 	}
 }
 
@@ -47,19 +55,20 @@ type ObjectIdentifier struct {
 }
 
 func (c *Client) buildURL(key string, query url.Values) string {
-	path := fmt.Sprintf("/%s", c.bucketName)
-	if key != "" {
-		path = fmt.Sprintf("%s/%s", path, key)
+	host := c.endpoint.host
+	path := c.endpoint.basePath
+	if c.endpoint.virtualHosted {
+		host = c.bucketName + "." + host
+	} else {
+		path = fmt.Sprintf("%s/%s", path, c.bucketName)
 	}
-
-	scheme := "https"
-	if c.insecure {
-		scheme = "http"
+	if key != "" || c.endpoint.virtualHosted {
+		path = fmt.Sprintf("%s/%s", path, key)
 	}
 
 	u := url.URL{
-		Scheme: scheme,
-		Host:   c.endpoint,
+		Scheme: c.endpoint.scheme,
+		Host:   host,
 		Path:   path,
 	}
 
@@ -0,0 +1,116 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrClockSkew is returned when the server rejected a request because the local clock is off.
+// The clock is corrected and the request is retried once.
+var ErrClockSkew = errors.New("local clock is off")
+
+// maxClockSkew is how far S3 allows a request's date to be from the server's clock.
+const maxClockSkew = 15 * time.Minute
+
+// clock is the local time corrected by the offset to the server's clock.
+type clock struct {
+	mu     sync.Mutex
+	offset time.Duration
+
+	onSkew func(offset time.Duration)
+}
+
+func (c *clock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return time.Now().UTC().Add(c.offset)
+}
+
+// correct moves the clock to serverTime. It returns false if the clock was already corrected,
+// in which case retrying would not help.
+func (c *clock) correct(serverTime time.Time) (time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	offset := serverTime.Sub(time.Now()).Round(time.Second)
+	if diff := offset - c.offset; diff > -time.Minute && diff < time.Minute {
+		return c.offset, false
+	}
+	c.offset = offset
+
+	slog.Warn("local clock is off, correcting request times", "offset", offset)
+	if c.onSkew != nil {
+		c.onSkew(offset)
+	}
+
+	return offset, true
+}
+
+// skewTransport corrects the clock when the server rejects a request for being skewed. The
+// request fails with a retriable error so that it is signed again with the corrected time.
+type skewTransport struct {
+	base  http.RoundTripper
+	clock *clock
+}
+
+func (t *skewTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusForbidden {
+		return resp, err
+	}
+
+	serverTime, skewed, err := t.skewedServerTime(resp)
+	if err != nil || !skewed {
+		return resp, err
+	}
+
+	offset, corrected := t.clock.correct(serverTime)
+	if !corrected {
+		return resp, nil
+	}
+
+	_ = resp.Body.Close()
+	return nil, retriableError{fmt.Errorf("%w by %s, corrected", ErrClockSkew, offset)}
+}
+
+// skewedServerTime reads the server's time from a rejected response. The body is put back so
+// that callers can still read it.
+func (t *skewTransport) skewedServerTime(resp *http.Response) (time.Time, bool, error) {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	serverTime, dateErr := http.ParseTime(resp.Header.Get("Date"))
+
+	var errorDocument struct {
+		Code       string `xml:"Code"`
+		ServerTime string `xml:"ServerTime"`
+	}
+	if xml.Unmarshal(body, &errorDocument) == nil {
+		if errorDocument.Code != "RequestTimeTooSkewed" {
+			return time.Time{}, false, nil
+		}
+		if parsed, err := time.Parse(time.RFC3339, errorDocument.ServerTime); err == nil {
+			return parsed, true, nil
+		}
+		return serverTime, dateErr == nil, nil
+	}
+
+	// HEAD responses have no body, so only the Date header tells if the clock is off
+	if dateErr != nil {
+		return time.Time{}, false, nil
+	}
+	skew := serverTime.Sub(t.clock.now())
+	return serverTime, skew > maxClockSkew || skew < -maxClockSkew, nil
+}
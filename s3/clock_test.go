@@ -0,0 +1,105 @@
+package s3_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	fakes3 "github.com/bradenrayhorn/pickle/internal/fake_s3"
+	"github.com/bradenrayhorn/pickle/internal/testutils/assert"
+	"github.com/bradenrayhorn/pickle/s3"
+)
+
+func newSkewTestClient(sv *fakes3.FakeS3, offsets *[]time.Duration) *s3.Client {
+	return s3.NewClient(s3.Config{
+		URL:       sv.GetEndpoint(),
+		Region:    "my-region",
+		KeyID:     "keyid",
+		KeySecret: "shh",
+		Bucket:    "my-bucket",
+		Insecure:  true,
+		OnClockSkew: func(offset time.Duration) {
+			*offsets = append(*offsets, offset)
+		},
+	})
+}
+
+func assertOffset(t *testing.T, expected time.Duration, offsets []time.Duration) {
+	t.Helper()
+
+	assert.Equal(t, 1, len(offsets))
+	diff := offsets[0] - expected
+	assert.True(t, diff > -5*time.Second && diff < 5*time.Second)
+}
+
+func TestCorrectsClockSkew(t *testing.T) {
+	sv := fakes3.NewFakeS3("my-bucket")
+	sv.StartServer()
+	defer sv.StopServer()
+	sv.SetClockSkew(30 * time.Minute)
+
+	offsets := []time.Duration{}
+	client := newSkewTestClient(sv, &offsets)
+
+	// the first request is rejected and retried with the corrected time
+	data := []byte("abc")
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	_, err := client.PutObject("my-file.txt", bytes.NewReader(data), 3, crc32c, sha256, nil)
+	assert.NoErr(t, err)
+	assertOffset(t, 30*time.Minute, offsets)
+
+	// later requests use the corrected time right away
+	result, err := client.ListObjectVersions("", "", "", 500)
+	assert.NoErr(t, err)
+	assert.Equal(t, 1, len(result.Versions))
+
+	reader, err := client.GetObject("my-file.txt", "")
+	assert.NoErr(t, err)
+	got, err := io.ReadAll(reader)
+	assert.NoErr(t, err)
+	_ = reader.Close()
+	assert.Equal(t, "abc", string(got))
+	assert.Equal(t, 1, len(offsets))
+
+	// the server's clock is fixed, so the client follows
+	sv.SetClockSkew(0)
+	_, err = client.ListObjectVersions("", "", "", 500)
+	assert.NoErr(t, err)
+	assert.Equal(t, 2, len(offsets))
+}
+
+func TestCorrectsClockSkewFromHead(t *testing.T) {
+	sv := fakes3.NewFakeS3("my-bucket")
+	sv.StartServer()
+	defer sv.StopServer()
+
+	offsets := []time.Duration{}
+	client := newSkewTestClient(sv, &offsets)
+
+	data := []byte("abc")
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	version, err := client.PutObject("my-file.txt", bytes.NewReader(data), 3, crc32c, sha256, nil)
+	assert.NoErr(t, err)
+
+	// HEAD responses have no error body, so the skew is read from the Date header
+	sv.SetClockSkew(-time.Hour)
+	meta, err := client.HeadObject("my-file.txt", "")
+	assert.NoErr(t, err)
+	assert.Equal(t, version.VersionID, meta.VersionID)
+	assertOffset(t, -time.Hour, offsets)
+}
+
+func TestDoesNotCorrectOtherErrors(t *testing.T) {
+	sv := fakes3.NewFakeS3("my-bucket")
+	sv.StartServer()
+	defer sv.StopServer()
+	sv.SetCredentials("keyid", "other")
+
+	offsets := []time.Duration{}
+	client := newSkewTestClient(sv, &offsets)
+
+	_, err := client.ListObjectVersions("", "", "", 500)
+	assert.ErrContains(t, err, "<Code>SignatureDoesNotMatch</Code>")
+	assert.Equal(t, 0, len(offsets))
+}
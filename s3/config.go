@@ -1,12 +1,55 @@
 package s3
 
+import (
+	"crypto/x509"
+	"net/url"
+	"time"
+)
+
 type Config struct {
+	// URL is the endpoint, either a host such as s3.example.com:9000 or a full URL with a scheme
+	// and optional base path such as https://example.com/s3.
 	URL          string
 	Region       string
 	KeyID        string
 	KeySecret    string
+	SessionToken string
 	Bucket       string
 	StorageClass string
 
+	// Credentials are used instead of the keys when set. Without either, DefaultCredentials is
+	// used.
+	Credentials CredentialsProvider
+
+	// AddressingStyle defaults to path style.
+	AddressingStyle AddressingStyle
+
+	// Insecure uses http for endpoints without a scheme.
 	Insecure bool
+
+	// IdleTimeout closes pooled connections that haven't been used for this long. Defaults to
+	// 90 seconds. It is capped by StallTimeout, as the read a pooled connection keeps waiting
+	// on is held to the stall timeout too.
+	IdleTimeout time.Duration
+
+	// StallTimeout fails a request when no data is sent or received for this long, however long
+	// the whole request takes. Defaults to 2 minutes.
+	StallTimeout time.Duration
+
+	// Proxy is the HTTP(S) proxy for requests. Without it, the HTTPS_PROXY, HTTP_PROXY and
+	// NO_PROXY environment variables are used.
+	Proxy *url.URL
+
+	// RootCAs replaces the system's certificate authorities when set. LoadRootCAs adds a CA file
+	// to the system's.
+	RootCAs *x509.CertPool
+
+	// UploadRateLimit and DownloadRateLimit cap the bytes per second sent and received across
+	// all requests of the client. Zero is unlimited.
+	UploadRateLimit   int64
+	DownloadRateLimit int64
+
+	// OnClockSkew is called when the local clock turns out to be off from the server's, with
+	// the offset that is now added to request times.
+	OnClockSkew func(offset time.Duration)
 }
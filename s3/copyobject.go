@@ -6,106 +6,166 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"time"
 )
 
-func (c *Client) StreamObjectTo(toKey, key, versionID string, from *Client) error {
-	_, err := withRetries(func() (*PutObjectResponse, error) {
-		// First get the object
-		getQuery := url.Values{}
-		if versionID != "" {
-			getQuery.Add("versionId", versionID)
-		}
-		req, err := http.NewRequest(http.MethodGet, from.buildURL(key, getQuery), nil)
-		if err != nil {
-			return nil, err
-		}
+// ObjectStream is the body of an object along with everything needed to store an identical copy.
+type ObjectStream struct {
+	Body           io.ReadCloser
+	ContentLength  int64
+	ChecksumCRC32C string // base64 encoded
+	Retention      *ObjectLockRetention
 
-		req.Header.Add("x-amz-checksum-mode", "ENABLED")
+	// Metadata is the user metadata of the object, without the x-amz-meta- prefix.
+	Metadata map[string]string
+}
 
-		// sign and send request
-		if err := from.signV4(req, nil); err != nil {
-			return nil, err
-		}
-		resp, err := from.httpClient.Do(req)
+// StreamObjectTo copies an object from another client's bucket through this machine. A lock
+// that has expired at now is not copied.
+func (c *Client) StreamObjectTo(toKey, key, versionID string, from *Client, now time.Time) error {
+	_, err := withRetries(func() (any, error) {
+		stream, err := from.getObjectStream(key, versionID)
 		if err != nil {
-			return nil, retriableError{err}
-		}
-
-		if resp.StatusCode != http.StatusOK {
-			defer func() { _ = resp.Body.Close() }()
-			body, err := io.ReadAll(resp.Body)
-			if err != nil || body == nil {
-				body = []byte("<nil>")
-			}
-			err = fmt.Errorf("GetObject failed with status: %s, response: %q", resp.Status, string(body))
-
-			if resp.StatusCode >= 500 {
-				return nil, retriableError{err}
-			} else {
-				return nil, err
-			}
+			return nil, err
 		}
+		defer func() { _ = stream.Body.Close() }()
 
-		var toUpload io.Reader
-		if resp.ContentLength == 0 {
-			// Could not stream a nil body as Golang would add Transfer-Encoding header of "chunked"
-			// if ContentLength is 0. That header value is not supported by s3 servers.
-			toUpload = bytes.NewReader([]byte(""))
-		} else {
-			toUpload = resp.Body
+		if stream.Retention.ExpiredAt(now) {
+			stream.Retention = nil
 		}
 
-		// Now upload the object
-		req, err = http.NewRequest(http.MethodPut, c.buildURL(toKey, nil), toUpload)
-		if err != nil {
-			return nil, err
-		}
+		return nil, c.putObjectStream(toKey, stream)
+	})
 
-		req.Header.Set("Content-Type", "application/octet-stream")
-		req.ContentLength = resp.ContentLength
+	return err
+}
 
-		retainUntil := resp.Header.Get("x-amz-object-lock-retain-until-date")
-		retainMode := resp.Header.Get("x-amz-object-lock-mode")
+// GetObjectStream opens an object for copying. The caller must close the body.
+func (c *Client) GetObjectStream(key, versionID string) (*ObjectStream, error) {
+	return withRetries(func() (*ObjectStream, error) {
+		return c.getObjectStream(key, versionID)
+	})
+}
 
-		if retainUntil != "" && retainMode != "" {
-			req.Header.Set("x-amz-object-lock-mode", retainMode)
-			req.Header.Set("x-amz-object-lock-retain-until-date", retainUntil)
-		}
+// PutObjectStream stores a copy of an object. The body can only be read once, so unlike the
+// other operations this is not retried.
+func (c *Client) PutObjectStream(key string, stream *ObjectStream) error {
+	return c.putObjectStream(key, stream)
+}
 
-		if c.storageClass != "" {
-			req.Header.Set("x-amz-storage-class", c.storageClass)
+func (c *Client) getObjectStream(key, versionID string) (*ObjectStream, error) {
+	getQuery := url.Values{}
+	if versionID != "" {
+		getQuery.Add("versionId", versionID)
+	}
+	req, err := http.NewRequest(http.MethodGet, c.buildURL(key, getQuery), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("x-amz-checksum-mode", "ENABLED")
+
+	// sign and send request
+	if err := c.signV4(req, nil); err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, retriableError{err}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer func() { _ = resp.Body.Close() }()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil || body == nil {
+			body = []byte("<nil>")
 		}
+		err = fmt.Errorf("GetObject failed with status: %s, response: %q", resp.Status, string(body))
 
-		req.Header.Set("x-amz-sdk-checksum-algorithm", "CRC32C")
-		req.Header.Set("x-amz-checksum-crc32c", resp.Header.Get("x-amz-checksum-crc32c"))
-
-		req.Header.Set("x-amz-meta-pickle-sha256", resp.Header.Get("x-amz-meta-pickle-sha256"))
-		req.Header.Set("x-amz-meta-pickle-id", resp.Header.Get("x-amz-meta-pickle-id"))
-
-		// sign and send request
-		if err := c.signV4WithSum(req, resp.Header.Get("x-amz-meta-pickle-sha256")); err != nil {
+		if resp.StatusCode >= 500 {
+			return nil, retriableError{err}
+		} else {
 			return nil, err
 		}
-
-		resp, err = c.httpClient.Do(req)
+	}
+
+	stream := &ObjectStream{
+		Body:           resp.Body,
+		ContentLength:  resp.ContentLength,
+		ChecksumCRC32C: resp.Header.Get("x-amz-checksum-crc32c"),
+	}
+
+	retainUntil := resp.Header.Get("x-amz-object-lock-retain-until-date")
+	retainMode := resp.Header.Get("x-amz-object-lock-mode")
+	if retainUntil != "" && retainMode != "" {
+		retention, err := parseRetention(retainMode, retainUntil)
 		if err != nil {
-			return nil, retriableError{err}
+			_ = resp.Body.Close()
+			return nil, fmt.Errorf("parse retention of %s: %w", key, err)
 		}
-		defer func() { _ = resp.Body.Close() }()
+		stream.Retention = retention
+	}
 
-		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
-			body, _ := io.ReadAll(resp.Body)
-			err := fmt.Errorf("PutObject failed with status: %s, response: %s", resp.Status, string(body))
+	stream.Metadata = userMetadata(resp.Header)
 
-			if resp.StatusCode >= 500 {
-				return nil, retriableError{err}
-			} else {
-				return nil, err
-			}
-		}
+	return stream, nil
+}
 
-		return nil, nil
-	})
+func (c *Client) putObjectStream(key string, stream *ObjectStream) error {
+	var toUpload io.Reader
+	if stream.ContentLength == 0 {
+		// Could not stream a nil body as Golang would add Transfer-Encoding header of "chunked"
+		// if ContentLength is 0. That header value is not supported by s3 servers.
+		toUpload = bytes.NewReader([]byte(""))
+	} else {
+		toUpload = stream.Body
+	}
+
+	req, err := http.NewRequest(http.MethodPut, c.buildURL(key, nil), toUpload)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.ContentLength = stream.ContentLength
+
+	if stream.Retention != nil {
+		setRetentionHeaders(req, stream.Retention)
+	}
+
+	if c.storageClass != "" {
+		req.Header.Set("x-amz-storage-class", c.storageClass)
+	}
+
+	req.Header.Set("x-amz-sdk-checksum-algorithm", "CRC32C")
+	req.Header.Set("x-amz-checksum-crc32c", stream.ChecksumCRC32C)
+
+	// copy all user metadata, including pickle-sha256 and pickle-id
+	for k, v := range stream.Metadata {
+		req.Header.Set("x-amz-meta-"+k, v)
+	}
+
+	// sign and send request
+	if err := c.signV4WithSum(req, stream.Metadata["pickle-sha256"]); err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return retriableError{err}
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		err := fmt.Errorf("PutObject failed with status: %s, response: %s", resp.Status, string(body))
+
+		if resp.StatusCode >= 500 {
+			return retriableError{err}
+		} else {
+			return err
+		}
+	}
 
-	return err
+	return nil
 }
@@ -0,0 +1,255 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoCredentials is returned when a provider has no credentials to offer.
+var ErrNoCredentials = errors.New("no credentials found")
+
+// Credentials sign requests. Temporary credentials have a session token and expire.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// Expires is zero for credentials that don't expire.
+	Expires time.Time
+}
+
+// CredentialsProvider returns credentials. It is called again once the previous credentials
+// are about to expire.
+type CredentialsProvider interface {
+	Retrieve() (Credentials, error)
+}
+
+// StaticCredentials always returns the same credentials.
+type StaticCredentials Credentials
+
+func (p StaticCredentials) Retrieve() (Credentials, error) {
+	if p.AccessKeyID == "" || p.SecretAccessKey == "" {
+		return Credentials{}, fmt.Errorf("static: %w", ErrNoCredentials)
+	}
+	return Credentials(p), nil
+}
+
+// EnvCredentials reads AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+type EnvCredentials struct{}
+
+func (EnvCredentials) Retrieve() (Credentials, error) {
+	credentials := Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if credentials.AccessKeyID == "" || credentials.SecretAccessKey == "" {
+		return Credentials{}, fmt.Errorf("environment: %w", ErrNoCredentials)
+	}
+	return credentials, nil
+}
+
+// SharedCredentials reads a profile from the shared credentials file. Filename defaults to
+// AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials, and Profile to AWS_PROFILE or default. A
+// profile with credential_process set runs that command instead.
+type SharedCredentials struct {
+	Filename string
+	Profile  string
+}
+
+func (p SharedCredentials) Retrieve() (Credentials, error) {
+	filename := p.Filename
+	if filename == "" {
+		filename = os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	}
+	if filename == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return Credentials{}, fmt.Errorf("shared credentials: %w", ErrNoCredentials)
+		}
+		filename = filepath.Join(home, ".aws", "credentials")
+	}
+
+	profile := p.Profile
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return Credentials{}, fmt.Errorf("shared credentials: %w", ErrNoCredentials)
+	} else if err != nil {
+		return Credentials{}, fmt.Errorf("shared credentials: %w", err)
+	}
+
+	values, ok := readProfile(data, profile)
+	if !ok {
+		return Credentials{}, fmt.Errorf("shared credentials: profile %s: %w", profile, ErrNoCredentials)
+	}
+
+	if command := values["credential_process"]; command != "" {
+		return ProcessCredentials{Command: command}.Retrieve()
+	}
+
+	credentials := Credentials{
+		AccessKeyID:     values["aws_access_key_id"],
+		SecretAccessKey: values["aws_secret_access_key"],
+		SessionToken:    values["aws_session_token"],
+	}
+	if credentials.AccessKeyID == "" || credentials.SecretAccessKey == "" {
+		return Credentials{}, fmt.Errorf("shared credentials: profile %s: %w", profile, ErrNoCredentials)
+	}
+	return credentials, nil
+}
+
+// readProfile returns the keys of one [profile] section of an ini file.
+func readProfile(data []byte, profile string) (map[string]string, bool) {
+	values := map[string]string{}
+	found := false
+	inProfile := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			inProfile = strings.TrimSpace(line[1:len(line)-1]) == profile
+			found = found || inProfile
+			continue
+		}
+
+		if key, value, ok := strings.Cut(line, "="); ok && inProfile {
+			values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+
+	return values, found
+}
+
+// ProcessCredentials runs a command that prints credentials as JSON, in the format used by the
+// credential_process setting of the AWS CLI.
+type ProcessCredentials struct {
+	Command string
+}
+
+type processOutput struct {
+	Version         int    `json:"Version"`
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	SessionToken    string `json:"SessionToken"`
+	Expiration      string `json:"Expiration"`
+}
+
+func (p ProcessCredentials) Retrieve() (Credentials, error) {
+	if p.Command == "" {
+		return Credentials{}, fmt.Errorf("credential process: %w", ErrNoCredentials)
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd.exe", "/C", p.Command)
+	} else {
+		cmd = exec.Command("sh", "-c", p.Command)
+	}
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return Credentials{}, fmt.Errorf("credential process: %w", err)
+	}
+
+	var output processOutput
+	if err := json.Unmarshal(out, &output); err != nil {
+		return Credentials{}, fmt.Errorf("credential process: parse output: %w", err)
+	}
+	if output.Version != 1 {
+		return Credentials{}, fmt.Errorf("credential process: unsupported version %d", output.Version)
+	}
+	if output.AccessKeyID == "" || output.SecretAccessKey == "" {
+		return Credentials{}, fmt.Errorf("credential process: output has no keys")
+	}
+
+	credentials := Credentials{
+		AccessKeyID:     output.AccessKeyID,
+		SecretAccessKey: output.SecretAccessKey,
+		SessionToken:    output.SessionToken,
+	}
+	if output.Expiration != "" {
+		expires, err := time.Parse(time.RFC3339, output.Expiration)
+		if err != nil {
+			return Credentials{}, fmt.Errorf("credential process: parse expiration: %w", err)
+		}
+		credentials.Expires = expires
+	}
+
+	return credentials, nil
+}
+
+// ChainCredentials returns the credentials of the first provider that has any.
+type ChainCredentials []CredentialsProvider
+
+func (c ChainCredentials) Retrieve() (Credentials, error) {
+	errs := []error{}
+	for _, provider := range c {
+		credentials, err := provider.Retrieve()
+		if err == nil {
+			return credentials, nil
+		}
+		if !errors.Is(err, ErrNoCredentials) {
+			return Credentials{}, err
+		}
+		errs = append(errs, err)
+	}
+
+	return Credentials{}, errors.Join(errs...)
+}
+
+// DefaultCredentials looks in the environment, then in the shared credentials file.
+func DefaultCredentials() CredentialsProvider {
+	return ChainCredentials{EnvCredentials{}, SharedCredentials{}}
+}
+
+// Credentials are refreshed this long before they expire, so that they don't expire while a
+// request is in flight.
+const credentialsExpiryWindow = 5 * time.Minute
+
+// credentialsCache holds the credentials of a provider until they are about to expire.
+type credentialsCache struct {
+	provider CredentialsProvider
+
+	mu          sync.Mutex
+	credentials *Credentials
+}
+
+func (c *credentialsCache) get() (Credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.credentials != nil && (c.credentials.Expires.IsZero() || time.Now().Add(credentialsExpiryWindow).Before(c.credentials.Expires)) {
+		return *c.credentials, nil
+	}
+
+	credentials, err := c.provider.Retrieve()
+	if err != nil {
+		return Credentials{}, fmt.Errorf("get credentials: %w", err)
+	}
+	c.credentials = &credentials
+
+	return credentials, nil
+}
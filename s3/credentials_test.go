@@ -0,0 +1,170 @@
+package s3_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	fakes3 "github.com/bradenrayhorn/pickle/internal/fake_s3"
+	"github.com/bradenrayhorn/pickle/internal/testutils/assert"
+	"github.com/bradenrayhorn/pickle/s3"
+)
+
+func TestEnvCredentials(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	_, err := s3.EnvCredentials{}.Retrieve()
+	assert.True(t, errors.Is(err, s3.ErrNoCredentials))
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "keyid")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "shh")
+	t.Setenv("AWS_SESSION_TOKEN", "token")
+	credentials, err := s3.EnvCredentials{}.Retrieve()
+	assert.NoErr(t, err)
+	assert.Equal(t, s3.Credentials{AccessKeyID: "keyid", SecretAccessKey: "shh", SessionToken: "token"}, credentials)
+}
+
+func TestSharedCredentials(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "credentials")
+	assert.NoErr(t, os.WriteFile(filename, []byte(`
+[default]
+aws_access_key_id = default-id
+aws_secret_access_key = default-secret
+
+# a comment
+[backup]
+aws_access_key_id=backup-id
+aws_secret_access_key=backup-secret
+aws_session_token=backup-token
+
+[process]
+credential_process = echo '{"Version": 1, "AccessKeyId": "process-id", "SecretAccessKey": "process-secret"}'
+`), 0o600))
+
+	t.Setenv("AWS_PROFILE", "")
+	credentials, err := s3.SharedCredentials{Filename: filename}.Retrieve()
+	assert.NoErr(t, err)
+	assert.Equal(t, s3.Credentials{AccessKeyID: "default-id", SecretAccessKey: "default-secret"}, credentials)
+
+	credentials, err = s3.SharedCredentials{Filename: filename, Profile: "backup"}.Retrieve()
+	assert.NoErr(t, err)
+	assert.Equal(t, s3.Credentials{AccessKeyID: "backup-id", SecretAccessKey: "backup-secret", SessionToken: "backup-token"}, credentials)
+
+	t.Setenv("AWS_PROFILE", "process")
+	credentials, err = s3.SharedCredentials{Filename: filename}.Retrieve()
+	assert.NoErr(t, err)
+	assert.Equal(t, "process-id", credentials.AccessKeyID)
+
+	_, err = s3.SharedCredentials{Filename: filename, Profile: "missing"}.Retrieve()
+	assert.True(t, errors.Is(err, s3.ErrNoCredentials))
+
+	_, err = s3.SharedCredentials{Filename: filepath.Join(t.TempDir(), "missing")}.Retrieve()
+	assert.True(t, errors.Is(err, s3.ErrNoCredentials))
+}
+
+func TestProcessCredentials(t *testing.T) {
+	credentials, err := s3.ProcessCredentials{
+		Command: `echo '{"Version": 1, "AccessKeyId": "id", "SecretAccessKey": "secret", "SessionToken": "token", "Expiration": "2025-06-20T10:00:00Z"}'`,
+	}.Retrieve()
+	assert.NoErr(t, err)
+	assert.Equal(t, s3.Credentials{
+		AccessKeyID:     "id",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		Expires:         time.Date(2025, time.June, 20, 10, 0, 0, 0, time.UTC),
+	}, credentials)
+
+	_, err = s3.ProcessCredentials{Command: "exit 1"}.Retrieve()
+	assert.ErrContains(t, err, "credential process")
+
+	_, err = s3.ProcessCredentials{Command: `echo '{"Version": 2}'`}.Retrieve()
+	assert.ErrContains(t, err, "unsupported version 2")
+}
+
+func TestChainCredentials(t *testing.T) {
+	chain := s3.ChainCredentials{
+		s3.StaticCredentials{},
+		s3.StaticCredentials{AccessKeyID: "second", SecretAccessKey: "shh"},
+		s3.StaticCredentials{AccessKeyID: "third", SecretAccessKey: "shh"},
+	}
+	credentials, err := chain.Retrieve()
+	assert.NoErr(t, err)
+	assert.Equal(t, "second", credentials.AccessKeyID)
+
+	_, err = s3.ChainCredentials{s3.StaticCredentials{}}.Retrieve()
+	assert.True(t, errors.Is(err, s3.ErrNoCredentials))
+
+	// a broken provider stops the chain instead of silently using other credentials
+	_, err = s3.ChainCredentials{
+		s3.ProcessCredentials{Command: "exit 1"},
+		s3.StaticCredentials{AccessKeyID: "second", SecretAccessKey: "shh"},
+	}.Retrieve()
+	assert.ErrContains(t, err, "credential process")
+}
+
+type countingProvider struct {
+	calls   int
+	expires time.Time
+}
+
+func (p *countingProvider) Retrieve() (s3.Credentials, error) {
+	p.calls++
+	return s3.Credentials{AccessKeyID: "keyid", SecretAccessKey: "shh", SessionToken: "token", Expires: p.expires}, nil
+}
+
+func TestSignsWithSessionToken(t *testing.T) {
+	sv := fakes3.NewFakeS3("my-bucket")
+	sv.StartServer()
+	t.Cleanup(func() { sv.StopServer() })
+
+	seen := []*http.Request{}
+	sv.SetInterceptor(func(r *http.Request, w http.ResponseWriter) bool {
+		seen = append(seen, r)
+		return false
+	})
+
+	provider := &countingProvider{expires: time.Now().Add(time.Hour)}
+	client := s3.NewClient(s3.Config{
+		URL:         sv.GetEndpoint(),
+		Region:      "my-region",
+		Bucket:      "my-bucket",
+		Credentials: provider,
+		Insecure:    true,
+	})
+
+	data := []byte("abc")
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	_, err := client.PutObject("my-file.txt", bytes.NewReader(data), 3, crc32c, sha256, nil)
+	assert.NoErr(t, err)
+	_, err = client.ListObjectVersions("", "", "", 500)
+	assert.NoErr(t, err)
+
+	// the token is sent and signed
+	assert.Equal(t, 2, len(seen))
+	assert.Equal(t, "token", seen[0].Header.Get("x-amz-security-token"))
+	assert.True(t, strings.HasPrefix(seen[0].Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=keyid/"))
+	assert.True(t, strings.Contains(seen[0].Header.Get("Authorization"), ";x-amz-security-token"))
+
+	// credentials are reused until they are about to expire
+	assert.Equal(t, 1, provider.calls)
+
+	// credentials that are about to expire are fetched again
+	provider = &countingProvider{expires: time.Now().Add(time.Minute)}
+	client = s3.NewClient(s3.Config{
+		URL:         sv.GetEndpoint(),
+		Region:      "my-region",
+		Bucket:      "my-bucket",
+		Credentials: provider,
+		Insecure:    true,
+	})
+	_, err = client.ListObjectVersions("", "", "", 500)
+	assert.NoErr(t, err)
+	_, err = client.ListObjectVersions("", "", "", 500)
+	assert.NoErr(t, err)
+	assert.Equal(t, 2, provider.calls)
+}
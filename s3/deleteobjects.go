@@ -32,7 +32,24 @@ type DeletedError struct {
 	Message   string `xml:"Message"`
 }
 
+// IsObjectLocked reports whether the version was kept by its object lock or legal hold. S3
+// reports those as AccessDenied, like versions the credentials may not delete, so the message
+// tells them apart.
+func (e DeletedError) IsObjectLocked() bool {
+	return isObjectLockError(e.Code, e.Message)
+}
+
 func (c *Client) DeleteObjects(objects []ObjectIdentifier) (*DeleteObjectsResult, error) {
+	return c.deleteObjects(objects, false)
+}
+
+// DeleteObjectsBypassingGovernance can also delete versions under a GOVERNANCE lock. The
+// credentials need the s3:BypassGovernanceRetention permission.
+func (c *Client) DeleteObjectsBypassingGovernance(objects []ObjectIdentifier) (*DeleteObjectsResult, error) {
+	return c.deleteObjects(objects, true)
+}
+
+func (c *Client) deleteObjects(objects []ObjectIdentifier, bypassGovernance bool) (*DeleteObjectsResult, error) {
 	query := url.Values{}
 	query.Set("delete", "")
 	reqURL := c.buildURL("", query)
@@ -59,6 +76,9 @@ func (c *Client) DeleteObjects(objects []ObjectIdentifier) (*DeleteObjectsResult
 
 		md5sum := getMD5Sum(data)
 		req.Header.Set("Content-MD5", md5sum)
+		if bypassGovernance {
+			req.Header.Set(bypassGovernanceHeader, "true")
+		}
 
 		if err := c.signV4(req, bytes.NewReader(data)); err != nil {
 			return nil, err
@@ -0,0 +1,90 @@
+package s3
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// AddressingStyle decides where the bucket name goes in request URLs.
+type AddressingStyle string
+
+const (
+	// AddressingPath puts the bucket in the path: https://endpoint/bucket/key. This is the default.
+	AddressingPath AddressingStyle = "path"
+	// AddressingVirtualHosted puts the bucket in the host: https://bucket.endpoint/key.
+	AddressingVirtualHosted AddressingStyle = "virtual-hosted"
+	// AddressingAuto uses virtual-hosted style when the bucket name and endpoint allow it, and
+	// path style otherwise.
+	AddressingAuto AddressingStyle = "auto"
+)
+
+type endpoint struct {
+	scheme   string
+	host     string
+	basePath string
+
+	virtualHosted bool
+}
+
+// parseEndpoint reads the endpoint from the config. The URL may be a bare host, such as
+// s3.example.com:9000, or a full URL with a scheme and a base path, such as
+// https://example.com/s3. Bare hosts use https unless insecure is set.
+func parseEndpoint(config Config) endpoint {
+	e := endpoint{scheme: "https", host: config.URL}
+	if config.Insecure {
+		e.scheme = "http"
+	}
+
+	if strings.Contains(config.URL, "://") {
+		if u, err := url.Parse(config.URL); err == nil && u.Host != "" {
+			e.scheme = strings.ToLower(u.Scheme)
+			e.host = u.Host
+			e.basePath = strings.TrimRight(u.Path, "/")
+		}
+	}
+
+	switch config.AddressingStyle {
+	case AddressingVirtualHosted:
+		e.virtualHosted = true
+	case AddressingAuto:
+		e.virtualHosted = canUseVirtualHost(config.Bucket, e.host, e.scheme == "https")
+	}
+
+	return e
+}
+
+// canUseVirtualHost reports whether the bucket name can be used as a subdomain of the host.
+func canUseVirtualHost(bucket string, host string, secure bool) bool {
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+
+	// IP addresses and single label hosts like localhost have no subdomains
+	if net.ParseIP(strings.Trim(hostname, "[]")) != nil || !strings.Contains(hostname, ".") {
+		return false
+	}
+
+	if len(bucket) < 3 || len(bucket) > 63 {
+		return false
+	}
+
+	// dots add levels to the hostname, which wildcard TLS certificates don't cover
+	if secure && strings.Contains(bucket, ".") {
+		return false
+	}
+
+	for _, label := range strings.Split(bucket, ".") {
+		if label == "" || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,120 @@
+package s3_test
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	fakes3 "github.com/bradenrayhorn/pickle/internal/fake_s3"
+	"github.com/bradenrayhorn/pickle/internal/testutils/assert"
+	"github.com/bradenrayhorn/pickle/s3"
+)
+
+type seenRequest struct {
+	host string
+	path string
+	auth string
+}
+
+func recordRequests(sv *fakes3.FakeS3) *[]seenRequest {
+	seen := []seenRequest{}
+	sv.SetInterceptor(func(r *http.Request, w http.ResponseWriter) bool {
+		seen = append(seen, seenRequest{host: r.Host, path: r.URL.Path, auth: r.Header.Get("Authorization")})
+		return false
+	})
+	return &seen
+}
+
+func TestAddressingStyles(t *testing.T) {
+	sv := fakes3.NewFakeS3("my-bucket")
+	sv.SetBasePath("/storage")
+	sv.StartServer()
+	t.Cleanup(func() { sv.StopServer() })
+	_, port, _ := strings.Cut(sv.GetEndpoint(), ":")
+
+	tests := []struct {
+		name  string
+		url   string
+		style s3.AddressingStyle
+		host  string
+		path  string
+	}{
+		{"path", "http://s3.example.test:" + port + "/storage/", s3.AddressingPath, "s3.example.test:" + port, "/storage/my-bucket/my-file.txt"},
+		{"default is path", "http://s3.example.test:" + port + "/storage", "", "s3.example.test:" + port, "/storage/my-bucket/my-file.txt"},
+		{"virtual-hosted", "http://s3.example.test:" + port + "/storage", s3.AddressingVirtualHosted, "my-bucket.s3.example.test:" + port, "/storage/my-file.txt"},
+		{"auto with a domain", "http://s3.example.test:" + port + "/storage", s3.AddressingAuto, "my-bucket.s3.example.test:" + port, "/storage/my-file.txt"},
+		{"auto with an ip", "http://127.0.0.1:" + port + "/storage", s3.AddressingAuto, "127.0.0.1:" + port, "/storage/my-bucket/my-file.txt"},
+		{"auto with localhost", "http://localhost:" + port + "/storage", s3.AddressingAuto, "localhost:" + port, "/storage/my-bucket/my-file.txt"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sv.Reset()
+			seen := recordRequests(sv)
+
+			client := s3.NewClient(s3.Config{
+				URL:             test.url,
+				Region:          "my-region",
+				KeyID:           "keyid",
+				KeySecret:       "shh",
+				Bucket:          "my-bucket",
+				AddressingStyle: test.style,
+			})
+			s3.DialTo(client, sv.GetEndpoint())
+
+			data := []byte("abc")
+			crc32c, sha256 := fakes3.GetChecksums(data)
+			v1, err := client.PutObject("my-file.txt", bytes.NewReader(data), 3, crc32c, sha256, nil)
+			assert.NoErr(t, err)
+
+			result, err := client.ListObjectVersions("", "", "", 500)
+			assert.NoErr(t, err)
+			assert.Equal(t, 1, len(result.Versions))
+			assert.Equal(t, v1.VersionID, result.Versions[0].VersionId)
+
+			assert.Equal(t, 2, len(*seen))
+			assert.Equal(t, test.host, (*seen)[0].host)
+			assert.Equal(t, test.path, (*seen)[0].path)
+			assert.True(t, strings.HasPrefix((*seen)[0].auth, "AWS4-HMAC-SHA256 "))
+		})
+	}
+}
+
+func TestAutoAddressingFallsBackToPathStyle(t *testing.T) {
+	port := "9000"
+
+	// dotted bucket names break wildcard certificates, so auto only uses them over http
+	for _, url := range []string{"https://s3.example.test:" + port, "s3.example.test:" + port} {
+		client := s3.NewClient(s3.Config{
+			URL:             url,
+			Region:          "my-region",
+			KeyID:           "keyid",
+			KeySecret:       "shh",
+			Bucket:          "my.bucket",
+			AddressingStyle: s3.AddressingAuto,
+		})
+		assert.Equal(t, "https://s3.example.test:"+port+"/my.bucket/my-file.txt", client.URLFor("my-file.txt"))
+	}
+
+	client := s3.NewClient(s3.Config{
+		URL:             "http://s3.example.test:" + port,
+		Region:          "my-region",
+		KeyID:           "keyid",
+		KeySecret:       "shh",
+		Bucket:          "my.bucket",
+		AddressingStyle: s3.AddressingAuto,
+	})
+	assert.Equal(t, "http://my.bucket.s3.example.test:"+port+"/my-file.txt", client.URLFor("my-file.txt"))
+
+	// names that aren't valid hostnames always use path style
+	client = s3.NewClient(s3.Config{
+		URL:             "http://s3.example.test:" + port,
+		Region:          "my-region",
+		KeyID:           "keyid",
+		KeySecret:       "shh",
+		Bucket:          "My_Bucket",
+		AddressingStyle: s3.AddressingAuto,
+	})
+	assert.Equal(t, "http://s3.example.test:"+port+"/My_Bucket/my-file.txt", client.URLFor("my-file.txt"))
+}
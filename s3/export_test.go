@@ -0,0 +1,39 @@
+package s3
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// SetCopyLimits lowers the multipart copy limits so tests can use small objects.
+func SetCopyLimits(t testing.TB, maxObjectSize int64, partSize int64) {
+	previousMax, previousPart := maxCopyObjectSize, copyPartSize
+	maxCopyObjectSize, copyPartSize = maxObjectSize, partSize
+
+	t.Cleanup(func() {
+		maxCopyObjectSize, copyPartSize = previousMax, previousPart
+	})
+}
+
+// DialTo sends every request of the client to addr, whatever host is in the URL. Tests use it
+// for virtual-hosted style requests, whose hostnames don't resolve.
+func DialTo(c *Client, addr string) {
+	c.httpClient.Transport.(*skewTransport).base = &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// URLFor returns the URL the client uses for key.
+func (c *Client) URLFor(key string) string {
+	return c.buildURL(key, nil)
+}
+
+// SignRequest signs req like the client does, with a fixed time and service.
+func SignRequest(req *http.Request, credentials Credentials, region string, service string, t time.Time, payloadHash string) {
+	_ = signRequest(req, credentials, region, service, t, payloadHash)
+}
@@ -0,0 +1,90 @@
+package s3_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	fakes3 "github.com/bradenrayhorn/pickle/internal/fake_s3"
+	"github.com/bradenrayhorn/pickle/internal/testutils/assert"
+	"github.com/bradenrayhorn/pickle/s3"
+)
+
+func TestGovernanceLockCanBeBypassed(t *testing.T) {
+	sv, client := newSigningTestClient(t, "keyid", "shh")
+
+	now := time.Now().UTC()
+	sv.SetNow(now)
+
+	data := []byte("abc")
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	version, err := client.PutObject("my-file.txt", bytes.NewReader(data), 3, crc32c, sha256, &s3.ObjectLockRetention{Mode: s3.LockModeGovernance, Until: now.Add(time.Hour)})
+	assert.NoErr(t, err)
+	objects := []s3.ObjectIdentifier{{Key: "my-file.txt", VersionID: version.VersionID}}
+
+	// without bypassing, the lock holds
+	res, err := client.DeleteObjects(objects)
+	assert.NoErr(t, err)
+	assert.Equal(t, 1, len(res.Error))
+
+	err = client.PutObjectRetention("my-file.txt", version.VersionID, &s3.ObjectLockRetention{Mode: s3.LockModeGovernance, Until: now.Add(time.Minute)})
+	assert.True(t, errors.Is(err, s3.ErrObjectLocked))
+
+	// extending never needs a bypass
+	assert.NoErr(t, client.PutObjectRetention("my-file.txt", version.VersionID, &s3.ObjectLockRetention{Mode: s3.LockModeGovernance, Until: now.Add(2 * time.Hour)}))
+
+	// bypassing can shorten and delete
+	assert.NoErr(t, client.PutObjectRetentionBypassingGovernance("my-file.txt", version.VersionID, &s3.ObjectLockRetention{Mode: s3.LockModeGovernance, Until: now.Add(time.Minute)}))
+	assert.Equal(t, now.Add(time.Minute).Truncate(time.Second), sv.GetByVersionID(version.VersionID).Retention.Until)
+
+	res, err = client.DeleteObjectsBypassingGovernance(objects)
+	assert.NoErr(t, err)
+	assert.Equal(t, 0, len(res.Error))
+	assert.True(t, sv.GetByVersionID(version.VersionID) == nil)
+}
+
+func TestComplianceLockCantBeBypassed(t *testing.T) {
+	sv, client := newSigningTestClient(t, "keyid", "shh")
+
+	now := time.Now().UTC()
+	sv.SetNow(now)
+
+	data := []byte("abc")
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	version, err := client.PutObject("my-file.txt", bytes.NewReader(data), 3, crc32c, sha256, &s3.ObjectLockRetention{Mode: s3.LockModeCompliance, Until: now.Add(time.Hour)})
+	assert.NoErr(t, err)
+
+	res, err := client.DeleteObjectsBypassingGovernance([]s3.ObjectIdentifier{{Key: "my-file.txt", VersionID: version.VersionID}})
+	assert.NoErr(t, err)
+	assert.Equal(t, 1, len(res.Error))
+	assert.True(t, res.Error[0].IsObjectLocked())
+
+	err = client.PutObjectRetentionBypassingGovernance("my-file.txt", version.VersionID, &s3.ObjectLockRetention{Mode: s3.LockModeCompliance, Until: now.Add(time.Minute)})
+	assert.True(t, errors.Is(err, s3.ErrObjectLocked))
+
+	// nor can it be downgraded to governance
+	err = client.PutObjectRetentionBypassingGovernance("my-file.txt", version.VersionID, &s3.ObjectLockRetention{Mode: s3.LockModeGovernance, Until: now.Add(2 * time.Hour)})
+	assert.True(t, errors.Is(err, s3.ErrObjectLocked))
+}
+
+func TestRetentionPermissionErrorIsNotALock(t *testing.T) {
+	sv, client := newSigningTestClient(t, "keyid", "shh")
+
+	data := []byte("abc")
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	version, err := client.PutObject("my-file.txt", bytes.NewReader(data), 3, crc32c, sha256, nil)
+	assert.NoErr(t, err)
+
+	// credentials without s3:PutObjectRetention get a plain AccessDenied
+	sv.SetInterceptor(func(r *http.Request, w http.ResponseWriter) bool {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte("<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>"))
+		return true
+	})
+
+	err = client.PutObjectRetention("my-file.txt", version.VersionID, &s3.ObjectLockRetention{Mode: s3.LockModeGovernance, Until: time.Now().Add(time.Hour)})
+	assert.ErrContains(t, err, "AccessDenied")
+	assert.True(t, !errors.Is(err, s3.ErrObjectLocked))
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 )
 
@@ -14,30 +15,49 @@ type ObjectMetadata struct {
 
 	PickleSHA256              string
 	PickleID                  string
+	PickleContentHMAC         string
+	PickleCompression         string
 	ObjectLockMode            string
 	ObjectLockRetainUntilDate time.Time
+	ObjectLockLegalHold       bool
+
+	Size int64
 }
 
 func (c *Client) HeadObject(key string, versionId string) (*ObjectMetadata, error) {
+	meta, _, err := c.headObject(key, versionId)
+	return meta, err
+}
+
+// headObject also returns the raw response headers, for callers that need more than pickle's
+// own metadata.
+func (c *Client) headObject(key string, versionId string) (*ObjectMetadata, http.Header, error) {
+	type result struct {
+		meta   *ObjectMetadata
+		header http.Header
+	}
+
 	query := url.Values{}
 	if versionId != "" {
 		query.Add("versionId", versionId)
 	}
 	reqURL := c.buildURL(key, query)
 
-	return withRetries(func() (*ObjectMetadata, error) {
+	res, err := withRetries(func() (result, error) {
 		req, err := http.NewRequest(http.MethodHead, reqURL, nil)
 		if err != nil {
-			return nil, err
+			return result{}, err
 		}
 
+		req.Header.Add("x-amz-checksum-mode", "ENABLED")
+
 		// sign and send request
 		if err := c.signV4(req, nil); err != nil {
-			return nil, err
+			return result{}, err
 		}
 		resp, err := c.httpClient.Do(req)
 		if err != nil {
-			return nil, retriableError{err}
+			return result{}, retriableError{err}
 		}
 		defer func() { _ = resp.Body.Close() }()
 
@@ -49,9 +69,9 @@ func (c *Client) HeadObject(key string, versionId string) (*ObjectMetadata, erro
 			err = fmt.Errorf("HeadObject failed with status: %s, response: %q", resp.Status, string(body))
 
 			if resp.StatusCode >= 500 {
-				return nil, retriableError{err}
+				return result{}, retriableError{err}
 			} else {
-				return nil, err
+				return result{}, err
 			}
 		}
 
@@ -60,7 +80,7 @@ func (c *Client) HeadObject(key string, versionId string) (*ObjectMetadata, erro
 		if retainHeader != "" {
 			parsed, err := time.Parse(time.RFC3339, retainHeader)
 			if err != nil {
-				return nil, fmt.Errorf("parse retain time '%s' for %s: %w", retainHeader, key, err)
+				return result{}, fmt.Errorf("parse retain time '%s' for %s: %w", retainHeader, key, err)
 			}
 
 			retainUntil = parsed
@@ -68,21 +88,39 @@ func (c *Client) HeadObject(key string, versionId string) (*ObjectMetadata, erro
 
 		sha256 := resp.Header.Get("x-amz-meta-pickle-sha256")
 		if sha256 == "" {
-			return nil, fmt.Errorf("pickle-sha256 metadata missing from %s %s", key, versionId)
+			return result{}, fmt.Errorf("pickle-sha256 metadata missing from %s %s", key, versionId)
 		}
 		id := resp.Header.Get("x-amz-meta-pickle-id")
 		if id == "" {
-			return nil, fmt.Errorf("pickle-id metadata missing from %s %s", key, versionId)
+			return result{}, fmt.Errorf("pickle-id metadata missing from %s %s", key, versionId)
 		}
 
-		return &ObjectMetadata{
+		return result{meta: &ObjectMetadata{
 			Key:       key,
 			VersionID: resp.Header.Get("x-amz-version-id"),
 
 			PickleID:                  id,
 			PickleSHA256:              sha256,
+			PickleContentHMAC:         resp.Header.Get("x-amz-meta-pickle-content-hmac"),
+			PickleCompression:         resp.Header.Get("x-amz-meta-pickle-compression"),
 			ObjectLockMode:            resp.Header.Get("x-amz-object-lock-mode"),
 			ObjectLockRetainUntilDate: retainUntil,
-		}, nil
+			ObjectLockLegalHold:       resp.Header.Get("x-amz-object-lock-legal-hold") == LegalHoldOn,
+
+			Size: resp.ContentLength,
+		}, header: resp.Header}, nil
 	})
+
+	return res.meta, res.header, err
+}
+
+func userMetadata(header http.Header) map[string]string {
+	metadata := map[string]string{}
+	for k, v := range header {
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, "x-amz-meta-") && len(v) == 1 {
+			metadata[strings.TrimPrefix(k, "x-amz-meta-")] = v[0]
+		}
+	}
+	return metadata
 }
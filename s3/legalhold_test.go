@@ -0,0 +1,68 @@
+package s3_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	fakes3 "github.com/bradenrayhorn/pickle/internal/fake_s3"
+	"github.com/bradenrayhorn/pickle/internal/testutils/assert"
+	"github.com/bradenrayhorn/pickle/s3"
+)
+
+func TestObjectLegalHold(t *testing.T) {
+	sv, client := newSigningTestClient(t, "keyid", "shh")
+
+	now := time.Now().UTC()
+	sv.SetNow(now)
+
+	// put a file without any retention
+	data := []byte("abc")
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	version, err := client.PutObject("my-file.txt", bytes.NewReader(data), 3, crc32c, sha256, nil)
+	assert.NoErr(t, err)
+
+	// a version that was never held reports no hold
+	held, err := client.GetObjectLegalHold("my-file.txt", version.VersionID)
+	assert.NoErr(t, err)
+	assert.True(t, !held)
+
+	// hold it
+	assert.NoErr(t, client.PutObjectLegalHold("my-file.txt", version.VersionID, true))
+
+	held, err = client.GetObjectLegalHold("my-file.txt", version.VersionID)
+	assert.NoErr(t, err)
+	assert.True(t, held)
+
+	meta, err := client.HeadObject("my-file.txt", version.VersionID)
+	assert.NoErr(t, err)
+	assert.True(t, meta.ObjectLockLegalHold)
+
+	// held file can't be deleted, even long after
+	sv.SetNow(now.Add(24 * 365 * time.Hour))
+	res, err := client.DeleteObjects([]s3.ObjectIdentifier{{Key: "my-file.txt", VersionID: version.VersionID}})
+	assert.NoErr(t, err)
+	assert.Equal(t, 1, len(res.Error))
+	assert.True(t, res.Error[0].IsObjectLocked())
+
+	// release it
+	assert.NoErr(t, client.PutObjectLegalHold("my-file.txt", version.VersionID, false))
+
+	held, err = client.GetObjectLegalHold("my-file.txt", version.VersionID)
+	assert.NoErr(t, err)
+	assert.True(t, !held)
+
+	res, err = client.DeleteObjects([]s3.ObjectIdentifier{{Key: "my-file.txt", VersionID: version.VersionID}})
+	assert.NoErr(t, err)
+	assert.Equal(t, 0, len(res.Error))
+}
+
+func TestObjectLegalHoldMissingVersion(t *testing.T) {
+	_, client := newSigningTestClient(t, "keyid", "shh")
+
+	err := client.PutObjectLegalHold("my-file.txt", "nope", true)
+	assert.ErrContains(t, err, "NoSuchVersion")
+
+	_, err = client.GetObjectLegalHold("my-file.txt", "nope")
+	assert.ErrContains(t, err, "NoSuchVersion")
+}
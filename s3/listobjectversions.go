@@ -78,7 +78,7 @@ func (c *Client) ListObjectVersions(prefix, keyMarker, versionIdMarker string, m
 
 		resp, err := c.httpClient.Do(req)
 		if err != nil {
-			return nil, err
+			return nil, retriableError{err}
 		}
 		defer func() { _ = resp.Body.Close() }()
 
@@ -0,0 +1,109 @@
+package s3_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	fakes3 "github.com/bradenrayhorn/pickle/internal/fake_s3"
+	"github.com/bradenrayhorn/pickle/internal/testutils/assert"
+	"github.com/bradenrayhorn/pickle/s3"
+)
+
+func getURL(t *testing.T, url string) (int, string) {
+	resp, err := http.Get(url)
+	assert.NoErr(t, err)
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	assert.NoErr(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func TestPresignGet(t *testing.T) {
+	sv := fakes3.NewFakeS3("my-bucket")
+	now := time.Now().UTC()
+	sv.SetNow(now)
+
+	sv.StartServer()
+	t.Cleanup(func() { sv.StopServer() })
+
+	client := s3.NewClient(s3.Config{
+		URL:       sv.GetEndpoint(),
+		Region:    "my-region",
+		KeyID:     "keyid",
+		KeySecret: "shh",
+		Bucket:    "my-bucket",
+		Insecure:  true,
+	})
+
+	// upload two versions
+	crc32c, sha256 := fakes3.GetChecksums([]byte("abc"))
+	v1, err := client.PutObject("my file+.txt", bytes.NewReader([]byte("abc")), 3, crc32c, sha256, nil)
+	assert.NoErr(t, err)
+	crc32c, sha256 = fakes3.GetChecksums([]byte("xyz"))
+	_, err = client.PutObject("my file+.txt", bytes.NewReader([]byte("xyz")), 3, crc32c, sha256, nil)
+	assert.NoErr(t, err)
+
+	// the URL works without credentials, and for a specific version
+	url, err := client.PresignGet("my file+.txt", v1.VersionID, time.Hour)
+	assert.NoErr(t, err)
+	assert.True(t, strings.Contains(url, "/my-bucket/my%20file%2B.txt?"))
+
+	status, body := getURL(t, url)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "abc", body)
+
+	// a changed URL is rejected
+	status, body = getURL(t, strings.Replace(url, "versionId="+v1.VersionID, "versionId=other", 1))
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.True(t, strings.Contains(body, "<Code>SignatureDoesNotMatch</Code>"))
+
+	// a wrong secret is rejected
+	sv.SetCredentials("keyid", "other")
+	status, body = getURL(t, url)
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.True(t, strings.Contains(body, "<Code>SignatureDoesNotMatch</Code>"))
+	sv.SetCredentials("keyid", "shh")
+
+	// the URL stops working once it expires
+	sv.SetNow(now.Add(2 * time.Hour))
+	status, body = getURL(t, url)
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.True(t, strings.Contains(body, "Request has expired"))
+
+	// expiry is limited
+	_, err = client.PresignGet("my file+.txt", "", 8*24*time.Hour)
+	assert.ErrContains(t, err, "presign expiry")
+}
+
+func TestPresignGetWithSessionToken(t *testing.T) {
+	sv := fakes3.NewFakeS3("my-bucket")
+	sv.StartServer()
+	t.Cleanup(func() { sv.StopServer() })
+
+	client := s3.NewClient(s3.Config{
+		URL:          sv.GetEndpoint(),
+		Region:       "my-region",
+		KeyID:        "keyid",
+		KeySecret:    "shh",
+		SessionToken: "token",
+		Bucket:       "my-bucket",
+		Insecure:     true,
+	})
+
+	crc32c, sha256 := fakes3.GetChecksums([]byte("abc"))
+	_, err := client.PutObject("my-file.txt", bytes.NewReader([]byte("abc")), 3, crc32c, sha256, nil)
+	assert.NoErr(t, err)
+
+	url, err := client.PresignGet("my-file.txt", "", time.Minute)
+	assert.NoErr(t, err)
+	assert.True(t, strings.Contains(url, "X-Amz-Security-Token=token"))
+
+	status, body := getURL(t, url)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "abc", body)
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"time"
 
 	"github.com/segmentio/ksuid"
 )
@@ -16,6 +15,11 @@ type PutObjectResponse struct {
 }
 
 func (c *Client) PutObject(key string, data io.ReadSeeker, dataLength int64, crc32cChecksum []byte, sha256Checksum []byte, retention *ObjectLockRetention) (*PutObjectResponse, error) {
+	return c.PutObjectWithMetadata(key, data, dataLength, crc32cChecksum, sha256Checksum, retention, nil)
+}
+
+// PutObjectWithMetadata is PutObject with additional x-amz-meta-* headers.
+func (c *Client) PutObjectWithMetadata(key string, data io.ReadSeeker, dataLength int64, crc32cChecksum []byte, sha256Checksum []byte, retention *ObjectLockRetention, metadata map[string]string) (*PutObjectResponse, error) {
 	reqURL := c.buildURL(key, nil)
 
 	return withRetries(func() (*PutObjectResponse, error) {
@@ -33,8 +37,7 @@ func (c *Client) PutObject(key string, data io.ReadSeeker, dataLength int64, crc
 		req.ContentLength = dataLength
 
 		if retention != nil {
-			req.Header.Set("x-amz-object-lock-mode", retention.Mode)
-			req.Header.Set("x-amz-object-lock-retain-until-date", retention.Until.Format(time.RFC3339))
+			setRetentionHeaders(req, retention)
 		}
 
 		if c.storageClass != "" {
@@ -47,6 +50,9 @@ func (c *Client) PutObject(key string, data io.ReadSeeker, dataLength int64, crc
 		// add pickle metadata
 		req.Header.Set("x-amz-meta-pickle-sha256", hex.EncodeToString(sha256Checksum))
 		req.Header.Set("x-amz-meta-pickle-id", ksuid.New().String())
+		for k, v := range metadata {
+			req.Header.Set("x-amz-meta-"+k, v)
+		}
 
 		// sign and send request
 		if err := c.signV4WithSum(req, hex.EncodeToString(sha256Checksum)); err != nil {
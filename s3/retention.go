@@ -2,6 +2,8 @@ package s3
 
 import (
 	"encoding/base64"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"hash/crc32"
 	"io"
@@ -11,12 +13,73 @@ import (
 	"time"
 )
 
+const (
+	// LockModeGovernance locks can be shortened or removed by users allowed to bypass governance
+	// retention.
+	LockModeGovernance = "GOVERNANCE"
+	// LockModeCompliance locks can't be shortened or removed by anyone, including the root user.
+	LockModeCompliance = "COMPLIANCE"
+
+	bypassGovernanceHeader = "x-amz-bypass-governance-retention"
+)
+
+// ErrObjectLocked is returned when retention can't be applied because it would weaken a lock
+// that is still active.
+var ErrObjectLocked = errors.New("object is protected by object lock")
+
+// isObjectLockRefusal tells a request refused by an object lock apart from one the credentials
+// aren't allowed to make. S3 answers both with AccessDenied, only the message differs.
+func isObjectLockRefusal(body []byte) bool {
+	var errorDocument struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.Unmarshal(body, &errorDocument) != nil {
+		return false
+	}
+	return isObjectLockError(errorDocument.Code, errorDocument.Message)
+}
+
+func isObjectLockError(code string, message string) bool {
+	return code == "AccessDenied" && strings.Contains(strings.ToLower(message), "object lock")
+}
+
 type ObjectLockRetention struct {
 	Mode  string // GOVERNANCE or COMPLIANCE
 	Until time.Time
 }
 
+// ExpiredAt reports whether the lock has run out at now. S3 refuses to put an object locked
+// until a date that has passed, so copies of such objects are left unlocked.
+func (r *ObjectLockRetention) ExpiredAt(now time.Time) bool {
+	return r != nil && !r.Until.After(now)
+}
+
+func setRetentionHeaders(req *http.Request, retention *ObjectLockRetention) {
+	req.Header.Set("x-amz-object-lock-mode", retention.Mode)
+	req.Header.Set("x-amz-object-lock-retain-until-date", retention.Until.Format(time.RFC3339))
+}
+
+func parseRetention(mode string, until string) (*ObjectLockRetention, error) {
+	parsed, err := time.Parse(time.RFC3339, until)
+	if err != nil {
+		return nil, fmt.Errorf("parse retain time '%s': %w", until, err)
+	}
+
+	return &ObjectLockRetention{Mode: mode, Until: parsed}, nil
+}
+
 func (c *Client) PutObjectRetention(key string, versionID string, retention *ObjectLockRetention) error {
+	return c.putObjectRetention(key, versionID, retention, false)
+}
+
+// PutObjectRetentionBypassingGovernance can also shorten a GOVERNANCE lock or change it to
+// another mode. The credentials need the s3:BypassGovernanceRetention permission.
+func (c *Client) PutObjectRetentionBypassingGovernance(key string, versionID string, retention *ObjectLockRetention) error {
+	return c.putObjectRetention(key, versionID, retention, true)
+}
+
+func (c *Client) putObjectRetention(key string, versionID string, retention *ObjectLockRetention, bypassGovernance bool) error {
 	query := url.Values{}
 	query.Set("retention", "")
 	query.Set("versionId", versionID)
@@ -48,6 +111,9 @@ func (c *Client) PutObjectRetention(key string, versionID string, retention *Obj
 
 		req.Header.Set("x-amz-sdk-checksum-algorithm", "CRC32C")
 		req.Header.Set("x-amz-checksum-crc32c", base64.StdEncoding.EncodeToString(crc32cChecksum))
+		if bypassGovernance {
+			req.Header.Set(bypassGovernanceHeader, "true")
+		}
 
 		if err := c.signV4(req, strings.NewReader(retentionXML)); err != nil {
 			return nil, err
@@ -55,7 +121,7 @@ func (c *Client) PutObjectRetention(key string, versionID string, retention *Obj
 
 		resp, err := c.httpClient.Do(req)
 		if err != nil {
-			return nil, err
+			return nil, retriableError{err}
 		}
 		defer func() { _ = resp.Body.Close() }()
 
@@ -65,6 +131,8 @@ func (c *Client) PutObjectRetention(key string, versionID string, retention *Obj
 
 			if resp.StatusCode >= 500 {
 				return nil, retriableError{err}
+			} else if resp.StatusCode == http.StatusForbidden && isObjectLockRefusal(body) {
+				return nil, fmt.Errorf("%w: %w", ErrObjectLocked, err)
 			} else {
 				return nil, err
 			}
@@ -2,10 +2,13 @@ package s3_test
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -221,7 +224,7 @@ func TestObjectRetention(t *testing.T) {
 	res, err := client.DeleteObjects([]s3.ObjectIdentifier{{Key: "my-file.txt", VersionID: version.VersionID}})
 	assert.NoErr(t, err)
 	assert.Equal(t, 1, len(res.Error))
-	assert.Equal(t, "Object is locked", res.Error[0].Message)
+	assert.Equal(t, "Access Denied because object protected by object lock.", res.Error[0].Message)
 
 	// wait two hours and try again
 	sv.SetNow(now.Add(2 * time.Hour))
@@ -263,7 +266,7 @@ func TestObjectPutRetention(t *testing.T) {
 	res, err := client.DeleteObjects([]s3.ObjectIdentifier{{Key: "my-file.txt", VersionID: version.VersionID}})
 	assert.NoErr(t, err)
 	assert.Equal(t, 1, len(res.Error))
-	assert.Equal(t, "Object is locked", res.Error[0].Message)
+	assert.Equal(t, "Access Denied because object protected by object lock.", res.Error[0].Message)
 }
 
 func TestObjectRetentionWithDeletionMarker(t *testing.T) {
@@ -321,7 +324,7 @@ func TestObjectRetentionWithDeletionMarker(t *testing.T) {
 	res, err = client.DeleteObjects([]s3.ObjectIdentifier{{Key: "my-file.txt", VersionID: "0001"}, {Key: "my-file.txt", VersionID: "0002"}})
 	assert.NoErr(t, err)
 	assert.Equal(t, 1, len(res.Error))
-	assert.Equal(t, "Object is locked", res.Error[0].Message)
+	assert.Equal(t, "Access Denied because object protected by object lock.", res.Error[0].Message)
 
 	// delete marker is gone
 	result, err = client.ListObjectVersions("", "", "", 500)
@@ -391,6 +394,39 @@ func TestGetObject(t *testing.T) {
 	assert.Equal(t, hex.EncodeToString(data), hex.EncodeToString(reply))
 }
 
+func TestGetObjectWithoutVersionReturnsLatest(t *testing.T) {
+	sv := fakes3.NewFakeS3("my-bucket")
+
+	sv.StartServer()
+	t.Cleanup(func() { sv.StopServer() })
+	url := sv.GetEndpoint()
+
+	client := s3.NewClient(s3.Config{
+		URL:       url,
+		Region:    "my-region",
+		KeyID:     "keyid",
+		KeySecret: "shh",
+		Bucket:    "my-bucket",
+		Insecure:  true,
+	})
+
+	// put a file twice
+	for _, data := range [][]byte{[]byte("old"), []byte("new")} {
+		crc32c, sha256 := fakes3.GetChecksums(data)
+		_, err := client.PutObject("my-file.txt", bytes.NewReader(data), int64(len(data)), crc32c, sha256, nil)
+		assert.NoErr(t, err)
+	}
+
+	// without a version, the newest one is returned
+	res, err := client.GetObject("my-file.txt", "")
+	assert.NoErr(t, err)
+	defer func() { _ = res.Close() }()
+
+	reply, err := io.ReadAll(res)
+	assert.NoErr(t, err)
+	assert.Equal(t, "new", string(reply))
+}
+
 func TestGetObjectDoesRetries(t *testing.T) {
 	sv := fakes3.NewFakeS3("my-bucket")
 	now := time.Now().UTC()
@@ -524,6 +560,7 @@ func TestHeadObject(t *testing.T) {
 		PickleSHA256:              hex.EncodeToString(sha256),
 		ObjectLockMode:            "COMPLIANCE",
 		ObjectLockRetainUntilDate: now.Add(time.Hour).Truncate(time.Second),
+		Size:                      3,
 	}, *res)
 }
 
@@ -641,7 +678,7 @@ func TestCopyObject(t *testing.T) {
 	assert.NoErr(t, err)
 
 	// copy object into dst
-	err = dstClient.StreamObjectTo("my-file.txt", "my-file.txt", v1.VersionID, srcClient)
+	err = dstClient.StreamObjectTo("my-file.txt", "my-file.txt", v1.VersionID, srcClient, now)
 	assert.NoErr(t, err)
 
 	// try to get object back
@@ -662,6 +699,7 @@ func TestCopyObject(t *testing.T) {
 		PickleSHA256:              hex.EncodeToString(sha256),
 		ObjectLockMode:            "COMPLIANCE",
 		ObjectLockRetainUntilDate: now.Add(time.Hour).Truncate(time.Second),
+		Size:                      3,
 	}, *res)
 }
 
@@ -711,7 +749,7 @@ func TestCopyObjectDoesRetries(t *testing.T) {
 	})
 
 	// copy object into dst
-	err = dstClient.StreamObjectTo("my-file.txt", "my-file.txt", v1.VersionID, srcClient)
+	err = dstClient.StreamObjectTo("my-file.txt", "my-file.txt", v1.VersionID, srcClient, now)
 	assert.NoErr(t, err)
 
 	// try another but this should fail
@@ -720,7 +758,7 @@ func TestCopyObjectDoesRetries(t *testing.T) {
 		w.WriteHeader(http.StatusInternalServerError)
 		return true
 	})
-	err = dstClient.StreamObjectTo("my-file.txt", "my-file.txt", v1.VersionID, srcClient)
+	err = dstClient.StreamObjectTo("my-file.txt", "my-file.txt", v1.VersionID, srcClient, now)
 	assert.ErrContains(t, err, "retries exceeded")
 }
 
@@ -872,3 +910,136 @@ func TestPutObjectRetentionDoesRetries(t *testing.T) {
 	assert.Equal(t, 1, len(versions))
 	assert.Equal(t, until, versions[0].Retention.Until)
 }
+
+func newSharedEndpointClients(t *testing.T) (*fakes3.FakeS3, *fakes3.FakeS3, *s3.Client, *s3.Client) {
+	src := fakes3.NewFakeS3("my-bucket")
+	dst := fakes3.NewFakeS3("my-bucket-backup")
+	now := time.Now().UTC()
+	src.SetNow(now)
+	dst.SetNow(now)
+
+	src.ServeBucket(dst)
+	src.StartServer()
+	t.Cleanup(func() { src.StopServer() })
+
+	srcClient := s3.NewClient(s3.Config{
+		URL:       src.GetEndpoint(),
+		Region:    "my-region",
+		KeyID:     "keyid",
+		KeySecret: "shh",
+		Bucket:    "my-bucket",
+		Insecure:  true,
+	})
+	dstClient := s3.NewClient(s3.Config{
+		URL:       src.GetEndpoint(),
+		Region:    "my-region",
+		KeyID:     "keyid",
+		KeySecret: "shh",
+		Bucket:    "my-bucket-backup",
+		Insecure:  true,
+	})
+
+	return src, dst, srcClient, dstClient
+}
+
+func TestServerSideCopy(t *testing.T) {
+	src, dst, srcClient, dstClient := newSharedEndpointClients(t)
+	assert.True(t, dstClient.SharesEndpointWith(srcClient))
+
+	// upload an object to src
+	now := time.Now().UTC()
+	data := []byte("abc")
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	v1, err := srcClient.PutObjectWithMetadata("my file+.txt", bytes.NewReader(data), 3, crc32c, sha256, &s3.ObjectLockRetention{Mode: "COMPLIANCE", Until: now.Add(time.Hour)}, map[string]string{"pickle-compression": "gzip"})
+	assert.NoErr(t, err)
+
+	// the body must never be downloaded
+	src.SetInterceptor(func(r *http.Request, w http.ResponseWriter) bool {
+		if r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/my-bucket/") {
+			t.Errorf("unexpected download of %s", r.URL.Path)
+		}
+		return false
+	})
+
+	source, err := srcClient.CopySourceFor("my file+.txt", v1.VersionID)
+	assert.NoErr(t, err)
+	assert.Equal(t, int64(3), source.Size)
+
+	copied, err := dstClient.CopyObject("my file+.txt", source)
+	assert.NoErr(t, err)
+
+	srcMeta, err := srcClient.HeadObject("my file+.txt", v1.VersionID)
+	assert.NoErr(t, err)
+	dstMeta, err := dstClient.HeadObject("my file+.txt", copied.VersionID)
+	assert.NoErr(t, err)
+
+	assert.Equal(t, srcMeta.PickleID, dstMeta.PickleID)
+	assert.Equal(t, srcMeta.PickleSHA256, dstMeta.PickleSHA256)
+	assert.Equal(t, "gzip", dstMeta.PickleCompression)
+	assert.Equal(t, "COMPLIANCE", dstMeta.ObjectLockMode)
+	assert.Equal(t, now.Add(time.Hour).Truncate(time.Second), dstMeta.ObjectLockRetainUntilDate)
+
+	versions := dst.GetVersions("my file+.txt")
+	assert.Equal(t, 1, len(versions))
+	assert.Equal(t, "abc", string(versions[0].Content))
+	assert.Equal(t, base64.StdEncoding.EncodeToString(crc32c), versions[0].Checksum)
+}
+
+func TestServerSideCopyInParts(t *testing.T) {
+	s3.SetCopyLimits(t, 4, 3)
+	_, dst, srcClient, dstClient := newSharedEndpointClients(t)
+
+	// upload an object bigger than the single copy limit
+	data := []byte("0123456789")
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	v1, err := srcClient.PutObjectWithMetadata("my-file.txt", bytes.NewReader(data), 10, crc32c, sha256, nil, map[string]string{"pickle-compression": "gzip"})
+	assert.NoErr(t, err)
+
+	source, err := srcClient.CopySourceFor("my-file.txt", v1.VersionID)
+	assert.NoErr(t, err)
+	copied, err := dstClient.CopyObject("my-file.txt", source)
+	assert.NoErr(t, err)
+
+	srcMeta, err := srcClient.HeadObject("my-file.txt", v1.VersionID)
+	assert.NoErr(t, err)
+	dstMeta, err := dstClient.HeadObject("my-file.txt", copied.VersionID)
+	assert.NoErr(t, err)
+	assert.Equal(t, srcMeta.PickleID, dstMeta.PickleID)
+	assert.Equal(t, "gzip", dstMeta.PickleCompression)
+
+	versions := dst.GetVersions("my-file.txt")
+	assert.Equal(t, 1, len(versions))
+	assert.Equal(t, "0123456789", string(versions[0].Content))
+	assert.Equal(t, base64.StdEncoding.EncodeToString(crc32c), versions[0].Checksum)
+	assert.Equal(t, 0, dst.GetMultipartUploadCount())
+
+	// a checksum mismatch aborts the upload
+	source.ChecksumCRC32C = base64.StdEncoding.EncodeToString([]byte("nope"))
+	_, err = dstClient.CopyObject("my-file.txt", source)
+	assert.ErrContains(t, err, "CompleteMultipartUpload failed")
+	assert.Equal(t, 0, dst.GetMultipartUploadCount())
+	assert.Equal(t, 1, len(dst.GetVersions("my-file.txt")))
+}
+
+func TestServerSideCopyNotAllowed(t *testing.T) {
+	src, _, srcClient, dstClient := newSharedEndpointClients(t)
+
+	data := []byte("abc")
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	v1, err := srcClient.PutObject("my-file.txt", bytes.NewReader(data), 3, crc32c, sha256, nil)
+	assert.NoErr(t, err)
+
+	source, err := srcClient.CopySourceFor("my-file.txt", v1.VersionID)
+	assert.NoErr(t, err)
+
+	src.SetInterceptor(func(r *http.Request, w http.ResponseWriter) bool {
+		if r.Header.Get("x-amz-copy-source") != "" {
+			http.Error(w, "AccessDenied", http.StatusForbidden)
+			return true
+		}
+		return false
+	})
+
+	_, err = dstClient.CopyObject("my-file.txt", source)
+	assert.True(t, errors.Is(err, s3.ErrCopyNotAllowed))
+}
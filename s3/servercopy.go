@@ -0,0 +1,352 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrCopyNotAllowed is returned when the server refuses a server-side copy, for example
+// because the credentials can't read the source bucket.
+var ErrCopyNotAllowed = errors.New("server-side copy not allowed")
+
+// Objects larger than this can't be copied in one request and are copied in parts instead.
+var (
+	maxCopyObjectSize int64 = 5 << 30
+	copyPartSize      int64 = 512 << 20
+)
+
+// CopySource is an object version in another bucket on the same endpoint.
+type CopySource struct {
+	Bucket    string
+	Key       string
+	VersionID string
+	Size      int64
+
+	// Retention is not copied by S3 and has to be set again.
+	Retention *ObjectLockRetention
+	// Metadata is only used by multipart copies, single copies keep the metadata as-is.
+	Metadata map[string]string
+	// ChecksumCRC32C is the base64 encoded checksum of the whole source object. Multipart copies
+	// are checked against it.
+	ChecksumCRC32C string
+}
+
+// SharesEndpointWith reports whether both clients talk to the same server, so that objects can
+// be copied between their buckets without downloading them.
+func (c *Client) SharesEndpointWith(other *Client) bool {
+	return c.endpoint.scheme == other.endpoint.scheme && c.endpoint.host == other.endpoint.host &&
+		c.endpoint.basePath == other.endpoint.basePath && c.region == other.region
+}
+
+// CopySourceFor returns the copy source of an object version in this client's bucket.
+func (c *Client) CopySourceFor(key string, versionID string) (CopySource, error) {
+	meta, header, err := c.headObject(key, versionID)
+	if err != nil {
+		return CopySource{}, err
+	}
+
+	source := CopySource{
+		Bucket:    c.bucketName,
+		Key:       key,
+		VersionID: meta.VersionID,
+		Size:      meta.Size,
+		Metadata:  userMetadata(header),
+
+		ChecksumCRC32C: header.Get("x-amz-checksum-crc32c"),
+	}
+	if meta.ObjectLockMode != "" && !meta.ObjectLockRetainUntilDate.IsZero() {
+		source.Retention = &ObjectLockRetention{Mode: meta.ObjectLockMode, Until: meta.ObjectLockRetainUntilDate}
+	}
+
+	return source, nil
+}
+
+// CopyObject copies an object version to toKey on the server, without downloading it. Large
+// objects are copied in parts.
+func (c *Client) CopyObject(toKey string, source CopySource) (*PutObjectResponse, error) {
+	if source.Size > maxCopyObjectSize {
+		return c.multipartCopy(toKey, source)
+	}
+
+	reqURL := c.buildURL(toKey, nil)
+
+	return withRetries(func() (*PutObjectResponse, error) {
+		req, err := http.NewRequest(http.MethodPut, reqURL, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("x-amz-copy-source", source.header())
+		req.Header.Set("x-amz-metadata-directive", "COPY")
+		req.Header.Set("x-amz-checksum-algorithm", "CRC32C")
+		c.setCopyHeaders(req, source)
+
+		if err := c.signV4(req, nil); err != nil {
+			return nil, err
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, retriableError{err}
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		if err := checkCopyResponse("CopyObject", resp); err != nil {
+			return nil, err
+		}
+
+		return &PutObjectResponse{
+			VersionID: resp.Header.Get("x-amz-version-id"),
+		}, nil
+	})
+}
+
+func (s CopySource) header() string {
+	path := (&url.URL{Path: "/" + s.Bucket + "/" + s.Key}).EscapedPath()
+	if s.VersionID != "" {
+		path += "?versionId=" + url.QueryEscape(s.VersionID)
+	}
+	return path
+}
+
+func (c *Client) setCopyHeaders(req *http.Request, source CopySource) {
+	if source.Retention != nil {
+		setRetentionHeaders(req, source.Retention)
+	}
+
+	if c.storageClass != "" {
+		req.Header.Set("x-amz-storage-class", c.storageClass)
+	}
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type copyPartResult struct {
+	ETag           string `xml:"ETag"`
+	ChecksumCRC32C string `xml:"ChecksumCRC32C"`
+}
+
+type completedPart struct {
+	PartNumber     int    `xml:"PartNumber"`
+	ETag           string `xml:"ETag"`
+	ChecksumCRC32C string `xml:"ChecksumCRC32C,omitempty"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+func (c *Client) multipartCopy(toKey string, source CopySource) (*PutObjectResponse, error) {
+	uploadID, err := c.createMultipartUpload(toKey, source)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := []completedPart{}
+	for start := int64(0); start < source.Size; start += copyPartSize {
+		end := min(start+copyPartSize, source.Size) - 1
+
+		part, err := c.uploadPartCopy(toKey, uploadID, len(parts)+1, source, start, end)
+		if err != nil {
+			c.abortMultipartUpload(toKey, uploadID)
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+
+	res, err := c.completeMultipartUpload(toKey, uploadID, parts, source.ChecksumCRC32C)
+	if err != nil {
+		c.abortMultipartUpload(toKey, uploadID)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) createMultipartUpload(toKey string, source CopySource) (string, error) {
+	query := url.Values{}
+	query.Set("uploads", "")
+	reqURL := c.buildURL(toKey, query)
+
+	return withRetries(func() (string, error) {
+		req, err := http.NewRequest(http.MethodPost, reqURL, nil)
+		if err != nil {
+			return "", err
+		}
+
+		// metadata is not copied in parts, so it is set on the upload
+		for k, v := range source.Metadata {
+			req.Header.Set("x-amz-meta-"+k, v)
+		}
+		req.Header.Set("x-amz-checksum-algorithm", "CRC32C")
+		req.Header.Set("x-amz-checksum-type", "FULL_OBJECT")
+		c.setCopyHeaders(req, source)
+
+		if err := c.signV4(req, nil); err != nil {
+			return "", err
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return "", retriableError{err}
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		if err := checkCopyResponse("CreateMultipartUpload", resp); err != nil {
+			return "", err
+		}
+
+		result := initiateMultipartUploadResult{}
+		if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return "", err
+		}
+
+		return result.UploadID, nil
+	})
+}
+
+func (c *Client) uploadPartCopy(toKey string, uploadID string, partNumber int, source CopySource, start int64, end int64) (completedPart, error) {
+	query := url.Values{}
+	query.Set("partNumber", fmt.Sprint(partNumber))
+	query.Set("uploadId", uploadID)
+	reqURL := c.buildURL(toKey, query)
+
+	return withRetries(func() (completedPart, error) {
+		req, err := http.NewRequest(http.MethodPut, reqURL, nil)
+		if err != nil {
+			return completedPart{}, err
+		}
+
+		req.Header.Set("x-amz-copy-source", source.header())
+		req.Header.Set("x-amz-copy-source-range", fmt.Sprintf("bytes=%d-%d", start, end))
+
+		if err := c.signV4(req, nil); err != nil {
+			return completedPart{}, err
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return completedPart{}, retriableError{err}
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		if err := checkCopyResponse("UploadPartCopy", resp); err != nil {
+			return completedPart{}, err
+		}
+
+		result := copyPartResult{}
+		if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return completedPart{}, err
+		}
+
+		return completedPart{PartNumber: partNumber, ETag: result.ETag, ChecksumCRC32C: result.ChecksumCRC32C}, nil
+	})
+}
+
+func (c *Client) completeMultipartUpload(toKey string, uploadID string, parts []completedPart, crc32cChecksum string) (*PutObjectResponse, error) {
+	query := url.Values{}
+	query.Set("uploadId", uploadID)
+	reqURL := c.buildURL(toKey, query)
+
+	data, err := xml.Marshal(completeMultipartUpload{Parts: parts})
+	if err != nil {
+		return nil, err
+	}
+
+	return withRetries(func() (*PutObjectResponse, error) {
+		req, err := http.NewRequest(http.MethodPost, reqURL, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Content-Type", "application/xml")
+		req.ContentLength = int64(len(data))
+
+		if crc32cChecksum != "" {
+			req.Header.Set("x-amz-checksum-type", "FULL_OBJECT")
+			req.Header.Set("x-amz-checksum-crc32c", crc32cChecksum)
+		}
+
+		if err := c.signV4(req, bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, retriableError{err}
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		if err := checkCopyResponse("CompleteMultipartUpload", resp); err != nil {
+			return nil, err
+		}
+
+		return &PutObjectResponse{
+			VersionID: resp.Header.Get("x-amz-version-id"),
+		}, nil
+	})
+}
+
+// abortMultipartUpload cleans up a failed copy. Errors are only logged, the copy already failed.
+func (c *Client) abortMultipartUpload(toKey string, uploadID string) {
+	query := url.Values{}
+	query.Set("uploadId", uploadID)
+
+	req, err := http.NewRequest(http.MethodDelete, c.buildURL(toKey, query), nil)
+	if err == nil {
+		err = c.signV4(req, nil)
+	}
+	if err == nil {
+		var resp *http.Response
+		resp, err = c.httpClient.Do(req)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+	}
+
+	if err != nil {
+		slog.Warn("failed to abort multipart upload", "key", toKey, "uploadID", uploadID, "error", err)
+	}
+}
+
+// checkCopyResponse turns a failed copy response into an error. Copies can fail after the
+// server has already sent a 200 status, in which case the body is an error document.
+func checkCopyResponse(operation string, resp *http.Response) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return retriableError{err}
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if resp.StatusCode == http.StatusOK {
+		var errorDocument struct {
+			XMLName xml.Name
+			Code    string `xml:"Code"`
+		}
+		if xml.Unmarshal(body, &errorDocument) != nil || errorDocument.XMLName.Local != "Error" {
+			return nil
+		}
+
+		err := fmt.Errorf("%s failed with error: %s", operation, string(body))
+		if errorDocument.Code == "InternalError" || errorDocument.Code == "SlowDown" {
+			return retriableError{err}
+		}
+		return err
+	}
+
+	err = fmt.Errorf("%s failed with status: %s, response: %s", operation, resp.Status, strings.TrimSpace(string(body)))
+	switch {
+	case resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented:
+		return retriableError{err}
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotImplemented:
+		return fmt.Errorf("%w: %w", ErrCopyNotAllowed, err)
+	default:
+		return err
+	}
+}
@@ -37,43 +37,55 @@ func (c *Client) signV4(req *http.Request, body io.ReadSeeker) error {
 }
 
 func (c *Client) signV4WithSum(req *http.Request, sha256Hash string) error {
-	parsedURL, err := url.Parse(req.URL.String())
+	credentials, err := c.credentials.get()
 	if err != nil {
 		return err
 	}
 
-	// Time used for signature
-	t := time.Now().UTC()
+	// Set hash of request body
+	req.Header.Set("x-amz-content-sha256", sha256Hash)
+
+	// Temporary credentials need their session token
+	if credentials.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", credentials.SessionToken)
+	}
+
+	_ = signRequest(req, credentials, c.region, "s3", c.clock.now(), sha256Hash)
+	return nil
+}
+
+// signRequest sets the x-amz-date and Authorization headers of req and returns the signature.
+// Every header already on the request is signed.
+func signRequest(req *http.Request, credentials Credentials, region string, service string, t time.Time, payloadHash string) string {
 	amzDate := t.Format("20060102T150405Z")
 	dateStamp := t.Format("20060102")
 
 	// Set required headers
 	req.Header.Set("x-amz-date", amzDate)
 
-	// Set hash of request body
-	req.Header.Set("x-amz-content-sha256", sha256Hash)
-
 	// Create canonical URI
-	canonicalURI := parsedURL.Path
+	canonicalURI := uriEncode(req.URL.Path, false)
 	if canonicalURI == "" {
 		canonicalURI = "/"
 	}
 
 	// Create canonical query string
-	canonicalQueryString := parsedURL.RawQuery
-
-	// Create canonical headers
-	canonicalHeaders := ""
-	signedHeaders := ""
+	canonicalQuery := canonicalQueryString(req.URL.Query())
 
-	// Get all headers
+	// Get all headers, with their values trimmed and inner spaces folded
 	headers := make(map[string][]string)
 	for k, v := range req.Header {
 		lowerK := strings.ToLower(k)
-		headers[lowerK] = v
+		for _, value := range v {
+			headers[lowerK] = append(headers[lowerK], strings.Join(strings.Fields(value), " "))
+		}
 	}
 	// Add host header
-	headers["host"] = []string{parsedURL.Host}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers["host"] = []string{host}
 
 	// Sort headers by key
 	var headerKeys []string
@@ -83,6 +95,8 @@ func (c *Client) signV4WithSum(req *http.Request, sha256Hash string) error {
 	sort.Strings(headerKeys)
 
 	// Build canonical headers and signed headers
+	canonicalHeaders := ""
+	signedHeaders := ""
 	for i, k := range headerKeys {
 		canonicalHeaders += k + ":" + strings.Join(headers[k], ",") + "\n"
 		if i > 0 {
@@ -95,14 +109,14 @@ func (c *Client) signV4WithSum(req *http.Request, sha256Hash string) error {
 	canonicalRequest := fmt.Sprintf("%s\n%s\n%s\n%s\n%s\n%s",
 		req.Method,
 		canonicalURI,
-		canonicalQueryString,
+		canonicalQuery,
 		canonicalHeaders,
 		signedHeaders,
-		sha256Hash)
+		payloadHash)
 
 	// Create string to sign
 	algorithm := "AWS4-HMAC-SHA256"
-	credentialScope := fmt.Sprintf("%s/%s/s3/aws4_request", dateStamp, c.region)
+	credentialScope := fmt.Sprintf("%s/%s/%s/aws4_request", dateStamp, region, service)
 
 	h := sha256.New()
 	h.Write([]byte(canonicalRequest))
@@ -115,23 +129,67 @@ func (c *Client) signV4WithSum(req *http.Request, sha256Hash string) error {
 		canonicalRequestHash)
 
 	// Calculate signature
-	kDate := hmacSHA256([]byte("AWS4"+c.secretKey), []byte(dateStamp))
-	kRegion := hmacSHA256(kDate, []byte(c.region))
-	kService := hmacSHA256(kRegion, []byte("s3"))
-	kSigning := hmacSHA256(kService, []byte("aws4_request"))
-	signature := hex.EncodeToString(hmacSHA256(kSigning, []byte(stringToSign)))
+	signature := hex.EncodeToString(hmacSHA256(signingKey(credentials.SecretAccessKey, dateStamp, region, service), []byte(stringToSign)))
 
 	// Add Authorization header
 	authHeader := fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
 		algorithm,
-		c.accessKey,
+		credentials.AccessKeyID,
 		credentialScope,
 		signedHeaders,
 		signature)
 
 	req.Header.Set("Authorization", authHeader)
+	return signature
+}
 
-	return nil
+func signingKey(secretKey string, dateStamp string, region string, service string) []byte {
+	kDate := hmacSHA256([]byte("AWS4"+secretKey), []byte(dateStamp))
+	kRegion := hmacSHA256(kDate, []byte(region))
+	kService := hmacSHA256(kRegion, []byte(service))
+	return hmacSHA256(kService, []byte("aws4_request"))
+}
+
+// uriEncode encodes s the way SigV4 expects: every byte except unreserved characters is
+// percent-encoded, and slashes are kept when encodeSlash is false.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// canonicalQueryString sorts the query by key and then value, and encodes it for SigV4.
+func canonicalQueryString(query url.Values) string {
+	type pair struct{ key, value string }
+
+	pairs := []pair{}
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, pair{uriEncode(key, true), uriEncode(value, true)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].key != pairs[j].key {
+			return pairs[i].key < pairs[j].key
+		}
+		return pairs[i].value < pairs[j].value
+	})
+
+	encoded := make([]string, len(pairs))
+	for i, p := range pairs {
+		encoded[i] = p.key + "=" + p.value
+	}
+	return strings.Join(encoded, "&")
 }
 
 const emptyStringSHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
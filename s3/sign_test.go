@@ -0,0 +1,196 @@
+package s3_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	fakes3 "github.com/bradenrayhorn/pickle/internal/fake_s3"
+	"github.com/bradenrayhorn/pickle/internal/testutils/assert"
+	"github.com/bradenrayhorn/pickle/s3"
+)
+
+func newSigningTestClient(t *testing.T, keyID string, keySecret string) (*fakes3.FakeS3, *s3.Client) {
+	sv := fakes3.NewFakeS3("my-bucket")
+	sv.StartServer()
+	t.Cleanup(func() { sv.StopServer() })
+
+	client := s3.NewClient(s3.Config{
+		URL:       sv.GetEndpoint(),
+		Region:    "my-region",
+		KeyID:     keyID,
+		KeySecret: keySecret,
+		Bucket:    "my-bucket",
+		Insecure:  true,
+	})
+	return sv, client
+}
+
+func TestServerVerifiesSignatures(t *testing.T) {
+	sv, client := newSigningTestClient(t, "keyid", "shh")
+
+	// correctly signed requests are accepted, including keys that need encoding
+	data := []byte("abc")
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	_, err := client.PutObject("folder/my file+(1).txt", bytes.NewReader(data), 3, crc32c, sha256, nil)
+	assert.NoErr(t, err)
+	result, err := client.ListObjectVersions("folder/", "", "", 500)
+	assert.NoErr(t, err)
+	assert.Equal(t, 1, len(result.Versions))
+
+	// a wrong secret is rejected
+	sv.SetCredentials("keyid", "other")
+	_, err = client.ListObjectVersions("", "", "", 500)
+	assert.ErrContains(t, err, "<Code>SignatureDoesNotMatch</Code>")
+
+	// an unknown key is rejected
+	sv.SetCredentials("other", "shh")
+	_, err = client.ListObjectVersions("", "", "", 500)
+	assert.ErrContains(t, err, "<Code>InvalidAccessKeyId</Code>")
+}
+
+func TestServerVerifiesPayloadHash(t *testing.T) {
+	_, client := newSigningTestClient(t, "keyid", "shh")
+
+	// sign the upload with the hash of other content
+	crc32c, _ := fakes3.GetChecksums([]byte("abc"))
+	_, otherSHA256 := fakes3.GetChecksums([]byte("xyz"))
+	_, err := client.PutObject("my-file.txt", bytes.NewReader([]byte("abc")), 3, crc32c, otherSHA256, nil)
+	assert.ErrContains(t, err, "<Code>XAmzContentSHA256Mismatch</Code>")
+}
+
+func TestServerRejectsSkewedRequests(t *testing.T) {
+	sv, _ := newSigningTestClient(t, "keyid", "shh")
+	credentials := s3.Credentials{AccessKeyID: "keyid", SecretAccessKey: "shh"}
+
+	send := func(signedAt time.Time) (int, string) {
+		req, err := http.NewRequest(http.MethodGet, "http://"+sv.GetEndpoint()+"/my-bucket?versions", nil)
+		assert.NoErr(t, err)
+		req.Header.Set("x-amz-content-sha256", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+		s3.SignRequest(req, credentials, "my-region", "s3", signedAt, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoErr(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		body, err := io.ReadAll(resp.Body)
+		assert.NoErr(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := send(time.Now().UTC().Add(-20 * time.Minute))
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.True(t, strings.Contains(body, "<Code>RequestTimeTooSkewed</Code>"))
+
+	status, _ = send(time.Now().UTC().Add(-10 * time.Minute))
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestServerRejectsUnsignedRequests(t *testing.T) {
+	sv, _ := newSigningTestClient(t, "keyid", "shh")
+
+	resp, err := http.Get("http://" + sv.GetEndpoint() + "/my-bucket?versions")
+	assert.NoErr(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+// Vectors from the AWS Signature Version 4 test suite.
+func TestSignatureTestSuite(t *testing.T) {
+	credentials := s3.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signedAt := time.Date(2015, time.August, 30, 12, 36, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		path          string
+		headers       [][2]string
+		signedHeaders string
+		signature     string
+	}{
+		{"get-vanilla", "/", nil, "host;x-amz-date", "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"get-vanilla-empty-query-key", "/?Param1=value1", nil, "host;x-amz-date", "a67d582fa61cc504c4bae71f336f98b97f1ea3c7a6bfe1b6e45aec72011b9aeb"},
+		{"get-vanilla-query-order-key-case", "/?Param2=value2&Param1=value1", nil, "host;x-amz-date", "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+		{"get-vanilla-query-order-key", "/?Param1=value2&Param1=Value1", nil, "host;x-amz-date", "eedbc4e291e521cf13422ffca22be7d2eb8146eecf653089df300a15b2382bd1"},
+		{"get-vanilla-query-order-value", "/?Param1=value2&Param1=value1", nil, "host;x-amz-date", "5772eed61e12b33fae39ee5e7012498b51d56abc0abb7c60486157bd471c4694"},
+		{"get-vanilla-query-unreserved", "/?-._~0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz=-._~0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz", nil, "host;x-amz-date", "9c3e54bfcdf0b19771a7f523ee5669cdf59bc7cc0884027167c21bb143a40197"},
+		{"get-vanilla-utf8-query", "/?%E1%88%B4=bar", nil, "host;x-amz-date", "2cdec8eed098649ff3a119c94853b13c643bcf08f8b0a1d91e12c9027818dd04"},
+		{"get-utf8", "/%E1%88%B4", nil, "host;x-amz-date", "8318018e0b0f223aa2bbf98705b62bb787dc9c0e678f255a891fd03141be5d85"},
+		{"get-space", "/example%20space/", nil, "host;x-amz-date", "652487583200325589f1fba4c7e578f72c47cb61beeca81406b39ddec1366741"},
+		{"get-header-key-duplicate", "/", [][2]string{{"My-Header1", "value2"}, {"My-Header1", "value2"}, {"My-Header1", "value1"}}, "host;my-header1;x-amz-date", "c9d5ea9f3f72853aea855b47ea873832890dbdd183b4468f858259531a5138ea"},
+		{"get-header-value-trim", "/", [][2]string{{"My-Header1", " value1"}, {"My-Header2", ` "a   b   c"`}}, "host;my-header1;my-header2;x-amz-date", "acc3ed3afb60bb290fc8d2dd0098b9911fcaa05412b367055dee359757a9c736"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com"+test.path, nil)
+			assert.NoErr(t, err)
+			for _, header := range test.headers {
+				req.Header.Add(header[0], header[1])
+			}
+
+			s3.SignRequest(req, credentials, "us-east-1", "service", signedAt, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+
+			assert.Equal(t, "20150830T123600Z", req.Header.Get("x-amz-date"))
+			assert.Equal(t,
+				"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders="+test.signedHeaders+", Signature="+test.signature,
+				req.Header.Get("Authorization"))
+		})
+	}
+}
+
+func TestKeysRoundTrip(t *testing.T) {
+	_, client := newSigningTestClient(t, "keyid", "shh")
+
+	keys := []string{
+		"my file.txt",
+		"folder/nested file (1).txt",
+		"1+1=2.txt",
+		"what?.txt",
+		"a&b;c,d:e@f$g.txt",
+		"~tilde*star'quote.txt",
+		"percent%20.txt",
+		"ünïcödé/файл/文件.txt",
+	}
+
+	data := []byte("abc")
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	for _, key := range keys {
+		v, err := client.PutObject(key, bytes.NewReader(data), 3, crc32c, sha256, nil)
+		assert.NoErr(t, err)
+
+		meta, err := client.HeadObject(key, v.VersionID)
+		assert.NoErr(t, err)
+		assert.Equal(t, v.VersionID, meta.VersionID)
+
+		body, err := client.GetObject(key, v.VersionID)
+		assert.NoErr(t, err)
+		content, err := io.ReadAll(body)
+		assert.NoErr(t, err)
+		_ = body.Close()
+		assert.Equal(t, "abc", string(content))
+	}
+
+	// list one at a time so every key is also sent back as a marker
+	seen := []string{}
+	keyMarker, versionIDMarker := "", ""
+	for {
+		result, err := client.ListObjectVersions("", keyMarker, versionIDMarker, 1)
+		assert.NoErr(t, err)
+		for _, version := range result.Versions {
+			seen = append(seen, version.Key)
+		}
+		if !result.IsTruncated {
+			break
+		}
+		keyMarker, versionIDMarker = result.NextKeyMarker, result.NextVersionIdMarker
+	}
+	assert.Equal(t, len(keys), len(seen))
+
+	// prefixes that need encoding
+	result, err := client.ListObjectVersions("folder/nested file (", "", "", 500)
+	assert.NoErr(t, err)
+	assert.Equal(t, 1, len(result.Versions))
+	assert.Equal(t, "folder/nested file (1).txt", result.Versions[0].Key)
+}
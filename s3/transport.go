@@ -0,0 +1,226 @@
+package s3
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultIdleTimeout  = 90 * time.Second
+	defaultStallTimeout = 2 * time.Minute
+)
+
+// newTransport builds the transport for a client. There is no timeout for a whole request, a
+// long upload is fine as long as it keeps making progress.
+func newTransport(config Config) *http.Transport {
+	idleTimeout := config.IdleTimeout
+	if idleTimeout == 0 {
+		idleTimeout = defaultIdleTimeout
+	}
+	stallTimeout := config.StallTimeout
+	if stallTimeout == 0 {
+		stallTimeout = defaultStallTimeout
+	}
+	// stallConn would drop idle connections after the stall timeout anyway
+	idleTimeout = min(idleTimeout, stallTimeout)
+
+	proxy := http.ProxyFromEnvironment
+	if config.Proxy != nil {
+		proxy = http.ProxyURL(config.Proxy)
+	}
+
+	upload := newRateLimiter(config.UploadRateLimit)
+	download := newRateLimiter(config.DownloadRateLimit)
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return &stallConn{Conn: conn, timeout: stallTimeout, upload: upload, download: download}, nil
+		},
+		TLSClientConfig:       &tls.Config{RootCAs: config.RootCAs},
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       idleTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		ResponseHeaderTimeout: stallTimeout,
+	}
+}
+
+// stallConn fails reads and writes that make no progress for timeout, and holds them to the
+// client's rate limits.
+type stallConn struct {
+	net.Conn
+	timeout  time.Duration
+	upload   *rateLimiter
+	download *rateLimiter
+}
+
+func (c *stallConn) Read(p []byte) (int, error) {
+	if c.download != nil && len(p) > c.download.burst {
+		p = p[:c.download.burst]
+	}
+
+	// this includes the read the transport keeps waiting on while the connection is pooled,
+	// which is why the idle timeout can't be longer than the stall timeout
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	n, err := c.Conn.Read(p)
+
+	// what was read is paid for afterwards, the size of a read isn't known up front
+	if c.download != nil {
+		time.Sleep(c.download.reserve(n))
+	}
+	return n, err
+}
+
+func (c *stallConn) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		var delay time.Duration
+		if c.upload != nil {
+			chunk = p[:min(len(p), c.upload.burst)]
+			delay = c.upload.reserve(len(chunk))
+		}
+
+		// the read deadline moves too, the response is read while the request is still being
+		// written, and a pooled connection already has a read waiting from before it was reused
+		if err := c.Conn.SetDeadline(time.Now().Add(delay + c.timeout)); err != nil {
+			return written, err
+		}
+		time.Sleep(delay)
+
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// rateLimiter is a token bucket shared by all connections of a client. It holds up to one
+// second of tokens.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		rate:   float64(bytesPerSecond),
+		burst:  int(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes n tokens and returns how long to wait until the bucket has refilled enough to
+// cover them.
+func (l *rateLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, float64(l.burst))
+	l.last = now
+	l.tokens -= float64(n)
+	debt := l.tokens
+	l.mu.Unlock()
+
+	if debt >= 0 {
+		return 0
+	}
+	return time.Duration(-debt / l.rate * float64(time.Second))
+}
+
+// LoadRootCAs returns the system's certificate authorities together with the ones in caFile, a
+// PEM file. It is meant for servers with a self-signed certificate.
+func LoadRootCAs(caFile string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("read CA file: %w", err)
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in %s", caFile)
+	}
+
+	return pool, nil
+}
+
+// ApplyTransportEnv reads the transport options from environment variables starting with
+// prefix: PROXY, CA_FILE, IDLE_TIMEOUT, STALL_TIMEOUT, UPLOAD_RATE_LIMIT and
+// DOWNLOAD_RATE_LIMIT. Rate limits are in bytes per second.
+func ApplyTransportEnv(config *Config, prefix string) error {
+	if proxy := os.Getenv(prefix + "PROXY"); proxy != "" {
+		parsed, err := url.Parse(proxy)
+		if err != nil {
+			return fmt.Errorf("parse %sPROXY: %w", prefix, err)
+		}
+		config.Proxy = parsed
+	}
+
+	if caFile := os.Getenv(prefix + "CA_FILE"); caFile != "" {
+		pool, err := LoadRootCAs(caFile)
+		if err != nil {
+			return err
+		}
+		config.RootCAs = pool
+	}
+
+	durations := map[string]*time.Duration{
+		"IDLE_TIMEOUT":  &config.IdleTimeout,
+		"STALL_TIMEOUT": &config.StallTimeout,
+	}
+	for name, field := range durations {
+		if value := os.Getenv(prefix + name); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("parse %s%s: %w", prefix, name, err)
+			}
+			*field = parsed
+		}
+	}
+
+	limits := map[string]*int64{
+		"UPLOAD_RATE_LIMIT":   &config.UploadRateLimit,
+		"DOWNLOAD_RATE_LIMIT": &config.DownloadRateLimit,
+	}
+	for name, field := range limits {
+		if value := os.Getenv(prefix + name); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("parse %s%s: %w", prefix, name, err)
+			}
+			*field = parsed
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,191 @@
+package s3_test
+
+import (
+	"bytes"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	fakes3 "github.com/bradenrayhorn/pickle/internal/fake_s3"
+	"github.com/bradenrayhorn/pickle/internal/testutils/assert"
+	"github.com/bradenrayhorn/pickle/s3"
+)
+
+func newTransportTestServer(t *testing.T) (*fakes3.FakeS3, s3.Config) {
+	sv := fakes3.NewFakeS3("my-bucket")
+	sv.StartServer()
+	t.Cleanup(func() { sv.StopServer() })
+
+	return sv, s3.Config{
+		URL:       sv.GetEndpoint(),
+		Region:    "my-region",
+		KeyID:     "keyid",
+		KeySecret: "shh",
+		Bucket:    "my-bucket",
+		Insecure:  true,
+	}
+}
+
+func TestStalledRequestsAreRetried(t *testing.T) {
+	sv, config := newTransportTestServer(t)
+	config.StallTimeout = 100 * time.Millisecond
+	client := s3.NewClient(config)
+
+	// the server hangs before answering the first request
+	var stalls atomic.Int32
+	sv.SetInterceptor(func(r *http.Request, w http.ResponseWriter) bool {
+		if stalls.CompareAndSwap(0, 1) {
+			time.Sleep(300 * time.Millisecond)
+		}
+		return false
+	})
+
+	_, err := client.ListObjectVersions("", "", "", 500)
+	assert.NoErr(t, err)
+	assert.Equal(t, int32(1), stalls.Load())
+}
+
+func TestIdleConnectionsAreClosedAfterStallTimeout(t *testing.T) {
+	sv, config := newTransportTestServer(t)
+
+	// count the connections the client opens
+	target, err := url.Parse("http://" + sv.GetEndpoint())
+	assert.NoErr(t, err)
+	var connections atomic.Int32
+	server := httptest.NewUnstartedServer(httputil.NewSingleHostReverseProxy(target))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	config.URL = server.URL
+	config.StallTimeout = 200 * time.Millisecond
+	config.IdleTimeout = time.Minute
+	client := s3.NewClient(config)
+
+	_, err = client.ListObjectVersions("", "", "", 500)
+	assert.NoErr(t, err)
+
+	// a connection that was idle for less than the stall timeout is reused
+	time.Sleep(50 * time.Millisecond)
+	_, err = client.ListObjectVersions("", "", "", 500)
+	assert.NoErr(t, err)
+	assert.Equal(t, int32(1), connections.Load())
+
+	// the idle timeout is capped by the stall timeout, so a new connection is opened
+	time.Sleep(400 * time.Millisecond)
+	_, err = client.ListObjectVersions("", "", "", 500)
+	assert.NoErr(t, err)
+	assert.Equal(t, int32(2), connections.Load())
+}
+
+func TestUploadRateLimit(t *testing.T) {
+	_, config := newTransportTestServer(t)
+	config.UploadRateLimit = 32 * 1024
+	// the upload takes longer than the stall timeout, but never stalls
+	config.StallTimeout = 200 * time.Millisecond
+	client := s3.NewClient(config)
+
+	data := randomBytes(48 * 1024)
+	crc32c, sha256 := fakes3.GetChecksums(data)
+
+	start := time.Now()
+	_, err := client.PutObject("my-file.txt", bytes.NewReader(data), int64(len(data)), crc32c, sha256, nil)
+	assert.NoErr(t, err)
+	assert.True(t, time.Since(start) >= 400*time.Millisecond)
+}
+
+func TestDownloadRateLimit(t *testing.T) {
+	_, config := newTransportTestServer(t)
+	data := randomBytes(48 * 1024)
+	crc32c, sha256 := fakes3.GetChecksums(data)
+	_, err := s3.NewClient(config).PutObject("my-file.txt", bytes.NewReader(data), int64(len(data)), crc32c, sha256, nil)
+	assert.NoErr(t, err)
+
+	config.DownloadRateLimit = 32 * 1024
+	client := s3.NewClient(config)
+
+	start := time.Now()
+	reader, err := client.GetObject("my-file.txt", "")
+	assert.NoErr(t, err)
+	got, err := io.ReadAll(reader)
+	assert.NoErr(t, err)
+	_ = reader.Close()
+
+	assert.True(t, bytes.Equal(data, got))
+	assert.True(t, time.Since(start) >= 400*time.Millisecond)
+}
+
+func TestProxy(t *testing.T) {
+	_, config := newTransportTestServer(t)
+
+	// a forward proxy that counts what passes through it
+	var proxied atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Add(1)
+
+		outgoing := r.Clone(r.Context())
+		outgoing.RequestURI = ""
+		resp, err := http.DefaultTransport.RoundTrip(outgoing)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+	}))
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	assert.NoErr(t, err)
+	config.Proxy = proxyURL
+	client := s3.NewClient(config)
+
+	_, err = client.ListObjectVersions("", "", "", 500)
+	assert.NoErr(t, err)
+	assert.Equal(t, int32(1), proxied.Load())
+}
+
+func TestRootCAs(t *testing.T) {
+	sv, config := newTransportTestServer(t)
+
+	// serve the fake over https with a self-signed certificate
+	target, err := url.Parse("http://" + sv.GetEndpoint())
+	assert.NoErr(t, err)
+	server := httptest.NewTLSServer(httputil.NewSingleHostReverseProxy(target))
+	defer server.Close()
+
+	config.URL = server.URL
+	config.Insecure = false
+
+	// the certificate isn't trusted by default
+	_, err = s3.NewClient(config).ListObjectVersions("", "", "", 500)
+	assert.ErrContains(t, err, "certificate")
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.NoErr(t, os.WriteFile(caFile, certificate, 0o600))
+
+	config.RootCAs, err = s3.LoadRootCAs(caFile)
+	assert.NoErr(t, err)
+
+	_, err = s3.NewClient(config).ListObjectVersions("", "", "", 500)
+	assert.NoErr(t, err)
+}